@@ -42,6 +42,8 @@ type QueryLogRequest struct {
 	LastQueryFileId     string    `json:"lastQueryFileId"`
 	LastQueryFileOffset int64     `json:"lastQueryFileOffset"`
 	Limit               int64     `json:"limit"`
+	// Aggregation returns counts of the matched logs instead of log entries
+	Aggregation *log_query.AggregationRequest `json:"aggregation"`
 }
 
 // DownloadLogRequest log download request params
@@ -70,6 +72,8 @@ type QueryLogResponse struct {
 	LogEntries []LogEntryResponse `json:"logEntries"`
 	FileId     string             `json:"fileId"`
 	FileOffset int64              `json:"fileOffset"`
+	// Aggregation only set in aggregation mode
+	Aggregation *log_query.AggregationResult `json:"aggregation,omitempty"`
 }
 
 func queryLogHandler(c *gin.Context) {
@@ -129,7 +133,8 @@ func queryLogHandler(c *gin.Context) {
 	wg.Wait()
 
 	resp := QueryLogResponse{
-		LogEntries: logEntries,
+		LogEntries:  logEntries,
+		Aggregation: logQuery.GetAggregationResult(),
 	}
 	if lastPos != nil {
 		resp.FileId = fmt.Sprintf("%d", lastPos.FileId)
@@ -249,6 +254,7 @@ func buildLogQueryReqParams(req QueryLogRequest) (*log_query.QueryLogRequest, er
 		LastQueryFileId:     lastQueryFileId,
 		LastQueryFileOffset: req.LastQueryFileOffset,
 		Limit:               req.Limit,
+		Aggregation:         req.Aggregation,
 	}, nil
 }
 
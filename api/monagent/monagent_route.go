@@ -16,15 +16,20 @@ import (
 	"context"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	adapter "github.com/gwatts/gin-adapter"
 	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
 
 	"github.com/oceanbase/obagent/api/common"
 	"github.com/oceanbase/obagent/config"
+	"github.com/oceanbase/obagent/config/monagent"
+	"github.com/oceanbase/obagent/errors"
 	http2 "github.com/oceanbase/obagent/lib/http"
 	"github.com/oceanbase/obagent/lib/system"
+	"github.com/oceanbase/obagent/monitor/engine"
 	"github.com/oceanbase/obagent/stat"
 )
 
@@ -43,6 +48,7 @@ func InitMonitorAgentRoutes(router *gin.Engine, localRouter *gin.Engine) {
 	v1.GET("/git-info", common.GitInfoHandler)
 	v1.POST("/status", monitorStatusHandler)
 	v1.GET("/status", monitorStatusHandler)
+	v1.GET("/pipelines", pipelinesHandler)
 
 	initMonagentLocalRoutes(localRouter)
 }
@@ -59,6 +65,9 @@ func initMonagentLocalRoutes(localRouter *gin.Engine) {
 	group.GET("/git-info", common.GitInfoHandler)
 	group.POST("/status", monitorStatusHandler)
 	group.GET("/status", monitorStatusHandler)
+	group.POST("/pipelines", pipelinesHandler)
+	group.GET("/pipelines", pipelinesHandler)
+	group.POST("/pipelines/dry-run", pipelineDryRunHandler)
 	group.POST("/module/config/update", common.UpdateConfigPropertiesHandler)
 	group.POST("/module/config/notify", common.NotifyConfigPropertiesHandler)
 }
@@ -107,3 +116,41 @@ func monitorStatusHandler(c *gin.Context) {
 	}
 	common.SendResponse(c, info, nil)
 }
+
+func pipelinesHandler(c *gin.Context) {
+	common.SendResponse(c, engine.GetPipelineManager().ModuleInfos(), nil)
+}
+
+func pipelineDryRunHandler(c *gin.Context) {
+	param := monagent.PipelineDryRunParam{}
+	err := c.BindJSON(&param)
+	if err != nil {
+		common.SendResponse(c, nil, errors.Wrap(err, "decode dry run param"))
+		return
+	}
+	ctx := common.NewContextWithTraceId(c)
+	result, err := dryRunPipelineModule(ctx, param)
+	common.SendResponse(c, result, err)
+}
+
+func dryRunPipelineModule(ctx context.Context, param monagent.PipelineDryRunParam) (*engine.DryRunResult, error) {
+	var timeout time.Duration
+	var err error
+	if param.Timeout != "" {
+		timeout, err = time.ParseDuration(param.Timeout)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid timeout %s", param.Timeout)
+		}
+	}
+	module := &monagent.PipelineModule{}
+	err = yaml.Unmarshal([]byte(param.Config), module)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode pipeline module")
+	}
+	_, err = config.ReplaceConfValues(module, config.GetConfigPropertiesKeyValues())
+	if err != nil {
+		return nil, errors.Wrap(err, "replace config values of pipeline module")
+	}
+	log.WithContext(ctx).Infof("dry run pipeline module %s", module.Name)
+	return engine.DryRunPipelineModule(ctx, module, timeout)
+}
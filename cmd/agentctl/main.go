@@ -29,6 +29,7 @@ import (
 	"github.com/oceanbase/obagent/agentd/api"
 	"github.com/oceanbase/obagent/config"
 	"github.com/oceanbase/obagent/config/agentctl"
+	"github.com/oceanbase/obagent/config/monagent"
 	"github.com/oceanbase/obagent/config/sdk"
 	"github.com/oceanbase/obagent/executor/agent"
 	"github.com/oceanbase/obagent/lib/mask"
@@ -262,6 +263,53 @@ func defineOperationCommands() {
 			}
 		},
 	})
+	agentCtlCommand.AddCommand(&cobra.Command{
+		Use:   "pipelines",
+		Short: "show monagent pipelines",
+		Long:  "show pipeline modules of monagent with plugin chain, state, last error, last collect time and per-stage message counts",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) != 0 {
+				onError(errors.New("too many arguments"))
+				return
+			}
+			admin := agent.NewAdmin(adminConf())
+			pipelines, err := admin.MonagentPipelines()
+			if err != nil {
+				onError(err)
+			} else {
+				onSuccess(pipelines)
+			}
+		},
+	})
+	dryRunCommand := &cobra.Command{
+		Use:   "pipeline-dry-run [file]",
+		Short: "dry run a monagent pipeline module",
+		Long:  "instantiate inputs and processors of a pipeline module yaml via monagent, run one collection cycle and print the messages, outputs and exporters are not started",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) != 1 {
+				onError(errors.New("pipeline module file is required"))
+				return
+			}
+			content, err := os.ReadFile(args[0])
+			if err != nil {
+				onError(err)
+				return
+			}
+			timeout := cmd.Flag("timeout").Value.String()
+			admin := agent.NewAdmin(adminConf())
+			result, err := admin.MonagentPipelineDryRun(monagent.PipelineDryRunParam{
+				Config:  string(content),
+				Timeout: timeout,
+			})
+			if err != nil {
+				onError(err)
+			} else {
+				onSuccess(result)
+			}
+		},
+	}
+	dryRunCommand.PersistentFlags().String("timeout", "", "max time to wait for each input, e.g. 10s")
+	agentCtlCommand.AddCommand(dryRunCommand)
 	agentCtlCommand.AddCommand(&cobra.Command{
 		Use: "start",
 		Run: func(cmd *cobra.Command, args []string) {
@@ -12,7 +12,11 @@
 
 package mgragent
 
-import "time"
+import (
+	"time"
+
+	"github.com/oceanbase/obagent/lib/log_analyzer"
+)
 
 type LogQueryConfig struct {
 	// ErrCountLimit Upper limit for the total number of row errors in single-file processing logs
@@ -38,4 +42,6 @@ type LogLevelAndFilePattern struct {
 	Dir               string   `json:"dir" yaml:"dir"`
 	FilePatterns      []string `json:"filePatterns" yaml:"filePatterns"`
 	LogParserCategory string   `json:"logParserCategory" yaml:"logParserCategory"`
+	// LogPattern User-defined log format, required when LogParserCategory is pattern
+	LogPattern *log_analyzer.PatternConfig `json:"logPattern,omitempty" yaml:"logPattern"`
 }
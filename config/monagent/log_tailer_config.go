@@ -15,6 +15,8 @@ package monagent
 import (
 	"fmt"
 	"time"
+
+	"github.com/oceanbase/obagent/lib/log_analyzer"
 )
 
 type LogTailerConfig struct {
@@ -32,12 +34,49 @@ type TailConfig struct {
 	ProcessLogInterval time.Duration `json:"processLogInterval" yaml:"processLogInterval"`
 	LogSourceType      string        `json:"logSourceType" yaml:"logSourceType"`
 	LogAnalyzerType    string        `json:"logAnalyzerType" yaml:"logAnalyzerType"`
+	// LogPattern User-defined log format, required when LogAnalyzerType is pattern
+	LogPattern *log_analyzer.PatternConfig `json:"logPattern,omitempty" yaml:"logPattern"`
+	// MultiLine assembles multi-line events such as panic stacks, disabled when nil
+	MultiLine *MultiLineConfig `json:"multiLine,omitempty" yaml:"multiLine"`
+	// Throttle limits the logs emitted, disabled when nil
+	Throttle *ThrottleConfig `json:"throttle,omitempty" yaml:"throttle"`
+}
+
+// MultiLineConfig Lines of an event are assembled before emitting, continuation lines are kept in field extra.
+// When no pattern is set, lines the log analyzer can not parse are regarded as continuation lines.
+type MultiLineConfig struct {
+	// StartPattern A line matching it starts a new event
+	StartPattern string `json:"startPattern" yaml:"startPattern"`
+	// ContinuationPattern A line matching it is appended to the preceding event
+	ContinuationPattern string `json:"continuationPattern" yaml:"continuationPattern"`
+	// MaxLines The event is emitted when it reaches max lines, default 500
+	MaxLines int `json:"maxLines" yaml:"maxLines"`
+	// FlushTimeout The pending event is emitted when no more lines come within the timeout, default 3s
+	FlushTimeout time.Duration `json:"flushTimeout" yaml:"flushTimeout"`
 }
 
 func (t TailConfig) GetLogFileRealPath() string {
 	return fmt.Sprintf("%s/%s", t.LogDir, t.LogFileName)
 }
 
+// ThrottleConfig Limits the logs emitted by a tail config, to protect the storage from log storms.
+// Logs are deduplicated first, then sampled by level, then rate limited.
+type ThrottleConfig struct {
+	// RateLimit Max logs emitted per second, 0 means unlimited
+	RateLimit float64 `json:"rateLimit" yaml:"rateLimit"`
+	// Burst Max logs emitted at once, default RateLimit rounded up, at least 1
+	Burst int `json:"burst" yaml:"burst"`
+	// SampleRates Ratio of logs kept by level, e.g. info: 0.1. levels not listed are all kept
+	SampleRates map[string]float64 `json:"sampleRates" yaml:"sampleRates"`
+	// KeepLevels Logs of the levels are neither sampled nor rate limited, e.g. error
+	KeepLevels []string `json:"keepLevels" yaml:"keepLevels"`
+	// DedupWindow Logs with the same normalized content within the window are collapsed into the first one
+	// with field repeat_count, 0 means disabled. Logs are delayed by the window when enabled
+	DedupWindow time.Duration `json:"dedupWindow" yaml:"dedupWindow"`
+	// MaxDedupEntries Max distinct logs held in the window, logs exceeding it are not deduplicated, default 10000
+	MaxDedupEntries int `json:"maxDedupEntries" yaml:"maxDedupEntries"`
+}
+
 type RecoveryConfig struct {
 	// Enabled The function to restore the last tail location from a file is enabled
 	Enabled bool `json:"enabled" yaml:"enabled"`
@@ -45,4 +84,6 @@ type RecoveryConfig struct {
 	LastPositionStoreDir string `json:"lastPositionStoreDir" yaml:"lastPositionStoreDir"`
 	// TriggerStoreThreshold How many lines of tail actively trigger the store action
 	TriggerStoreThreshold uint64 `json:"triggerThreshold" yaml:"triggerThreshold"`
+	// ReadOnly The last position is loaded but never stored, set by pipeline dry run
+	ReadOnly bool `json:"-" yaml:"-"`
 }
@@ -35,6 +35,8 @@ func (p PipelineModuleStatus) Validate() bool {
 type PluginConfig struct {
 	Timeout           time.Duration          `yaml:"timeout"`
 	PluginInnerConfig map[string]interface{} `yaml:"pluginConfig"`
+	// DryRun set when created by pipeline dry run, plugins must not persist any state
+	DryRun bool `yaml:"-"`
 }
 
 type PluginNode struct {
@@ -47,6 +49,8 @@ type PipelineConfig struct {
 	ExposeUrl        string           `yaml:"exposeUrl"`
 	Period           time.Duration    `yaml:"period"`
 	DownSamplePeriod time.Duration    `yaml:"downSamplePeriod"`
+	// SinkBufferSize buffer size (in batches) of each sink when pipeline has multiple sinks
+	SinkBufferSize int `yaml:"sinkBufferSize"`
 }
 
 type PipelineStructure struct {
@@ -54,6 +58,10 @@ type PipelineStructure struct {
 	Processors []*PluginNode `yaml:"processors"`
 	Output     *PluginNode   `yaml:"output"`
 	Exporter   *PluginNode   `yaml:"exporter"`
+	// Outputs and Exporters are used together with Output and Exporter,
+	// each processed batch is sent to all of them.
+	Outputs   []*PluginNode `yaml:"outputs"`
+	Exporters []*PluginNode `yaml:"exporters"`
 }
 
 type PipelineNode struct {
@@ -67,3 +75,11 @@ type PipelineModule struct {
 	Status    PipelineModuleStatus `yaml:"status"`
 	Pipelines []*PipelineNode      `yaml:"pipelines"`
 }
+
+// PipelineDryRunParam request of running one collection cycle of a pipeline module
+type PipelineDryRunParam struct {
+	// Config yaml of PipelineModule, ${xxx} placeholders are replaced by current config properties
+	Config string `json:"config"`
+	// Timeout max time to wait for each input, e.g. 10s
+	Timeout string `json:"timeout"`
+}
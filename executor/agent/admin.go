@@ -27,6 +27,7 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/oceanbase/obagent/agentd/api"
+	"github.com/oceanbase/obagent/config/monagent"
 	"github.com/oceanbase/obagent/lib/command"
 	"github.com/oceanbase/obagent/lib/file"
 	"github.com/oceanbase/obagent/lib/http"
@@ -364,6 +365,40 @@ func (a *Admin) AgentStatus() (api.Status, error) {
 	return status, nil
 }
 
+// MonagentPipelines query runtime information of pipeline modules from monagent
+func (a *Admin) MonagentPipelines() (interface{}, error) {
+	log.Info("MonagentPipelines")
+	var pipelines interface{}
+	cl, err := a.NewClient(path.MonAgent)
+	if err != nil {
+		log.Errorf("failed create client of '%s': %v", path.MonAgent, err)
+		return nil, err
+	}
+	err = cl.Call("/api/v1/pipelines", nil, &pipelines)
+	if err != nil {
+		log.Errorf("failed to get monagent pipelines via api: %v", err)
+		return nil, err
+	}
+	return pipelines, nil
+}
+
+// MonagentPipelineDryRun run one collection cycle of a pipeline module via monagent, outputs are not started
+func (a *Admin) MonagentPipelineDryRun(param monagent.PipelineDryRunParam) (interface{}, error) {
+	log.Info("MonagentPipelineDryRun")
+	var result interface{}
+	cl, err := a.NewClient(path.MonAgent)
+	if err != nil {
+		log.Errorf("failed create client of '%s': %v", path.MonAgent, err)
+		return nil, err
+	}
+	err = cl.Call("/api/v1/pipelines/dry-run", param, &result)
+	if err != nil {
+		log.Errorf("failed to dry run pipeline module via api: %v", err)
+		return nil, err
+	}
+	return result, nil
+}
+
 func (a *Admin) StartService(param StartStopServiceParam) error {
 	log.Infof("StartService %+v", param)
 	cl, err := a.NewClient(path.Agentd)
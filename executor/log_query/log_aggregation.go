@@ -0,0 +1,183 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package log_query
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/oceanbase/obagent/errors"
+)
+
+const (
+	defaultBucketInterval  = 60
+	defaultAggregationTopN = 10
+	maxAggregationTopN     = 100
+	maxAggregationBuckets  = 10000
+	// maxBucketInterval seconds of a year, also keeps the conversion to time.Duration from overflowing
+	maxBucketInterval = 366 * 24 * 3600
+	// maxAggregationKeys distinct keywords counted at most, keywords found later are ignored
+	maxAggregationKeys = 10000
+
+	unknownLogLevel = "unknown"
+)
+
+// defaultTopPatterns error codes of observer logs, e.g. ret=-4012
+var defaultTopPatterns = []string{`ret=(-\d+)`}
+
+// AggregationRequest aggregates the matched logs instead of returning them
+type AggregationRequest struct {
+	// BucketInterval seconds of each time bucket, default 60, at most 366 days
+	BucketInterval int64 `json:"bucketInterval"`
+	// TopN keywords with the most occurrences returned, default 10
+	TopN int `json:"topN"`
+	// TopPatterns regular expressions of counted keywords, the first group is counted when present,
+	// default counts error codes like ret=-4012
+	TopPatterns []string `json:"topPatterns"`
+}
+
+type TimeBucket struct {
+	StartTime time.Time `json:"startTime"`
+	Count     int64     `json:"count"`
+}
+
+type KeywordCount struct {
+	Keyword string `json:"keyword"`
+	Count   int64  `json:"count"`
+}
+
+type AggregationResult struct {
+	Total          int64            `json:"total"`
+	BucketInterval int64            `json:"bucketInterval"`
+	Buckets        []TimeBucket     `json:"buckets"`
+	LevelCounts    map[string]int64 `json:"levelCounts"`
+	FileCounts     map[string]int64 `json:"fileCounts"`
+	TopKeywords    []KeywordCount   `json:"topKeywords"`
+	// Truncated the scan stopped early by timeout or too many errors, the counts are partial
+	Truncated bool `json:"truncated"`
+}
+
+// logAggregator counts the matched log entries while scanning, it is not goroutine safe
+type logAggregator struct {
+	startTime   time.Time
+	interval    time.Duration
+	topN        int
+	topRegexps  []*regexp.Regexp
+	result      *AggregationResult
+	keywordHits map[string]int64
+}
+
+func newLogAggregator(req *AggregationRequest, startTime, endTime time.Time) (*logAggregator, error) {
+	intervalSeconds := req.BucketInterval
+	if intervalSeconds <= 0 {
+		intervalSeconds = defaultBucketInterval
+	}
+	if intervalSeconds > maxBucketInterval {
+		return nil, errors.Errorf("bucketInterval %d exceeds %d seconds", intervalSeconds, maxBucketInterval)
+	}
+	interval := time.Duration(intervalSeconds) * time.Second
+	if endTime.Before(startTime) {
+		return nil, errors.New("endTime is before startTime")
+	}
+	bucketCount := int64(endTime.Sub(startTime)/interval) + 1
+	if bucketCount > maxAggregationBuckets {
+		return nil, errors.Errorf("too many buckets %d, increase bucketInterval", bucketCount)
+	}
+	topN := req.TopN
+	if topN <= 0 {
+		topN = defaultAggregationTopN
+	}
+	if topN > maxAggregationTopN {
+		topN = maxAggregationTopN
+	}
+	topPatterns := req.TopPatterns
+	if len(topPatterns) == 0 {
+		topPatterns = defaultTopPatterns
+	}
+	topRegexps, err := genRegexps(topPatterns)
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := make([]TimeBucket, bucketCount)
+	for i := range buckets {
+		buckets[i].StartTime = startTime.Add(time.Duration(i) * interval)
+	}
+	return &logAggregator{
+		startTime:  startTime,
+		interval:   interval,
+		topN:       topN,
+		topRegexps: topRegexps,
+		result: &AggregationResult{
+			BucketInterval: intervalSeconds,
+			Buckets:        buckets,
+			LevelCounts:    make(map[string]int64),
+			FileCounts:     make(map[string]int64),
+		},
+		keywordHits: make(map[string]int64),
+	}, nil
+}
+
+func (a *logAggregator) add(logEntry LogEntry) {
+	a.result.Total++
+	if !logEntry.LogAt.Before(a.startTime) {
+		index := int(logEntry.LogAt.Sub(a.startTime) / a.interval)
+		if index < len(a.result.Buckets) {
+			a.result.Buckets[index].Count++
+		}
+	}
+	level := strings.ToLower(logEntry.LogLevel)
+	if level == "" {
+		level = unknownLogLevel
+	}
+	a.result.LevelCounts[level]++
+	a.result.FileCounts[logEntry.FileName]++
+
+	for _, topRegexp := range a.topRegexps {
+		for _, subMatch := range topRegexp.FindAllSubmatch(logEntry.LogLine, -1) {
+			keyword := subMatch[0]
+			if len(subMatch) > 1 {
+				keyword = subMatch[1]
+			}
+			a.addKeyword(string(keyword))
+		}
+	}
+}
+
+func (a *logAggregator) addKeyword(keyword string) {
+	if _, ok := a.keywordHits[keyword]; !ok && len(a.keywordHits) >= maxAggregationKeys {
+		return
+	}
+	a.keywordHits[keyword]++
+}
+
+// getResult keywords are ordered by count desc, then by keyword
+func (a *logAggregator) getResult() *AggregationResult {
+	topKeywords := make([]KeywordCount, 0, len(a.keywordHits))
+	for keyword, count := range a.keywordHits {
+		topKeywords = append(topKeywords, KeywordCount{Keyword: keyword, Count: count})
+	}
+	sort.Slice(topKeywords, func(i, j int) bool {
+		if topKeywords[i].Count != topKeywords[j].Count {
+			return topKeywords[i].Count > topKeywords[j].Count
+		}
+		return topKeywords[i].Keyword < topKeywords[j].Keyword
+	})
+	if len(topKeywords) > a.topN {
+		topKeywords = topKeywords[:a.topN]
+	}
+	a.result.TopKeywords = topKeywords
+	return a.result
+}
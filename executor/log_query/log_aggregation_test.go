@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package log_query
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/oceanbase/obagent/config/mgragent"
+	"github.com/oceanbase/obagent/lib/log_analyzer"
+)
+
+func TestNewLogAggregator_invalid(t *testing.T) {
+	startTime := time.Date(2021, 12, 6, 10, 0, 0, 0, time.Local)
+	_, err := newLogAggregator(&AggregationRequest{}, startTime, startTime.Add(-time.Minute))
+	assert.NotNil(t, err)
+	_, err = newLogAggregator(&AggregationRequest{BucketInterval: 1}, startTime, startTime.AddDate(0, 0, 1))
+	assert.NotNil(t, err)
+	_, err = newLogAggregator(&AggregationRequest{BucketInterval: maxBucketInterval + 1}, startTime, startTime.Add(time.Hour))
+	assert.NotNil(t, err)
+	_, err = newLogAggregator(&AggregationRequest{BucketInterval: math.MaxInt64}, startTime, startTime.Add(time.Hour))
+	assert.NotNil(t, err)
+	_, err = newLogAggregator(&AggregationRequest{TopPatterns: []string{"ret=("}}, startTime, startTime.Add(time.Hour))
+	assert.NotNil(t, err)
+
+	aggregator, err := newLogAggregator(&AggregationRequest{TopN: 1000}, startTime, startTime.Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, maxAggregationTopN, aggregator.topN)
+	assert.Equal(t, 61, len(aggregator.result.Buckets))
+	assert.Equal(t, int64(defaultBucketInterval), aggregator.result.BucketInterval)
+}
+
+func TestLogQuerier_queryLogByLineAggregation(t *testing.T) {
+	fileInfo := &FileInfo{
+		FileName: "observer.log",
+		FileId:   1,
+	}
+	startTime := time.Date(2021, 12, 6, 10, 0, 0, 0, time.Local)
+	logQuery, err := NewLogQuery(mgragent.LogQueryConfig{}, &QueryLogRequest{
+		StartTime:      startTime,
+		EndTime:        startTime.Add(5 * time.Minute),
+		LogType:        "observer",
+		ExcludeKeyword: []string{"ignored"},
+		LogLevel:       []string{"INFO", "WARN", "ERROR"},
+		Limit:          1,
+		Aggregation: &AggregationRequest{
+			BucketInterval: 120,
+			TopN:           3,
+		},
+	}, make(chan LogEntry, 1))
+	assert.Nil(t, err)
+
+	logLines := `[2021-12-06 09:59:00.000000] ERROR [SERVER] before start time ret=-4012
+[2021-12-06 10:00:01.000000] INFO  [SERVER] test line 1
+[2021-12-06 10:01:00.000000] WARN  [SERVER] test line 2 ret=-4012
+[2021-12-06 10:02:00.000000] WARN  [SERVER] test line 3 ret=-4012 ret=-4038
+[2021-12-06 10:03:00.000000] ERROR [SERVER] test line 4
+continuation ret=-4184 ret=-4184 ret=-4184
+[2021-12-06 10:04:00.000000] WARN  [SERVER] ignored ret=-4012
+[2021-12-06 10:04:30.000000] ERROR [SERVER] test line 5 ret=-4038
+[2021-12-06 10:06:00.000000] ERROR [SERVER] after end time ret=-4012
+`
+	logQuerier := NewLogQuerier(&mgragent.LogQueryConfig{ErrCountLimit: 100})
+	_, err = logQuerier.queryLogByLine(context.Background(), fileInfo, strings.NewReader(logLines), logQuery, log_analyzer.NewObLogLightAnalyzer(fileInfo.FileName))
+	assert.Nil(t, err)
+	assert.False(t, logQuery.IsExceedLimit())
+
+	result := logQuery.GetAggregationResult()
+	assert.Equal(t, int64(5), result.Total)
+	assert.Equal(t, int64(120), result.BucketInterval)
+	assert.Equal(t, []TimeBucket{
+		{StartTime: startTime, Count: 2},
+		{StartTime: startTime.Add(2 * time.Minute), Count: 2},
+		{StartTime: startTime.Add(4 * time.Minute), Count: 1},
+	}, result.Buckets)
+	assert.Equal(t, map[string]int64{"info": 1, "warn": 2, "error": 2}, result.LevelCounts)
+	assert.Equal(t, map[string]int64{"observer.log": 5}, result.FileCounts)
+	assert.Equal(t, []KeywordCount{
+		{Keyword: "-4184", Count: 3},
+		{Keyword: "-4012", Count: 2},
+		{Keyword: "-4038", Count: 2},
+	}, result.TopKeywords)
+	assert.False(t, result.Truncated)
+}
+
+func TestLogQuerier_queryLogByLineAggregationTimeout(t *testing.T) {
+	fileInfo := &FileInfo{
+		FileName: "observer.log",
+		FileId:   1,
+	}
+	startTime := time.Date(2021, 12, 6, 10, 0, 0, 0, time.Local)
+	logQuery, err := NewLogQuery(mgragent.LogQueryConfig{}, &QueryLogRequest{
+		StartTime:   startTime,
+		EndTime:     startTime.Add(5 * time.Minute),
+		LogType:     "observer",
+		Aggregation: &AggregationRequest{},
+	}, make(chan LogEntry, 1))
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	logLines := "[2021-12-06 10:00:01.000000] INFO  [SERVER] test line 1\n"
+	logQuerier := NewLogQuerier(&mgragent.LogQueryConfig{ErrCountLimit: 100})
+	_, err = logQuerier.queryLogByLine(ctx, fileInfo, strings.NewReader(logLines), logQuery, log_analyzer.NewObLogLightAnalyzer(fileInfo.FileName))
+	assert.Nil(t, err)
+
+	result := logQuery.GetAggregationResult()
+	assert.Equal(t, int64(0), result.Total)
+	assert.True(t, result.Truncated)
+}
+
+func TestLogQuery_GetAggregationResult(t *testing.T) {
+	logQuery, err := NewLogQuery(mgragent.LogQueryConfig{}, &QueryLogRequest{
+		StartTime: time.Now().Add(-time.Hour),
+		EndTime:   time.Now(),
+		LogType:   "observer",
+	}, make(chan LogEntry, 1))
+	assert.Nil(t, err)
+	assert.Nil(t, logQuery.GetAggregationResult())
+}
@@ -103,6 +103,7 @@ func (l *LogQuerier) Query(ctx context.Context, logQuery *LogQuery) (*Position,
 		select {
 		case <-ctx.Done():
 			ctxLog.Info("timeout exceed")
+			logQuery.markTruncated()
 			return lastPos, nil
 		default:
 		}
@@ -147,6 +148,7 @@ func (l *LogQuerier) queryLogByLine(
 		select {
 		case <-ctx.Done():
 			ctxLog.Info("timeout exceed")
+			logQuery.markTruncated()
 			return &Position{
 				FileId:     prevLogEntry.FileId,
 				FileOffset: prevLogEntry.FileOffset,
@@ -160,6 +162,7 @@ func (l *LogQuerier) queryLogByLine(
 		}
 		if errCount > l.GetConf().ErrCountLimit {
 			ctxLog.Info("exceed error count limit")
+			logQuery.markTruncated()
 			break
 		}
 		logLineInfo, isNewLine := logAnalyzer.ParseLine(string(lineBytes))
@@ -327,9 +330,9 @@ func (l *LogQuerier) getMatchedFiles(ctx context.Context, logQuery *LogQuery) ([
 	filePatterns := getFilePattern(params.LogType, params.LogLevel, &logQuery.conf)
 	var matchedFiles []FileDetailInfo
 	for _, filePattern := range filePatterns {
-		logAnalyzer := log_analyzer.GetLogAnalyzer(filePattern.LogAnalyzerCategory, params.LogType)
-		if logAnalyzer == nil {
-			ctxLog.Error("get LogInfoAnalyzer failed")
+		logAnalyzer, err := log_analyzer.NewLogAnalyzer(filePattern.LogAnalyzerCategory, params.LogType, filePattern.LogPattern)
+		if err != nil {
+			ctxLog.WithError(err).Error("get LogInfoAnalyzer failed")
 			continue
 		}
 		foundFiles, err := libFile.FindFilesByRegexAndTimeSpan(ctx, file.FindFilesParam{
@@ -252,3 +252,55 @@ func TestLogQuerier_locateStartPosition(t *testing.T) {
 	}
 	assert.NotZero(t, offset)
 }
+
+func TestLogQuerier_getMatchedFilesWithPattern(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	now := time.Date(2022, 3, 31, 13, 33, 3, 3, time.Local)
+	logFileName := "obproxy.log.20220331005827"
+	os.Create(filepath.Join(tmpDir, logFileName))
+
+	logQuerier := &LogQuerier{}
+	logQuery := &LogQuery{
+		conf: mgragent.LogQueryConfig{
+			LogTypeQueryConfigs: []mgragent.LogTypeQueryConfig{
+				{
+					LogType: "obproxy",
+					LogLevelAndFilePatterns: []mgragent.LogLevelAndFilePattern{
+						{
+							LogLevel:          "ALL",
+							Dir:               tmpDir,
+							FilePatterns:      []string{"obproxy.log*"},
+							LogParserCategory: log_analyzer.TypePattern,
+							LogPattern: &log_analyzer.PatternConfig{
+								Grok:           `\[%{TIMESTAMP_ISO8601:time}\] %{LOGLEVEL:level} %{GREEDYDATA:content}`,
+								TimeLayout:     "2006-01-02 15:04:05.000000",
+								FileTimeLayout: "20060102150405",
+							},
+						},
+					},
+				},
+			},
+		},
+		queryLogParams: &QueryLogRequest{
+			StartTime: now.AddDate(0, 0, -1),
+			EndTime:   now.AddDate(0, 0, 1),
+			LogType:   "obproxy",
+			LogLevel:  []string{"INFO"},
+			Limit:     10,
+		},
+	}
+	fileDetailInfos, err := logQuerier.getMatchedFiles(context.Background(), logQuery)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(fileDetailInfos))
+	if len(fileDetailInfos) == 1 {
+		assert.Equal(t, logFileName, fileDetailInfos[0].FileInfo.Name())
+		msg, isNewLine := fileDetailInfos[0].LogAnalyzer.ParseLine("[2022-03-31 10:00:00.123456] WARN server is busy")
+		assert.True(t, isNewLine)
+		level, _ := msg.GetTag("level")
+		assert.Equal(t, "warn", level)
+	}
+}
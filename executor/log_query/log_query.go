@@ -30,6 +30,7 @@ type LogQuery struct {
 	queryLogParams        *QueryLogRequest
 	logEntryChan          chan LogEntry
 	count                 int64
+	aggregator            *logAggregator
 }
 
 func NewLogQuery(conf mgragent.LogQueryConfig, queryLogParams *QueryLogRequest, logEntryChan chan LogEntry) (*LogQuery, error) {
@@ -57,6 +58,14 @@ func NewLogQuery(conf mgragent.LogQueryConfig, queryLogParams *QueryLogRequest,
 		}
 	}
 
+	var aggregator *logAggregator
+	if queryLogParams.Aggregation != nil {
+		aggregator, err = newLogAggregator(queryLogParams.Aggregation, queryLogParams.StartTime, queryLogParams.EndTime)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &LogQuery{
 		conf:                  conf,
 		keywords:              queryLogParams.Keyword,
@@ -66,6 +75,7 @@ func NewLogQuery(conf mgragent.LogQueryConfig, queryLogParams *QueryLogRequest,
 		queryLogParams:        queryLogParams,
 		logEntryChan:          logEntryChan,
 		count:                 0,
+		aggregator:            aggregator,
 	}, nil
 }
 
@@ -99,7 +109,12 @@ func (l *LogQuery) GetLimit() int64 {
 	return l.queryLogParams.Limit
 }
 
+// SendLogEntry the entry is counted by the aggregator in aggregation mode, which is not limited
 func (l *LogQuery) SendLogEntry(logEntry LogEntry) {
+	if l.aggregator != nil {
+		l.aggregator.add(logEntry)
+		return
+	}
 	l.logEntryChan <- logEntry
 	l.IncCount()
 }
@@ -108,3 +123,18 @@ func (l *LogQuery) IsExceedLimit() bool {
 	limit := l.GetLimit()
 	return limit != 0 && l.GetCount() >= limit
 }
+
+// markTruncated marks the aggregation result as partial when the query stops before all logs are scanned
+func (l *LogQuery) markTruncated() {
+	if l.aggregator != nil {
+		l.aggregator.result.Truncated = true
+	}
+}
+
+// GetAggregationResult returns nil when not in aggregation mode, it should be called after the query finished
+func (l *LogQuery) GetAggregationResult() *AggregationResult {
+	if l.aggregator == nil {
+		return nil
+	}
+	return l.aggregator.getResult()
+}
@@ -39,10 +39,13 @@ type QueryLogRequest struct {
 	LastQueryFileId     uint64        `json:"lastQueryFileId"`
 	LastQueryFileOffset int64         `json:"lastQueryFileOffset"`
 	Limit               int64         `json:"limit"`
+	// Aggregation matched logs are aggregated instead of returned when set, Limit is ignored
+	Aggregation *AggregationRequest `json:"aggregation"`
 }
 
 type DirAndFilePattern struct {
 	LogAnalyzerCategory string
+	LogPattern          *log_analyzer.PatternConfig
 	Dir                 string
 	LogFilePatterns     []string
 }
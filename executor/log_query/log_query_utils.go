@@ -41,6 +41,7 @@ func getFilePattern(logType string, logLevels []string, logQueryConf *mgragent.L
 				Dir:                 levelAndFilePattern.Dir,
 				LogFilePatterns:     levelAndFilePattern.FilePatterns,
 				LogAnalyzerCategory: levelAndFilePattern.LogParserCategory,
+				LogPattern:          levelAndFilePattern.LogPattern,
 			}
 		} else {
 			filePatterns = []DirAndFilePattern{
@@ -48,6 +49,7 @@ func getFilePattern(logType string, logLevels []string, logQueryConf *mgragent.L
 					Dir:                 levelAndFilePattern.Dir,
 					LogFilePatterns:     levelAndFilePattern.FilePatterns,
 					LogAnalyzerCategory: levelAndFilePattern.LogParserCategory,
+					LogPattern:          levelAndFilePattern.LogPattern,
 				},
 			}
 		}
@@ -18,6 +18,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/pkg/errors"
+
 	"github.com/oceanbase/obagent/monitor/message"
 )
 
@@ -56,6 +58,18 @@ func GetLogAnalyzer(typeName string, fileName string) LogAnalyzer {
 	return factory(fileName)
 }
 
+// NewLogAnalyzer creates the analyzer of the type, pattern is required by TypePattern only
+func NewLogAnalyzer(typeName string, fileName string, pattern *PatternConfig) (LogAnalyzer, error) {
+	if typeName == TypePattern {
+		return NewPatternLogAnalyzer(fileName, pattern)
+	}
+	factory := analyzerFactories[typeName]
+	if factory == nil {
+		return nil, errors.Errorf("LogAnalyzerFactory %s not exists", typeName)
+	}
+	return factory(fileName), nil
+}
+
 func ParseScanner(a LogAnalyzer, scanner *bufio.Scanner, msgConsumer func(*message.Message) bool) error {
 	return ParseLines(a, func() (string, bool, error) {
 		ok := scanner.Scan()
@@ -0,0 +1,264 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package log_analyzer
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/oceanbase/obagent/monitor/message"
+)
+
+// TypePattern analyzes logs by the user-defined PatternConfig
+const TypePattern = "pattern"
+
+const (
+	patternTimeGroup    = "time"
+	patternLevelGroup   = "level"
+	patternContentGroup = "content"
+
+	defaultPatternTimeLayout    = "2006-01-02 15:04:05"
+	defaultPatternFileDelimiter = "."
+)
+
+// PatternConfig user-defined log format, e.g. obproxy, obd or application logs.
+// Named groups: time is required, level is added as tag normalized to trace, debug, info, warn, error or fatal,
+// content is added as field, the others are added as tags unless listed in Fields.
+type PatternConfig struct {
+	// Regex regular expression with named groups, e.g. ^\[(?P<time>[^\]]+)\] (?P<level>\w+) (?P<content>.*)
+	Regex string `json:"regex" yaml:"regex"`
+	// Grok grok expression used when Regex is empty, e.g. %{TIMESTAMP_ISO8601:time} %{LOGLEVEL:level} %{GREEDYDATA:content}
+	Grok string `json:"grok" yaml:"grok"`
+	// TimeLayout go layout of the time group, default 2006-01-02 15:04:05. the current year is used when it has no year
+	TimeLayout string `json:"timeLayout" yaml:"timeLayout"`
+	// Fields groups added as fields instead of tags
+	Fields []string `json:"fields" yaml:"fields"`
+	// FileTimeLayout go layout of the time suffix of rotated files, e.g. 20060102150405. file mtime is used when empty
+	FileTimeLayout string `json:"fileTimeLayout" yaml:"fileTimeLayout"`
+	// FileTimeDelimiter delimiter before the time suffix of rotated files, default .
+	FileTimeDelimiter string `json:"fileTimeDelimiter" yaml:"fileTimeDelimiter"`
+}
+
+// levelAliases common level names mapped to the levels of the built-in analyzers, others are kept in lower case
+var levelAliases = map[string]string{
+	"trc":           "trace",
+	"finest":        "trace",
+	"dbg":           "debug",
+	"fine":          "debug",
+	"inf":           "info",
+	"information":   "info",
+	"informational": "info",
+	"notice":        "info",
+	"wrn":           "warn",
+	"warning":       "warn",
+	"err":           "error",
+	"eror":          "error",
+	"crit":          "fatal",
+	"critical":      "fatal",
+	"severe":        "fatal",
+	"panic":         "fatal",
+	"alert":         "fatal",
+	"emerg":         "fatal",
+	"emergency":     "fatal",
+}
+
+func normalizeLevel(level string) string {
+	level = strings.ToLower(level)
+	if alias, ok := levelAliases[level]; ok {
+		return alias
+	}
+	return level
+}
+
+// grokPatterns commonly used grok patterns, %{NAME:group} is expanded to (?P<group>pattern)
+var grokPatterns = map[string]string{
+	"WORD":              `\b\w+\b`,
+	"NOTSPACE":          `\S+`,
+	"SPACE":             `\s*`,
+	"DATA":              `.*?`,
+	"GREEDYDATA":        `.*`,
+	"INT":               `[+-]?\d+`,
+	"POSINT":            `\b[1-9]\d*\b`,
+	"NUMBER":            `[+-]?(?:\d+(?:\.\d+)?|\.\d+)`,
+	"IP":                `(?:\d{1,3}\.){3}\d{1,3}|[0-9A-Fa-f:]*:[0-9A-Fa-f:]+`,
+	"HOSTNAME":          `\b[0-9A-Za-z][0-9A-Za-z-]{0,62}(?:\.[0-9A-Za-z][0-9A-Za-z-]{0,62})*\.?\b`,
+	"UUID":              `[A-Fa-f0-9]{8}-(?:[A-Fa-f0-9]{4}-){3}[A-Fa-f0-9]{12}`,
+	"PATH":              `(?:/[^/\s]*)+`,
+	"QUOTEDSTRING":      `"(?:[^"\\]|\\.)*"`,
+	"LOGLEVEL":          `(?i:trace|debug|info|notice|warn(?:ing)?|err(?:or)?|crit(?:ical)?|fatal|severe|panic)`,
+	"TIMESTAMP_ISO8601": `\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}(?::\d{2}(?:[.,]\d+)?)?(?:Z|[+-]\d{2}:?\d{2})?`,
+	"SYSLOGTIMESTAMP":   `[A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2}`,
+}
+
+var grokRegexp = regexp.MustCompile(`%\{(\w+)(?::(\w+))?\}`)
+
+// expandGrok converts the grok expression to a regular expression
+func expandGrok(grok string) (string, error) {
+	var err error
+	expanded := grokRegexp.ReplaceAllStringFunc(grok, func(s string) string {
+		subMatch := grokRegexp.FindStringSubmatch(s)
+		pattern, ok := grokPatterns[subMatch[1]]
+		if !ok {
+			err = errors.Errorf("unknown grok pattern %s", subMatch[1])
+			return s
+		}
+		if subMatch[2] == "" {
+			return "(?:" + pattern + ")"
+		}
+		return "(?P<" + subMatch[2] + ">" + pattern + ")"
+	})
+	return expanded, err
+}
+
+type compiledPattern struct {
+	config     *PatternConfig
+	regexp     *regexp.Regexp
+	timeIndex  int
+	fields     map[string]bool
+	timeLayout string
+}
+
+// compiledPatterns analyzers are created for every file read, compiled patterns are cached by config
+var compiledPatterns sync.Map
+
+func compilePattern(config *PatternConfig) (*compiledPattern, error) {
+	if config == nil {
+		return nil, errors.New("log pattern not configured")
+	}
+	keyBytes, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	key := string(keyBytes)
+	if cached, ok := compiledPatterns.Load(key); ok {
+		return cached.(*compiledPattern), nil
+	}
+	expr := config.Regex
+	if expr == "" {
+		if config.Grok == "" {
+			return nil, errors.New("neither regex nor grok of log pattern is set")
+		}
+		expr, err = expandGrok(config.Grok)
+		if err != nil {
+			return nil, err
+		}
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, errors.Wrap(err, "compile log pattern")
+	}
+	timeIndex := subExpIndex(re, patternTimeGroup)
+	if timeIndex < 0 {
+		return nil, errors.Errorf("group %s not found in log pattern", patternTimeGroup)
+	}
+	p := &compiledPattern{
+		config:     config,
+		regexp:     re,
+		timeIndex:  timeIndex,
+		fields:     make(map[string]bool, len(config.Fields)),
+		timeLayout: config.TimeLayout,
+	}
+	if p.timeLayout == "" {
+		p.timeLayout = defaultPatternTimeLayout
+	}
+	for _, field := range config.Fields {
+		p.fields[field] = true
+	}
+	compiledPatterns.Store(key, p)
+	return p, nil
+}
+
+// ValidatePattern checks the pattern can be used by TypePattern analyzers
+func ValidatePattern(config *PatternConfig) error {
+	_, err := compilePattern(config)
+	return err
+}
+
+// PatternLogAnalyzer analyzes logs by user-defined regex or grok pattern
+type PatternLogAnalyzer struct {
+	fileName string
+	pattern  *compiledPattern
+}
+
+func NewPatternLogAnalyzer(fileName string, config *PatternConfig) (LogAnalyzer, error) {
+	pattern, err := compilePattern(config)
+	if err != nil {
+		return nil, err
+	}
+	return &PatternLogAnalyzer{
+		fileName: fileName,
+		pattern:  pattern,
+	}, nil
+}
+
+func (a *PatternLogAnalyzer) ParseLine(line string) (*message.Message, bool) {
+	subMatch := a.pattern.regexp.FindStringSubmatch(line)
+	if subMatch == nil {
+		return nil, false
+	}
+	t, err := a.parseTime(subMatch[a.pattern.timeIndex], time.Now())
+	if err != nil {
+		return nil, false
+	}
+	msg := message.NewMessage(a.fileName, message.Log, t)
+	msg.AddField("raw", line)
+	for i, name := range a.pattern.regexp.SubexpNames() {
+		value := subMatch[i]
+		if name == "" || value == "" || i == a.pattern.timeIndex {
+			continue
+		}
+		switch {
+		case name == patternLevelGroup:
+			msg.AddTag("level", normalizeLevel(value))
+		case name == patternContentGroup || a.pattern.fields[name]:
+			msg.AddField(name, value)
+		default:
+			msg.AddTag(name, value)
+		}
+	}
+	return msg, true
+}
+
+// parseTime times without year are regarded as in the last 12 months, like the host logs
+func (a *PatternLogAnalyzer) parseTime(value string, now time.Time) (time.Time, error) {
+	t, err := time.ParseInLocation(a.pattern.timeLayout, value, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if t.Year() != 0 {
+		return t, nil
+	}
+	t = t.AddDate(now.Year(), 0, 0)
+	if t.After(now.Add(24 * time.Hour)) {
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t, nil
+}
+
+func (a *PatternLogAnalyzer) GetFileEndTime(info os.FileInfo) (time.Time, error) {
+	config := a.pattern.config
+	if config.FileTimeLayout == "" {
+		return info.ModTime(), nil
+	}
+	delimiter := config.FileTimeDelimiter
+	if delimiter == "" {
+		delimiter = defaultPatternFileDelimiter
+	}
+	return ParseTimeFromFileName(info.Name(), delimiter, config.FileTimeLayout, info.ModTime()), nil
+}
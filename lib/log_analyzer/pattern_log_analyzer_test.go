@@ -0,0 +1,118 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package log_analyzer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatternLogAnalyzer_regex(t *testing.T) {
+	logAnalyzer, err := NewLogAnalyzer(TypePattern, "app.log", &PatternConfig{
+		Regex:      `^\[(?P<time>[^\]]+)\] (?P<level>\w+) \[(?P<module>\w+)\] (?:trace=(?P<trace>\w+) )?(?P<content>.*)`,
+		TimeLayout: "2006-01-02 15:04:05.000",
+		Fields:     []string{"trace"},
+	})
+	assert.Nil(t, err)
+
+	msg, isNewLine := logAnalyzer.ParseLine("[2023-05-01 10:00:00.123] ERROR [db] trace=abc123 connect failed")
+	assert.True(t, isNewLine)
+	assert.Equal(t, time.Date(2023, 5, 1, 10, 0, 0, 123000000, time.Local), msg.GetTime())
+	checkTag(msg, "level", "error", t)
+	checkTag(msg, "module", "db", t)
+	trace, _ := msg.GetField("trace")
+	assert.Equal(t, "abc123", trace)
+	content, _ := msg.GetField("content")
+	assert.Equal(t, "connect failed", content)
+
+	_, isNewLine = logAnalyzer.ParseLine("\tat com.example.Main")
+	assert.False(t, isNewLine)
+	_, isNewLine = logAnalyzer.ParseLine("[not a time] ERROR [db] connect failed")
+	assert.False(t, isNewLine)
+}
+
+func TestPatternLogAnalyzer_level(t *testing.T) {
+	logAnalyzer, err := NewPatternLogAnalyzer("app.log", &PatternConfig{
+		Regex: `^(?P<time>\S+ \S+) (?P<level>\w+) (?P<content>.*)`,
+	})
+	assert.Nil(t, err)
+	for level, expected := range map[string]string{
+		"INFO":     "info",
+		"Notice":   "info",
+		"WARNING":  "warn",
+		"warn":     "warn",
+		"ERR":      "error",
+		"CRITICAL": "fatal",
+		"crit":     "fatal",
+		"SEVERE":   "fatal",
+		"panic":    "fatal",
+		"DBG":      "debug",
+		"custom":   "custom",
+	} {
+		msg, isNewLine := logAnalyzer.ParseLine("2023-05-01 10:00:00 " + level + " connect failed")
+		assert.True(t, isNewLine)
+		checkTag(msg, "level", expected, t)
+	}
+}
+
+func TestPatternLogAnalyzer_grok(t *testing.T) {
+	logAnalyzer, err := NewPatternLogAnalyzer("messages", &PatternConfig{
+		Grok:       `%{SYSLOGTIMESTAMP:time} %{HOSTNAME:host} %{NOTSPACE:program}: %{GREEDYDATA:content}`,
+		TimeLayout: "Jan _2 15:04:05",
+	})
+	assert.Nil(t, err)
+	msg, isNewLine := logAnalyzer.ParseLine("Mar 28 03:37:07 host1.example.com systemd[1]: Started Session 1 of user root.")
+	assert.True(t, isNewLine)
+	checkTag(msg, "host", "host1.example.com", t)
+	checkTag(msg, "program", "systemd[1]", t)
+	assert.NotEqual(t, 0, msg.GetTime().Year())
+	assert.False(t, msg.GetTime().After(time.Now().Add(24*time.Hour)))
+}
+
+func TestPatternLogAnalyzer_invalid(t *testing.T) {
+	_, err := NewLogAnalyzer(TypePattern, "a.log", nil)
+	assert.NotNil(t, err)
+	_, err = NewLogAnalyzer(TypePattern, "a.log", &PatternConfig{})
+	assert.NotNil(t, err)
+	_, err = NewLogAnalyzer(TypePattern, "a.log", &PatternConfig{Regex: `(?P<content>.*)`})
+	assert.NotNil(t, err)
+	_, err = NewLogAnalyzer(TypePattern, "a.log", &PatternConfig{Grok: `%{UNKNOWN:time}`})
+	assert.NotNil(t, err)
+	_, err = NewLogAnalyzer("unknown", "a.log", nil)
+	assert.NotNil(t, err)
+	_, err = NewLogAnalyzer(TypeObLight, "a.log", nil)
+	assert.Nil(t, err)
+}
+
+func TestPatternLogAnalyzer_GetFileEndTime(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+	fileName := filepath.Join(tmpDir, "app.log.20230501100000")
+	assert.Nil(t, ioutil.WriteFile(fileName, []byte{}, 0644))
+	info, err := os.Stat(fileName)
+	assert.Nil(t, err)
+
+	logAnalyzer, _ := NewPatternLogAnalyzer("app.log", &PatternConfig{Regex: `(?P<time>\S+ \S+)`, FileTimeLayout: "20060102150405"})
+	fileTime, _ := logAnalyzer.GetFileEndTime(info)
+	assert.Equal(t, time.Date(2023, 5, 1, 10, 0, 0, 0, time.Local), fileTime)
+
+	logAnalyzer, _ = NewPatternLogAnalyzer("app.log", &PatternConfig{Regex: `(?P<time>\S+ \S+)`})
+	fileTime, _ = logAnalyzer.GetFileEndTime(info)
+	assert.Equal(t, info.ModTime(), fileTime)
+}
@@ -202,6 +202,7 @@ func (c *ConfigManager) handleConfigEvent(event *configEvent, pipelineEventType
 	pipelines, err := CreatePipelines(event.pipelineModule)
 	if err != nil {
 		log.WithContext(event.ctx).WithError(err).Error("CreatePipelines failed")
+		GetPipelineManager().setModuleError(event.pipelineModule.Name, err)
 		callbackEvent.execStatus = configEventExecFailed
 		callbackEvent.description = "CreatePipelines failed"
 		return false
@@ -13,6 +13,7 @@
 package engine
 
 import (
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/oceanbase/obagent/config/monagent"
@@ -30,49 +31,51 @@ func CreatePipelines(pipelineModule *monagent.PipelineModule) ([]*Pipeline, erro
 
 		// set Source / Processor / Sink
 		inputNodes := pipelineNode.Structure.Inputs
-		sources := make([]plugins.Source, len(inputNodes))
-		for i, inputPluginNode := range inputNodes {
+		for _, inputPluginNode := range inputNodes {
 			source, err := plugins.GetInputManager().GetPlugin(inputPluginNode.Plugin, inputPluginNode.Config)
 			if err != nil {
 				log.WithError(err).Error("CreatePipelineV2s init source failed")
-				return nil, err
+				return nil, errors.Wrapf(err, "pipeline %s init input %s", pipelineNode.Name, inputPluginNode.Plugin)
 			}
-			sources[i] = source
+			pipelineInstance.AddSource(inputPluginNode.Plugin, source)
 		}
 
 		processorNodes := pipelineNode.Structure.Processors
-		processors := make([]plugins.Processor, len(processorNodes))
-		for i, processorPluginNode := range processorNodes {
+		for _, processorPluginNode := range processorNodes {
 			processor, err := plugins.GetProcessorManager().GetPlugin(processorPluginNode.Plugin, processorPluginNode.Config)
 			if err != nil {
 				log.WithError(err).Error("CreatePipelineV2s init processor failed")
-				return nil, err
+				return nil, errors.Wrapf(err, "pipeline %s init processor %s", pipelineNode.Name, processorPluginNode.Plugin)
 			}
-			processors[i] = processor
+			pipelineInstance.AddProcessor(processorPluginNode.Plugin, processor)
 		}
 
-		var sink plugins.Sink
-		outputNode := pipelineNode.Structure.Output
-		if outputNode != nil {
-			var err error
-			sink, err = plugins.GetOutputManager().GetPlugin(outputNode.Plugin, outputNode.Config)
+		outputNodes := pipelineNode.Structure.Outputs
+		if pipelineNode.Structure.Output != nil {
+			outputNodes = append([]*monagent.PluginNode{pipelineNode.Structure.Output}, outputNodes...)
+		}
+		for _, outputNode := range outputNodes {
+			sink, err := plugins.GetOutputManager().GetPlugin(outputNode.Plugin, outputNode.Config)
 			if err != nil {
 				log.WithError(err).Error("CreatePipelineV2s init sink failed")
-				return nil, err
+				return nil, errors.Wrapf(err, "pipeline %s init output %s", pipelineNode.Name, outputNode.Plugin)
 			}
+			pipelineInstance.AddSink(outputNode.Plugin, sink)
 		}
 
-		exporterNode := pipelineNode.Structure.Exporter
-		if exporterNode != nil {
-			var err error
-			sink, err = plugins.GetExporterManager().GetPlugin(exporterNode.Plugin, exporterNode.Config)
+		exporterNodes := pipelineNode.Structure.Exporters
+		if pipelineNode.Structure.Exporter != nil {
+			exporterNodes = append([]*monagent.PluginNode{pipelineNode.Structure.Exporter}, exporterNodes...)
+		}
+		for _, exporterNode := range exporterNodes {
+			sink, err := plugins.GetExporterManager().GetPlugin(exporterNode.Plugin, exporterNode.Config)
 			if err != nil {
 				log.WithError(err).Error("CreatePipelineV2s init sink failed")
-				return nil, err
+				return nil, errors.Wrapf(err, "pipeline %s init exporter %s", pipelineNode.Name, exporterNode.Plugin)
 			}
+			pipelineInstance.AddSink(exporterNode.Plugin, sink)
 		}
 
-		pipelineInstance.SetSource(sources).SetProcessor(processors).SetSink(sink)
 		pipelines = append(pipelines, pipelineInstance)
 	}
 	return pipelines, nil
@@ -0,0 +1,237 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package engine
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oceanbase/obagent/config/monagent"
+	"github.com/oceanbase/obagent/monitor/message"
+	"github.com/oceanbase/obagent/monitor/plugins"
+)
+
+const defaultDryRunTimeout = 30 * time.Second
+
+// DryRunResult messages produced by one collection cycle of a pipeline module
+type DryRunResult struct {
+	Module    string                `json:"module"`
+	Pipelines []*DryRunPipelineInfo `json:"pipelines"`
+}
+
+// DryRunPipelineInfo messages produced by one collection cycle of a pipeline
+type DryRunPipelineInfo struct {
+	Name     string           `json:"name"`
+	Errors   []string         `json:"errors,omitempty"`
+	Messages []*DryRunMessage `json:"messages"`
+}
+
+// DryRunMessage json friendly form of message.Message
+type DryRunMessage struct {
+	Name   string                 `json:"name"`
+	Type   message.Type           `json:"type"`
+	Time   time.Time              `json:"time"`
+	Tags   map[string]string      `json:"tags"`
+	Fields map[string]interface{} `json:"fields"`
+}
+
+// msgCollector is implemented by inputs that can collect once without starting
+type msgCollector interface {
+	CollectMsgs(ctx context.Context) ([]*message.Message, error)
+}
+
+func toDryRunMessage(msg *message.Message) *DryRunMessage {
+	ret := &DryRunMessage{
+		Name:   msg.GetName(),
+		Type:   msg.GetMetricType(),
+		Time:   msg.GetTime(),
+		Tags:   make(map[string]string, len(msg.Tags())),
+		Fields: make(map[string]interface{}, len(msg.Fields())),
+	}
+	for _, tag := range msg.Tags() {
+		ret.Tags[tag.Name] = tag.Value
+	}
+	for _, field := range msg.Fields() {
+		ret.Fields[field.Name] = field.Value
+	}
+	return ret
+}
+
+// DryRunPipelineModule instantiates inputs and processors of the pipeline module,
+// runs one collection cycle and returns the messages. Outputs, exporters and routes are not created.
+// Each input runs at most timeout, zero means the default 30s.
+func DryRunPipelineModule(ctx context.Context, module *monagent.PipelineModule, timeout time.Duration) (*DryRunResult, error) {
+	if timeout <= 0 {
+		timeout = defaultDryRunTimeout
+	}
+	result := &DryRunResult{
+		Module:    module.Name,
+		Pipelines: make([]*DryRunPipelineInfo, 0, len(module.Pipelines)),
+	}
+	for _, pipelineNode := range module.Pipelines {
+		if pipelineNode.Structure == nil {
+			return nil, errors.Errorf("pipeline %s has no structure", pipelineNode.Name)
+		}
+		info, err := dryRunPipeline(ctx, pipelineNode, timeout)
+		if err != nil {
+			return nil, err
+		}
+		result.Pipelines = append(result.Pipelines, info)
+	}
+	return result, nil
+}
+
+func dryRunPipeline(ctx context.Context, pipelineNode *monagent.PipelineNode, timeout time.Duration) (*DryRunPipelineInfo, error) {
+	info := &DryRunPipelineInfo{
+		Name:     pipelineNode.Name,
+		Messages: make([]*DryRunMessage, 0),
+	}
+	sources := make([]plugins.Source, 0, len(pipelineNode.Structure.Inputs))
+	processors := make([]plugins.Processor, 0, len(pipelineNode.Structure.Processors))
+	defer func() {
+		for _, processor := range processors {
+			processor.Stop()
+		}
+	}()
+	for _, inputNode := range pipelineNode.Structure.Inputs {
+		source, err := plugins.GetInputManager().GetPlugin(inputNode.Plugin, dryRunConfig(inputNode.Config))
+		if err != nil {
+			for _, s := range sources {
+				s.Stop()
+			}
+			return nil, errors.Wrapf(err, "pipeline %s init input %s", pipelineNode.Name, inputNode.Plugin)
+		}
+		sources = append(sources, source)
+	}
+	for _, processorNode := range pipelineNode.Structure.Processors {
+		processor, err := plugins.GetProcessorManager().GetPlugin(processorNode.Plugin, dryRunConfig(processorNode.Config))
+		if err != nil {
+			for _, s := range sources {
+				s.Stop()
+			}
+			return nil, errors.Wrapf(err, "pipeline %s init processor %s", pipelineNode.Name, processorNode.Plugin)
+		}
+		processors = append(processors, processor)
+	}
+
+	batches := make([][]*message.Message, len(sources))
+	errs := make([]error, len(sources))
+	wg := sync.WaitGroup{}
+	for i, source := range sources {
+		wg.Add(1)
+		go func(i int, source plugins.Source, plugin string) {
+			defer wg.Done()
+			batches[i], errs[i] = collectOnce(ctx, source, timeout)
+			if errs[i] != nil {
+				errs[i] = errors.Wrapf(errs[i], "input %s", plugin)
+			}
+		}(i, source, pipelineNode.Structure.Inputs[i].Plugin)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			info.Errors = append(info.Errors, err.Error())
+		}
+	}
+
+	msgs, err := runProcessorsOnce(processors, batches, timeout)
+	if err != nil {
+		info.Errors = append(info.Errors, errors.Wrapf(err, "pipeline %s", pipelineNode.Name).Error())
+	}
+	for _, msg := range msgs {
+		info.Messages = append(info.Messages, toDryRunMessage(msg))
+	}
+	return info, nil
+}
+
+// dryRunConfig the plugin config of the running module is not modified
+func dryRunConfig(conf *monagent.PluginConfig) *monagent.PluginConfig {
+	if conf == nil {
+		return &monagent.PluginConfig{DryRun: true}
+	}
+	ret := *conf
+	ret.DryRun = true
+	return &ret
+}
+
+// collectOnce returns the first batch of the source. Inputs able to collect directly are not started.
+func collectOnce(ctx context.Context, source plugins.Source, timeout time.Duration) ([]*message.Message, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if collector, ok := source.(msgCollector); ok {
+		defer source.Stop()
+		return collector.CollectMsgs(timeoutCtx)
+	}
+
+	out := make(chan []*message.Message, 1)
+	if err := source.Start(out); err != nil {
+		source.Stop()
+		return nil, err
+	}
+	defer func() {
+		source.Stop()
+		// a source may be sending when stopped, keep draining for a while to not block it
+		go func() {
+			deadline := time.After(timeout)
+			for {
+				select {
+				case <-out:
+				case <-deadline:
+					return
+				}
+			}
+		}()
+	}()
+	select {
+	case msgs := <-out:
+		return msgs, nil
+	case <-timeoutCtx.Done():
+		log.Warnf("dry run wait for source %T timeout", source)
+		return nil, errors.Errorf("no message collected in %s", timeout)
+	}
+}
+
+// runProcessorsOnce pushes the batches through processors in order, and returns all the output messages.
+func runProcessorsOnce(processors []plugins.Processor, batches [][]*message.Message, timeout time.Duration) ([]*message.Message, error) {
+	in := make(chan []*message.Message, len(batches))
+	for _, batch := range batches {
+		if len(batch) > 0 {
+			in <- batch
+		}
+	}
+	close(in)
+
+	p := &Pipeline{}
+	out, err := p.serialize(in, convertProcessorsToPipeFunc(processors))
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]*message.Message, 0)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case msgs, ok := <-out:
+			if !ok {
+				return ret, nil
+			}
+			ret = append(ret, msgs...)
+		case <-timer.C:
+			return ret, errors.Errorf("processors not finished in %s", timeout)
+		}
+	}
+}
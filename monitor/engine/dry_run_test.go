@@ -0,0 +1,142 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package engine
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+
+	"github.com/oceanbase/obagent/config/monagent"
+	"github.com/oceanbase/obagent/monitor/message"
+	"github.com/oceanbase/obagent/monitor/plugins"
+)
+
+type collectOnlySource struct{}
+
+func (s *collectOnlySource) Start(out chan<- []*message.Message) error {
+	panic("should not be started")
+}
+func (s *collectOnlySource) Stop() {}
+func (s *collectOnlySource) CollectMsgs(ctx context.Context) ([]*message.Message, error) {
+	return []*message.Message{
+		message.NewMessage("collect_1", message.Gauge, time.Now()).AddField("value", 1.0),
+		message.NewMessage("collect_2", message.Gauge, time.Now()).AddField("value", 2.0),
+	}, nil
+}
+
+type silentSource struct{}
+
+func (s *silentSource) Start(out chan<- []*message.Message) error { return nil }
+func (s *silentSource) Stop()                                     {}
+
+var dryRunSinkStarted int32
+
+type startFlagSink struct{}
+
+func (s *startFlagSink) Start(in <-chan []*message.Message) error {
+	atomic.StoreInt32(&dryRunSinkStarted, 1)
+	return nil
+}
+func (s *startFlagSink) Stop() {}
+
+func init() {
+	plugins.GetInputManager().Register("dryRunCollectInput", func(conf *monagent.PluginConfig) (plugins.Source, error) {
+		return &collectOnlySource{}, nil
+	})
+	plugins.GetInputManager().Register("dryRunStartInput", func(conf *monagent.PluginConfig) (plugins.Source, error) {
+		return &mockSource1{}, nil
+	})
+	plugins.GetInputManager().Register("dryRunSilentInput", func(conf *monagent.PluginConfig) (plugins.Source, error) {
+		return &silentSource{}, nil
+	})
+	plugins.GetProcessorManager().Register("dryRunProcessor", func(conf *monagent.PluginConfig) (plugins.Processor, error) {
+		return &mockProcessor1{}, nil
+	})
+	plugins.GetOutputManager().Register("dryRunOutput", func(conf *monagent.PluginConfig) (plugins.Sink, error) {
+		return &startFlagSink{}, nil
+	})
+}
+
+const dryRunModule = `
+name: dryRunTest
+status: active
+pipelines:
+  - name: pipeline1
+    config:
+      scheduleStrategy: bySource
+    structure:
+      inputs:
+        - plugin: dryRunCollectInput
+          config: {}
+        - plugin: dryRunStartInput
+          config: {}
+        - plugin: dryRunSilentInput
+          config: {}
+      processors:
+        - plugin: dryRunProcessor
+          config: {}
+      output:
+        plugin: dryRunOutput
+        config: {}
+`
+
+func TestDryRunPipelineModule(t *testing.T) {
+	module := &monagent.PipelineModule{}
+	assert.Nil(t, yaml.Unmarshal([]byte(dryRunModule), module))
+
+	result, err := DryRunPipelineModule(context.Background(), module, 200*time.Millisecond)
+	assert.Nil(t, err)
+	assert.Equal(t, "dryRunTest", result.Module)
+	assert.Equal(t, 1, len(result.Pipelines))
+
+	pipeline := result.Pipelines[0]
+	assert.Equal(t, 4, len(pipeline.Messages))
+	names := make(map[string]bool)
+	for _, msg := range pipeline.Messages {
+		names[msg.Name] = true
+	}
+	assert.True(t, names["collect_1"])
+	assert.True(t, names["test1_2"])
+	assert.Equal(t, "testValue", pipeline.Messages[0].Tags["testKey"])
+	// silent input times out
+	assert.Equal(t, 1, len(pipeline.Errors))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&dryRunSinkStarted))
+}
+
+func TestDryRunPipelineModule_unknownPlugin(t *testing.T) {
+	module := &monagent.PipelineModule{
+		Name: "dryRunTest",
+		Pipelines: []*monagent.PipelineNode{{
+			Name: "pipeline1",
+			Structure: &monagent.PipelineStructure{
+				Inputs: []*monagent.PluginNode{{Plugin: "notExistInput", Config: &monagent.PluginConfig{}}},
+			},
+		}},
+	}
+	_, err := DryRunPipelineModule(context.Background(), module, time.Second)
+	assert.NotNil(t, err)
+}
+
+func TestDryRunConfig(t *testing.T) {
+	conf := &monagent.PluginConfig{PluginInnerConfig: map[string]interface{}{"k": "v"}}
+	dryRun := dryRunConfig(conf)
+	assert.True(t, dryRun.DryRun)
+	assert.Equal(t, "v", dryRun.PluginInnerConfig["k"])
+	assert.False(t, conf.DryRun)
+	assert.True(t, dryRunConfig(nil).DryRun)
+}
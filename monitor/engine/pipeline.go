@@ -14,23 +14,43 @@ package engine
 
 import (
 	"context"
+	"fmt"
 	"github.com/oceanbase/obagent/monitor/plugins"
 	"sync"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/oceanbase/obagent/config/monagent"
 	"github.com/oceanbase/obagent/errors"
 	"github.com/oceanbase/obagent/monitor/message"
+	"github.com/oceanbase/obagent/stat"
 )
 
 type Pipeline struct {
-	Name           string
-	Config         *monagent.PipelineConfig
-	sources        []plugins.Source
-	processors     []plugins.Processor
-	sink           plugins.Sink
-	sourceChannels []chan []*message.Message
+	Name            string
+	Config          *monagent.PipelineConfig
+	sources         []plugins.Source
+	processors      []plugins.Processor
+	sinks           []*pipelineSink
+	sourceChannels  []chan []*message.Message
+	sourceStages    []*stageStatus
+	processorStages []*stageStatus
+
+	stateLock sync.Mutex
+	state     PipelineState
+	lastError string
+	startAt   time.Time
+}
+
+// pipelineSink a sink of pipeline, when there are more than one sinks,
+// each sink consumes from its own buffer so that a slow sink will not block the others.
+type pipelineSink struct {
+	name   string
+	sink   plugins.Sink
+	buffer chan []*message.Message
+	stage  *stageStatus
 }
 
 const chanBufferSize = 500
@@ -39,69 +59,169 @@ func NewPipeline(name string, conf *monagent.PipelineConfig) *Pipeline {
 	return &Pipeline{
 		Name:   name,
 		Config: conf,
+		state:  PipelineCreated,
 	}
 }
 
 func (p *Pipeline) SetSource(sources []plugins.Source) *Pipeline {
-	p.sources = sources
+	p.sources = nil
+	p.sourceStages = nil
+	for _, source := range sources {
+		p.AddSource(fmt.Sprintf("%T", source), source)
+	}
+	return p
+}
+
+// AddSource add a source to pipeline, name is the plugin name used in runtime information
+func (p *Pipeline) AddSource(name string, source plugins.Source) *Pipeline {
+	p.sources = append(p.sources, source)
+	p.sourceStages = append(p.sourceStages, newStageStatus(name))
 	return p
 }
 
 func (p *Pipeline) SetProcessor(processors []plugins.Processor) *Pipeline {
-	p.processors = processors
+	p.processors = nil
+	p.processorStages = nil
+	for _, processor := range processors {
+		p.AddProcessor(fmt.Sprintf("%T", processor), processor)
+	}
+	return p
+}
+
+// AddProcessor append a processor to pipeline, name is the plugin name used in runtime information
+func (p *Pipeline) AddProcessor(name string, processor plugins.Processor) *Pipeline {
+	p.processors = append(p.processors, processor)
+	p.processorStages = append(p.processorStages, newStageStatus(name))
 	return p
 }
 
 func (p *Pipeline) SetSink(sink plugins.Sink) *Pipeline {
-	p.sink = sink
+	p.sinks = nil
+	if sink != nil {
+		p.AddSink(fmt.Sprintf("%T", sink), sink)
+	}
 	return p
 }
 
+// AddSink add a sink to pipeline, every processed batch is sent to all sinks
+func (p *Pipeline) AddSink(name string, sink plugins.Sink) *Pipeline {
+	for _, s := range p.sinks {
+		if s.name == name {
+			name = fmt.Sprintf("%s#%d", name, len(p.sinks))
+			break
+		}
+	}
+	p.sinks = append(p.sinks, &pipelineSink{name: name, sink: sink, stage: newStageStatus(name)})
+	return p
+}
+
+func (p *Pipeline) sinkBufferSize() int {
+	if p.Config == nil || p.Config.SinkBufferSize <= 0 {
+		return chanBufferSize
+	}
+	return p.Config.SinkBufferSize
+}
+
 func (p *Pipeline) Start(ctx context.Context) (err error) {
 	defer func() {
 		if err != nil {
 			log.WithError(err).Errorf("start pipeline failed, pipeline: %s", p.Name)
 			p.Stop()
+			p.setState(PipelineFailed, err)
+		} else {
+			p.setState(PipelineRunning, nil)
 		}
 	}()
 	ctxLog := log.WithContext(ctx)
-	if len(p.sources) == 0 || p.sink == nil {
+	if len(p.sources) == 0 || len(p.sinks) == 0 {
 		err = errors.New("invalid sources / sink")
 		ctxLog.WithFields(log.Fields{
 			"sources": p.sources,
-			"sink":    p.sink,
+			"sinks":   p.sinks,
 		}).WithError(err).Error()
 		return
 	}
 	p.sourceChannels = make([]chan []*message.Message, len(p.sources))
 	for i, source := range p.sources {
 		p.sourceChannels[i] = make(chan []*message.Message)
-		go func(src plugins.Source, c chan []*message.Message) {
+		go func(src plugins.Source, c chan []*message.Message, stage *stageStatus) {
 			err1 := src.Start(c)
 			if err1 != nil {
 				ctxLog.WithError(err1).Error("start source failed")
+				stage.setError(err1)
 			}
-		}(source, p.sourceChannels[i])
+		}(source, p.sourceChannels[i], p.sourceStages[i])
 	}
 
 	convergedChan := p.converge(p.sourceChannels)
-	sinkChannel, err := p.serialize(convergedChan, convertProcessorsToPipeFunc(p.processors))
+	pipeFuncs := convertProcessorsToPipeFunc(p.processors)
+	for i := range pipeFuncs {
+		pipeFuncs[i] = countingPipeFunc(pipeFuncs[i], p.processorStages[i])
+	}
+	sinkChannel, err := p.serialize(convergedChan, pipeFuncs)
 	if err != nil {
 		ctxLog.WithError(err).Error("executing processors failed")
 		return err
 	}
 
-	go func() {
-		err = p.sink.Start(sinkChannel)
-		if err != nil {
-			ctxLog.WithError(err).Error("pipeline start sink failed")
-			return
-		}
-	}()
+	for _, s := range p.sinks {
+		s.buffer = make(chan []*message.Message, p.sinkBufferSize())
+		go p.startSink(ctx, s, s.buffer)
+	}
+	go p.fanOut(sinkChannel)
 
 	return nil
 }
 
+func (p *Pipeline) startSink(ctx context.Context, s *pipelineSink, in <-chan []*message.Message) {
+	err := s.sink.Start(in)
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Errorf("pipeline %s start sink failed", p.Name)
+		s.stage.setError(err)
+	}
+}
+
+// fanOut sends each batch to the buffer of every sink.
+// With a single sink, it blocks until the sink receives the batch.
+// With multiple sinks, when the buffer of a sink is full, the batch is dropped for that sink only,
+// and sinks other than the first one receive a copy, so they can not affect each other.
+func (p *Pipeline) fanOut(in <-chan []*message.Message) {
+	defer func() {
+		for _, s := range p.sinks {
+			close(s.buffer)
+		}
+	}()
+	for msgs := range in {
+		if len(p.sinks) == 1 {
+			p.sinks[0].buffer <- msgs
+			p.sinks[0].stage.add(len(msgs))
+			continue
+		}
+		// copies are made before any sink receives the batch, which may modify the messages
+		batches := make([][]*message.Message, len(p.sinks))
+		batches[0] = msgs
+		for i := 1; i < len(p.sinks); i++ {
+			batches[i] = make([]*message.Message, len(msgs))
+			for j, msg := range msgs {
+				batches[i][j] = msg.Clone()
+			}
+		}
+		for i, s := range p.sinks {
+			batch := batches[i]
+			labels := prometheus.Labels{stat.PipelineNameKey: p.Name, stat.PluginNameKey: s.name}
+			select {
+			case s.buffer <- batch:
+				s.stage.add(len(batch))
+			default:
+				log.Warnf("pipeline %s sink %s buffer is full, drop %d messages", p.Name, s.name, len(batch))
+				stat.MonAgentPipelineSinkDropTotal.With(labels).Add(float64(len(batch)))
+				s.stage.drop(len(batch))
+			}
+			stat.MonAgentPipelineBufferMetrics.With(labels).Set(float64(len(s.buffer)))
+		}
+	}
+}
+
 func (p *Pipeline) Stop() {
 	for _, source := range p.sources {
 		source.Stop()
@@ -110,7 +230,10 @@ func (p *Pipeline) Stop() {
 	for _, processor := range p.processors {
 		processor.Stop()
 	}
-	p.sink.Stop()
+	for _, s := range p.sinks {
+		s.sink.Stop()
+	}
+	p.setState(PipelineStopped, nil)
 }
 
 // converge Data streams used to converge multiple sources
@@ -119,13 +242,20 @@ func (p *Pipeline) converge(inputs []chan []*message.Message) <-chan []*message.
 	wg.Add(len(inputs))
 	out := make(chan []*message.Message)
 
-	for _, c := range inputs {
-		go func(c <-chan []*message.Message) {
+	for i, c := range inputs {
+		var stage *stageStatus
+		if i < len(p.sourceStages) {
+			stage = p.sourceStages[i]
+		}
+		go func(c <-chan []*message.Message, stage *stageStatus) {
 			defer wg.Done()
 			for msgBatch := range c {
+				if stage != nil {
+					stage.add(len(msgBatch))
+				}
 				out <- msgBatch
 			}
-		}(c)
+		}(c, stage)
 	}
 	go func() {
 		wg.Wait()
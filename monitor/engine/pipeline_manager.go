@@ -31,6 +31,7 @@ type PipelineManager struct {
 	lock sync.Mutex
 	//pipelinesMap      map[string][]*PipelineInstance
 	pipelinesMap      map[string][]*Pipeline
+	moduleErrors      map[string]string
 	pipelineEventChan chan *pipelineEvent
 	eventTaskPool     *goroutinepool.GoroutinePool
 }
@@ -75,6 +76,7 @@ func GetPipelineManager() *PipelineManager {
 		}
 		pipelineMgr = &PipelineManager{
 			pipelinesMap:      make(map[string][]*Pipeline, 16),
+			moduleErrors:      make(map[string]string),
 			pipelineEventChan: make(chan *pipelineEvent, 16),
 			eventTaskPool:     eventTaskPool,
 		}
@@ -196,6 +198,12 @@ func (p *PipelineManager) handleEvent(event *pipelineEvent) {
 
 	}
 
+	if callbackEvent.execStatus == pipelineEventExecFailed {
+		p.setModuleError(event.name, errors.New(callbackEvent.description))
+	} else {
+		p.setModuleError(event.name, nil)
+	}
+
 	logger.Infof("pipeline event handle completed")
 	event.callbackChan <- callbackEvent
 }
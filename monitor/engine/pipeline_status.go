@@ -0,0 +1,227 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package engine
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oceanbase/obagent/monitor/message"
+	"github.com/oceanbase/obagent/monitor/plugins"
+)
+
+type PipelineState string
+
+const (
+	PipelineCreated PipelineState = "created"
+	PipelineRunning PipelineState = "running"
+	PipelineFailed  PipelineState = "failed"
+	PipelineStopped PipelineState = "stopped"
+)
+
+// PipelineModuleInfo runtime information of a pipeline module
+type PipelineModuleInfo struct {
+	Module    string          `json:"module"`
+	LastError string          `json:"lastError,omitempty"`
+	Pipelines []*PipelineInfo `json:"pipelines"`
+}
+
+// PipelineInfo runtime information of a pipeline
+type PipelineInfo struct {
+	Name            string        `json:"name"`
+	State           PipelineState `json:"state"`
+	LastError       string        `json:"lastError,omitempty"`
+	StartAt         time.Time     `json:"startAt"`
+	LastCollectTime time.Time     `json:"lastCollectTime"`
+	Inputs          []*StageInfo  `json:"inputs"`
+	Processors      []*StageInfo  `json:"processors"`
+	Sinks           []*StageInfo  `json:"sinks"`
+}
+
+// StageInfo runtime information of a plugin in pipeline
+type StageInfo struct {
+	Plugin       string    `json:"plugin"`
+	MessageCount int64     `json:"messageCount"`
+	DropCount    int64     `json:"dropCount"`
+	LastTime     time.Time `json:"lastTime"`
+	LastError    string    `json:"lastError,omitempty"`
+}
+
+// stageStatus counts the messages passed through a plugin
+type stageStatus struct {
+	plugin       string
+	messageCount int64
+	dropCount    int64
+	lastTime     int64
+
+	lock      sync.Mutex
+	lastError string
+}
+
+func newStageStatus(plugin string) *stageStatus {
+	return &stageStatus{plugin: plugin}
+}
+
+func (s *stageStatus) add(count int) {
+	atomic.AddInt64(&s.messageCount, int64(count))
+	atomic.StoreInt64(&s.lastTime, time.Now().UnixNano())
+}
+
+func (s *stageStatus) drop(count int) {
+	atomic.AddInt64(&s.dropCount, int64(count))
+}
+
+func (s *stageStatus) setError(err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err == nil {
+		s.lastError = ""
+	} else {
+		s.lastError = err.Error()
+	}
+}
+
+func (s *stageStatus) lastTimeValue() time.Time {
+	nano := atomic.LoadInt64(&s.lastTime)
+	if nano == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nano)
+}
+
+func (s *stageStatus) info() *StageInfo {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return &StageInfo{
+		Plugin:       s.plugin,
+		MessageCount: atomic.LoadInt64(&s.messageCount),
+		DropCount:    atomic.LoadInt64(&s.dropCount),
+		LastTime:     s.lastTimeValue(),
+		LastError:    s.lastError,
+	}
+}
+
+// countingPipeFunc wraps a processor to count the messages it outputs.
+func countingPipeFunc(f plugins.PipeFunc, stage *stageStatus) plugins.PipeFunc {
+	return func(in <-chan []*message.Message, out chan<- []*message.Message) error {
+		mid := make(chan []*message.Message)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for msgs := range mid {
+				stage.add(len(msgs))
+				out <- msgs
+			}
+		}()
+		err := f(in, mid)
+		stage.setError(err)
+		close(mid)
+		<-done
+		return err
+	}
+}
+
+func stageInfos(stages []*stageStatus) []*StageInfo {
+	ret := make([]*StageInfo, len(stages))
+	for i, stage := range stages {
+		ret[i] = stage.info()
+	}
+	return ret
+}
+
+// Info returns the runtime information of pipeline
+func (p *Pipeline) Info() *PipelineInfo {
+	p.stateLock.Lock()
+	info := &PipelineInfo{
+		Name:      p.Name,
+		State:     p.state,
+		LastError: p.lastError,
+		StartAt:   p.startAt,
+	}
+	p.stateLock.Unlock()
+
+	info.Inputs = stageInfos(p.sourceStages)
+	info.Processors = stageInfos(p.processorStages)
+	sinkStages := make([]*stageStatus, len(p.sinks))
+	for i, s := range p.sinks {
+		sinkStages[i] = s.stage
+	}
+	info.Sinks = stageInfos(sinkStages)
+	for _, input := range info.Inputs {
+		if input.LastTime.After(info.LastCollectTime) {
+			info.LastCollectTime = input.LastTime
+		}
+	}
+	return info
+}
+
+func (p *Pipeline) setState(state PipelineState, err error) {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+	p.state = state
+	if state == PipelineRunning {
+		p.startAt = time.Now()
+	}
+	if err != nil {
+		p.lastError = err.Error()
+	}
+}
+
+// ModuleInfos returns the runtime information of all pipeline modules, sorted by module name
+func (p *PipelineManager) ModuleInfos() []*PipelineModuleInfo {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	modules := make(map[string]*PipelineModuleInfo)
+	for name, pipelines := range p.pipelinesMap {
+		moduleInfo := &PipelineModuleInfo{
+			Module:    name,
+			Pipelines: make([]*PipelineInfo, 0, len(pipelines)),
+		}
+		for _, pipeline := range pipelines {
+			moduleInfo.Pipelines = append(moduleInfo.Pipelines, pipeline.Info())
+		}
+		modules[name] = moduleInfo
+	}
+	for name, err := range p.moduleErrors {
+		moduleInfo, ok := modules[name]
+		if !ok {
+			moduleInfo = &PipelineModuleInfo{
+				Module:    name,
+				Pipelines: make([]*PipelineInfo, 0),
+			}
+			modules[name] = moduleInfo
+		}
+		moduleInfo.LastError = err
+	}
+	ret := make([]*PipelineModuleInfo, 0, len(modules))
+	for _, moduleInfo := range modules {
+		ret = append(ret, moduleInfo)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Module < ret[j].Module
+	})
+	return ret
+}
+
+// setModuleError records the error when a module fails to create or start pipelines, nil clears it
+func (p *PipelineManager) setModuleError(name string, err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if err == nil {
+		delete(p.moduleErrors, name)
+		return
+	}
+	p.moduleErrors[name] = err.Error()
+}
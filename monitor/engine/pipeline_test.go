@@ -17,11 +17,13 @@ import (
 	"fmt"
 	"github.com/oceanbase/obagent/monitor/plugins"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
 
+	"github.com/oceanbase/obagent/config/monagent"
 	"github.com/oceanbase/obagent/monitor/message"
 )
 
@@ -240,3 +242,151 @@ func TestPipeline_Start(t *testing.T) {
 		})
 	}
 }
+
+type blockedSink struct {
+	release chan struct{}
+}
+
+func (s *blockedSink) Start(in <-chan []*message.Message) error {
+	<-s.release
+	for range in {
+	}
+	return nil
+}
+func (s *blockedSink) Stop() {}
+
+type countSink struct {
+	count int32
+}
+
+func (s *countSink) Start(in <-chan []*message.Message) error {
+	for messages := range in {
+		atomic.AddInt32(&s.count, int32(len(messages)))
+	}
+	return nil
+}
+func (s *countSink) Stop() {}
+
+// tagSink modifies the received messages like processors do
+type tagSink struct {
+	mutex    sync.Mutex
+	received []*message.Message
+}
+
+func (s *tagSink) Start(in <-chan []*message.Message) error {
+	for messages := range in {
+		for _, msg := range messages {
+			msg.AddTag("sink", "tag")
+		}
+		s.mutex.Lock()
+		s.received = append(s.received, messages...)
+		s.mutex.Unlock()
+	}
+	return nil
+}
+func (s *tagSink) Stop() {}
+
+func TestPipeline_fanOut(t *testing.T) {
+	Convey("慢 sink 不阻塞其他 sink", t, func() {
+		blocked := &blockedSink{release: make(chan struct{})}
+		counter := &countSink{}
+		p := NewPipeline("test_fan_out", &monagent.PipelineConfig{SinkBufferSize: 2}).
+			AddSink("blocked", blocked).
+			AddSink("counter", counter)
+		for _, s := range p.sinks {
+			s.buffer = make(chan []*message.Message, p.sinkBufferSize())
+		}
+		go blocked.Start(p.sinks[0].buffer)
+		go counter.Start(p.sinks[1].buffer)
+
+		in := make(chan []*message.Message)
+		done := make(chan struct{})
+		go func() {
+			p.fanOut(in)
+			close(done)
+		}()
+		for i := 0; i < 10; i++ {
+			in <- []*message.Message{message.NewMessage("test", message.Gauge, time.Now())}
+			time.Sleep(10 * time.Millisecond)
+		}
+		close(in)
+		<-done
+		close(blocked.release)
+		time.Sleep(100 * time.Millisecond)
+		So(atomic.LoadInt32(&counter.count), ShouldEqual, 10)
+	})
+
+	Convey("sink 修改消息不影响其他 sink 的副本", t, func() {
+		first := &tagSink{}
+		second := &tagSink{}
+		p := NewPipeline("test_fan_out_copy", nil).
+			AddSink("first", first).
+			AddSink("second", second)
+		for _, s := range p.sinks {
+			s.buffer = make(chan []*message.Message, p.sinkBufferSize())
+		}
+		wg := sync.WaitGroup{}
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			first.Start(p.sinks[0].buffer)
+		}()
+		in := make(chan []*message.Message)
+		go p.fanOut(in)
+		var sent []*message.Message
+		for i := 0; i < 100; i++ {
+			msg := message.NewMessage("test", message.Gauge, time.Now()).AddTag("index", fmt.Sprint(i))
+			sent = append(sent, msg)
+			in <- []*message.Message{msg}
+		}
+		close(in)
+		go func() {
+			defer wg.Done()
+			second.Start(p.sinks[1].buffer)
+		}()
+		wg.Wait()
+		So(len(second.received), ShouldEqual, 100)
+		for i, msg := range second.received {
+			So(msg, ShouldNotEqual, sent[i])
+			So(len(msg.Tags()), ShouldEqual, 2)
+		}
+	})
+}
+
+func TestPipeline_Info(t *testing.T) {
+	Convey("pipeline 运行时信息", t, func() {
+		counter := &countSink{}
+		p := NewPipeline("test_info", nil).
+			AddSource("mockSource1", &mockSource1{}).
+			AddSource("mockSource2", &mockSource2{}).
+			AddProcessor("mockProcessor1", &mockProcessor1{}).
+			AddSink("countSink", counter)
+		So(p.Info().State, ShouldEqual, PipelineCreated)
+
+		err := p.Start(context.Background())
+		So(err, ShouldBeNil)
+		for i := 0; i < 50 && atomic.LoadInt32(&counter.count) < 4; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		info := p.Info()
+		So(info.State, ShouldEqual, PipelineRunning)
+		So(len(info.Inputs), ShouldEqual, 2)
+		So(info.Inputs[0].Plugin, ShouldEqual, "mockSource1")
+		So(info.Inputs[0].MessageCount, ShouldEqual, 2)
+		So(info.Processors[0].MessageCount, ShouldEqual, 4)
+		So(info.Sinks[0].MessageCount, ShouldEqual, 4)
+		So(info.LastCollectTime.IsZero(), ShouldBeFalse)
+
+		p.Stop()
+		So(p.Info().State, ShouldEqual, PipelineStopped)
+	})
+
+	Convey("pipeline 启动失败", t, func() {
+		p := NewPipeline("test_failed", nil).AddSink("countSink", &countSink{})
+		err := p.Start(context.Background())
+		So(err, ShouldNotBeNil)
+		info := p.Info()
+		So(info.State, ShouldEqual, PipelineFailed)
+		So(info.LastError, ShouldNotBeEmpty)
+	})
+}
@@ -0,0 +1,52 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package message
+
+import "fmt"
+
+// CumulativeHistogram counts observed values by bucket upper bounds, it is not goroutine safe.
+// Fields are named as the ones parsed from prometheus, so CreateMetricFamily exports them as a histogram.
+type CumulativeHistogram struct {
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+func NewCumulativeHistogram(buckets []float64) *CumulativeHistogram {
+	return &CumulativeHistogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+func (h *CumulativeHistogram) Observe(v float64) {
+	for i, upperBound := range h.buckets {
+		if v <= upperBound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// Fields bucket counts named by the upper bounds, then count and sum
+func (h *CumulativeHistogram) Fields() []FieldEntry {
+	fields := make([]FieldEntry, 0, len(h.buckets)+2)
+	for i, upperBound := range h.buckets {
+		fields = append(fields, FieldEntry{Name: fmt.Sprint(upperBound), Value: float64(h.counts[i])})
+	}
+	fields = append(fields, FieldEntry{Name: "count", Value: float64(h.count)})
+	fields = append(fields, FieldEntry{Name: "sum", Value: h.sum})
+	return fields
+}
@@ -0,0 +1,35 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package message
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCumulativeHistogram(t *testing.T) {
+	h := NewCumulativeHistogram([]float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(2)
+
+	msg := NewMessageWithTagsFields("test_duration", Histogram, time.Now(), nil, h.Fields())
+	mfs := CreateMetricFamily([]*Message{msg})
+	require.Equal(t, 1, len(mfs["test_duration"].Samples))
+	sample := mfs["test_duration"].Samples[0]
+	require.Equal(t, map[float64]uint64{0.1: 1, 1: 2}, sample.HistogramValue)
+	require.Equal(t, uint64(3), sample.Count)
+	require.Equal(t, 2.55, sample.Sum)
+}
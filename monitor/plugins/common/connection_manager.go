@@ -0,0 +1,263 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package common
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// TenantPlaceholder is replaced by the tenant name in the url of tenant connection,
+// e.g. monitor@{tenant}:password@tcp(127.0.0.1:2881)/oceanbase
+const TenantPlaceholder = "{tenant}"
+
+const (
+	selectUserTenants              = "select tenant_id, tenant_name from __all_tenant where tenant_id != 1"
+	selectUserTenantsForObVersion4 = "select tenant_id, tenant_name from DBA_OB_TENANTS where tenant_type = 'USER'"
+)
+
+const (
+	minTenantRetryInterval = 30 * time.Second
+	maxTenantRetryInterval = 10 * time.Minute
+)
+
+// TenantConnection db pool connected to a tenant
+type TenantConnection struct {
+	TenantId   int64
+	TenantName string
+	Db         *sql.DB
+}
+
+// connectFailure the tenant is not connected again until retryAt, the interval doubles on each failure
+type connectFailure struct {
+	retryAt  time.Time
+	interval time.Duration
+}
+
+// ConnectionManager manages the connections of a plugin: the default connection, usually the sys tenant,
+// named connections, and connections to the user tenants on the observer, which are discovered from
+// ObserverMetaInfo.AllTenantIds and connected with the tenant connection template.
+// All the db pools are shared among plugins, see AcquireDb.
+type ConnectionManager struct {
+	defaultConfig  *DbConnectionConfig
+	namedConfigs   map[string]*DbConnectionConfig
+	tenantTemplate *DbConnectionConfig
+
+	lock        sync.Mutex
+	named       map[string]*sql.DB
+	tenantNames map[int64]string
+	tenants     map[int64]*TenantConnection
+	tenantConfs map[int64]*DbConnectionConfig
+	failures    map[int64]*connectFailure
+}
+
+func NewConnectionManager(defaultConfig *DbConnectionConfig, namedConfigs map[string]*DbConnectionConfig, tenantTemplate *DbConnectionConfig) *ConnectionManager {
+	return &ConnectionManager{
+		defaultConfig:  defaultConfig,
+		namedConfigs:   namedConfigs,
+		tenantTemplate: tenantTemplate,
+		named:          make(map[string]*sql.DB),
+		tenantNames:    make(map[int64]string),
+		tenants:        make(map[int64]*TenantConnection),
+		tenantConfs:    make(map[int64]*DbConnectionConfig),
+		failures:       make(map[int64]*connectFailure),
+	}
+}
+
+// Init connects the default and named connections
+func (m *ConnectionManager) Init() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.defaultConfig != nil {
+		db, err := AcquireDb(m.defaultConfig)
+		if err != nil {
+			return err
+		}
+		m.named[""] = db
+	}
+	for name, config := range m.namedConfigs {
+		db, err := AcquireDb(config)
+		if err != nil {
+			m.closeLocked()
+			return errors.Wrapf(err, "connect %s", name)
+		}
+		m.named[name] = db
+	}
+	return nil
+}
+
+// Db returns the named connection, an empty name means the default connection
+func (m *ConnectionManager) Db(name string) (*sql.DB, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	db, ok := m.named[name]
+	if !ok {
+		return nil, errors.Errorf("connection %s not found", name)
+	}
+	return db, nil
+}
+
+// TenantConnections returns connections to the user tenants on the observer, ordered by tenant id.
+// Tenants failed to connect are skipped and retried with backoff, connections of removed tenants are released.
+func (m *ConnectionManager) TenantConnections(ctx context.Context, ob *Observer) ([]*TenantConnection, error) {
+	if m.tenantTemplate == nil {
+		return nil, errors.New("tenant connection not configured")
+	}
+	if ob == nil || ob.MetaInfo == nil {
+		return nil, errors.New("observer not initialized")
+	}
+	tenantIds := ob.MetaInfo.AllTenantIds
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, tenantId := range tenantIds {
+		if _, ok := m.tenantNames[tenantId]; !ok {
+			if err := m.refreshTenantNames(ctx, ob); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	for _, tenantId := range tenantIds {
+		if _, ok := m.tenantNames[tenantId]; !ok {
+			// not a user tenant, do not query again
+			m.tenantNames[tenantId] = ""
+		}
+	}
+
+	now := time.Now()
+	alive := make(map[int64]bool, len(tenantIds))
+	for _, tenantId := range tenantIds {
+		name := m.tenantNames[tenantId]
+		if name == "" {
+			// sys and meta tenants
+			continue
+		}
+		alive[tenantId] = true
+		if _, ok := m.tenants[tenantId]; ok {
+			continue
+		}
+		if failure, ok := m.failures[tenantId]; ok && now.Before(failure.retryAt) {
+			continue
+		}
+		config := &DbConnectionConfig{
+			Url:     strings.ReplaceAll(m.tenantTemplate.Url, TenantPlaceholder, name),
+			MaxOpen: m.tenantTemplate.MaxOpen,
+			MaxIdle: m.tenantTemplate.MaxIdle,
+		}
+		db, err := AcquireDb(config)
+		if err != nil {
+			interval := m.markFailed(tenantId, now)
+			log.WithContext(ctx).Warnf("connect tenant %s failed, retry after %s, reason: %s", name, interval, err)
+			continue
+		}
+		delete(m.failures, tenantId)
+		m.tenants[tenantId] = &TenantConnection{TenantId: tenantId, TenantName: name, Db: db}
+		m.tenantConfs[tenantId] = config
+	}
+	for tenantId := range m.tenants {
+		if !alive[tenantId] {
+			m.releaseTenant(tenantId)
+		}
+	}
+	for tenantId := range m.failures {
+		if !alive[tenantId] {
+			delete(m.failures, tenantId)
+		}
+	}
+
+	ret := make([]*TenantConnection, 0, len(m.tenants))
+	for _, conn := range m.tenants {
+		ret = append(ret, conn)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].TenantId < ret[j].TenantId
+	})
+	return ret, nil
+}
+
+func (m *ConnectionManager) markFailed(tenantId int64, now time.Time) time.Duration {
+	interval := minTenantRetryInterval
+	if failure, ok := m.failures[tenantId]; ok {
+		interval = failure.interval * 2
+		if interval > maxTenantRetryInterval {
+			interval = maxTenantRetryInterval
+		}
+	}
+	m.failures[tenantId] = &connectFailure{retryAt: now.Add(interval), interval: interval}
+	return interval
+}
+
+func (m *ConnectionManager) refreshTenantNames(ctx context.Context, ob *Observer) error {
+	query := selectUserTenants
+	compareResult, err := CompareVersion(ob.MetaInfo.Version, obVersion4)
+	if err != nil {
+		return errors.Wrap(err, "compare observer version 4.0.0.0")
+	}
+	if compareResult >= 0 {
+		query = selectUserTenantsForObVersion4
+	}
+	rows, err := ob.Db.QueryContext(ctx, query)
+	if err != nil {
+		return errors.Wrap(err, "query tenant names")
+	}
+	defer rows.Close()
+	tenantNames := make(map[int64]string)
+	for rows.Next() {
+		var tenantId int64
+		var tenantName string
+		if err = rows.Scan(&tenantId, &tenantName); err != nil {
+			return errors.Wrap(err, "scan tenant name")
+		}
+		tenantNames[tenantId] = tenantName
+	}
+	m.tenantNames = tenantNames
+	return rows.Err()
+}
+
+func (m *ConnectionManager) releaseTenant(tenantId int64) {
+	if config, ok := m.tenantConfs[tenantId]; ok {
+		ReleaseDb(config)
+	}
+	delete(m.tenants, tenantId)
+	delete(m.tenantConfs, tenantId)
+}
+
+// Close releases all the connections
+func (m *ConnectionManager) Close() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.closeLocked()
+}
+
+func (m *ConnectionManager) closeLocked() {
+	if _, ok := m.named[""]; ok {
+		ReleaseDb(m.defaultConfig)
+	}
+	for name := range m.named {
+		if config, ok := m.namedConfigs[name]; ok {
+			ReleaseDb(config)
+		}
+	}
+	m.named = make(map[string]*sql.DB)
+	for tenantId := range m.tenants {
+		m.releaseTenant(tenantId)
+	}
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package common
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcquireDb_shared(t *testing.T) {
+	config1 := &DbConnectionConfig{Url: "user:pass@tcp(127.0.0.1:9878)/oceanbase?timeout=4s", MaxOpen: 2, MaxIdle: 1}
+	config2 := &DbConnectionConfig{Url: config1.Url, MaxOpen: 8, MaxIdle: 1}
+	db1, err := AcquireDb(config1)
+	require.Nil(t, err)
+	db2, err := AcquireDb(config2)
+	require.Nil(t, err)
+	require.True(t, db1 == db2)
+	require.Equal(t, 8, db1.Stats().MaxOpenConnections)
+
+	ReleaseDb(config1)
+	require.Nil(t, db2.Ping())
+	ReleaseDb(config2)
+	require.NotNil(t, db2.Ping())
+
+	_, err = AcquireDb(&DbConnectionConfig{Url: "user:wrong@tcp(127.0.0.1:9878)/oceanbase?timeout=4s"})
+	require.NotNil(t, err)
+}
+
+func TestConnectionManager(t *testing.T) {
+	defaultConfig := &DbConnectionConfig{Url: "user:pass@tcp(127.0.0.1:9878)/oceanbase?timeout=3s", MaxOpen: 2, MaxIdle: 1}
+	manager := NewConnectionManager(defaultConfig, map[string]*DbConnectionConfig{
+		"tenant1": {Url: "user:pass@tcp(127.0.0.1:9878)/oceanbase?timeout=2s", MaxOpen: 1, MaxIdle: 1},
+	}, &DbConnectionConfig{Url: "{tenant}:pass@tcp(127.0.0.1:9878)/oceanbase?timeout=1s", MaxOpen: 1, MaxIdle: 1})
+	require.Nil(t, manager.Init())
+	defer manager.Close()
+
+	db, err := manager.Db("")
+	require.Nil(t, err)
+	require.Nil(t, db.Ping())
+	_, err = manager.Db("tenant1")
+	require.Nil(t, err)
+	_, err = manager.Db("tenant2")
+	require.NotNil(t, err)
+
+	adminDb, err := sqlx.Connect("mysql", defaultConfig.Url)
+	require.Nil(t, err)
+	defer adminDb.Close()
+	_, err = adminDb.Exec("create table __all_tenant (tenant_id bigint primary key, tenant_name varchar(128))")
+	require.Nil(t, err)
+	defer adminDb.Exec("drop table __all_tenant")
+	_, err = adminDb.Exec("insert into __all_tenant values (1, 'sys'), (1002, 'user'), (1004, 'nobody')")
+	require.Nil(t, err)
+
+	ob := &Observer{Db: adminDb, MetaInfo: &ObserverMetaInfo{Version: "3.1.4", AllTenantIds: []int64{1, 1002, 1004}}}
+	conns, err := manager.TenantConnections(context.Background(), ob)
+	require.Nil(t, err)
+	// tenant nobody can not connect
+	require.Equal(t, 1, len(conns))
+	require.Equal(t, int64(1002), conns[0].TenantId)
+	require.Equal(t, "user", conns[0].TenantName)
+	require.Nil(t, conns[0].Db.Ping())
+	require.Equal(t, minTenantRetryInterval, manager.failures[1004].interval)
+
+	// not connected again before retryAt
+	conns, err = manager.TenantConnections(context.Background(), ob)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(conns))
+	require.Equal(t, minTenantRetryInterval, manager.failures[1004].interval)
+	manager.failures[1004].retryAt = time.Now()
+	_, err = manager.TenantConnections(context.Background(), ob)
+	require.Nil(t, err)
+	require.Equal(t, 2*minTenantRetryInterval, manager.failures[1004].interval)
+
+	ob.MetaInfo.AllTenantIds = []int64{1}
+	conns, err = manager.TenantConnections(context.Background(), ob)
+	require.Nil(t, err)
+	require.Equal(t, 0, len(conns))
+	require.Equal(t, 0, len(manager.failures))
+
+	_, err = NewConnectionManager(defaultConfig, nil, nil).TenantConnections(context.Background(), ob)
+	require.NotNil(t, err)
+}
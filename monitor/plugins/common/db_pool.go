@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package common
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// sharedDb a db pool shared by plugins connecting with the same url
+type sharedDb struct {
+	db      *sql.DB
+	refs    int
+	maxOpen int
+	maxIdle int
+}
+
+var dbPools = make(map[string]*sharedDb)
+var dbPoolsLock sync.Mutex
+
+// AcquireDb returns the db pool of the connection url, plugins with the same url share one pool.
+// The pool is bounded by the largest maxOpen and maxIdle of its holders instead of the sum of them.
+// Every successful AcquireDb must be paired with a ReleaseDb.
+func AcquireDb(config *DbConnectionConfig) (*sql.DB, error) {
+	if db := holdDb(config); db != nil {
+		return db, nil
+	}
+	db, err := sql.Open("mysql", config.Url)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("open db, config %s", config))
+	}
+	// ping without dbPoolsLock, an unreachable db does not block acquiring the others
+	timeoutCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err = db.PingContext(timeoutCtx)
+	if err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, fmt.Sprintf("ping db, config %s", config))
+	}
+
+	dbPoolsLock.Lock()
+	defer dbPoolsLock.Unlock()
+	if pool, ok := dbPools[config.Url]; ok {
+		// connected by another one meanwhile
+		db.Close()
+		return holdPoolLocked(pool, config), nil
+	}
+	db.SetMaxOpenConns(config.MaxOpen)
+	db.SetMaxIdleConns(config.MaxIdle)
+	dbPools[config.Url] = &sharedDb{
+		db:      db,
+		refs:    1,
+		maxOpen: config.MaxOpen,
+		maxIdle: config.MaxIdle,
+	}
+	return db, nil
+}
+
+func holdDb(config *DbConnectionConfig) *sql.DB {
+	dbPoolsLock.Lock()
+	defer dbPoolsLock.Unlock()
+	if pool, ok := dbPools[config.Url]; ok {
+		return holdPoolLocked(pool, config)
+	}
+	return nil
+}
+
+func holdPoolLocked(pool *sharedDb, config *DbConnectionConfig) *sql.DB {
+	pool.refs++
+	if config.MaxOpen > pool.maxOpen {
+		pool.maxOpen = config.MaxOpen
+		pool.db.SetMaxOpenConns(pool.maxOpen)
+	}
+	if config.MaxIdle > pool.maxIdle {
+		pool.maxIdle = config.MaxIdle
+		pool.db.SetMaxIdleConns(pool.maxIdle)
+	}
+	return pool.db
+}
+
+// ReleaseDb releases the pool acquired by AcquireDb, the pool is closed when it is not held by anyone
+func ReleaseDb(config *DbConnectionConfig) {
+	dbPoolsLock.Lock()
+	defer dbPoolsLock.Unlock()
+	pool, ok := dbPools[config.Url]
+	if !ok {
+		return
+	}
+	pool.refs--
+	if pool.refs <= 0 {
+		delete(dbPools, config.Url)
+		pool.db.Close()
+	}
+}
@@ -20,6 +20,8 @@ const (
 	Json       Protocol = "json"
 	Csv        Protocol = "csv"
 	Influxdb   Protocol = "influxdb"
+	// RemoteWrite prometheus remote write protocol, snappy compressed protobuf
+	RemoteWrite Protocol = "remotewrite"
 )
 
 type TimestampPrecision string
@@ -23,12 +23,13 @@ import (
 	"github.com/oceanbase/obagent/monitor/plugins/inputs/log_tailer"
 	"github.com/oceanbase/obagent/monitor/plugins/inputs/mysql"
 	"github.com/oceanbase/obagent/monitor/plugins/inputs/nodeexporter"
+	"github.com/oceanbase/obagent/monitor/plugins/inputs/obproxy"
 	"github.com/oceanbase/obagent/monitor/plugins/inputs/prometheus"
 )
 
 func init() {
 	plugins.GetInputManager().Register("mysqlTableInput", func(conf *monagent.PluginConfig) (plugins.Source, error) {
-		tableInput := &mysql.TableInput{}
+		tableInput := &mysql.TableInput{ReadOnlyCursors: conf.DryRun}
 		err := tableInput.Init(context.Background(), conf.PluginInnerConfig)
 		if err != nil {
 			log.WithError(err).Error("init tableInput failed")
@@ -37,6 +38,16 @@ func init() {
 		return tableInput, nil
 	})
 
+	plugins.GetInputManager().Register("obSqlAuditInput", func(conf *monagent.PluginConfig) (plugins.Source, error) {
+		sqlAuditInput := &mysql.SqlAuditInput{}
+		err := sqlAuditInput.Init(context.Background(), conf.PluginInnerConfig)
+		if err != nil {
+			log.WithError(err).Error("init sqlAuditInput failed")
+			return nil, err
+		}
+		return sqlAuditInput, nil
+	})
+
 	plugins.GetInputManager().Register("mysqldInput", func(conf *monagent.PluginConfig) (plugins.Source, error) {
 		mysqldInput := &mysql.MysqldInput{}
 		err := mysqldInput.Init(context.Background(), conf.PluginInnerConfig)
@@ -47,6 +58,16 @@ func init() {
 		return mysqldInput, nil
 	})
 
+	plugins.GetInputManager().Register("obproxyInput", func(conf *monagent.PluginConfig) (plugins.Source, error) {
+		obproxyInput := &obproxy.ObproxyInput{}
+		err := obproxyInput.Init(context.Background(), conf.PluginInnerConfig)
+		if err != nil {
+			log.WithError(err).Error("init obproxyInput failed")
+			return nil, err
+		}
+		return obproxyInput, nil
+	})
+
 	plugins.GetInputManager().Register("nodeExporterInput", func(conf *monagent.PluginConfig) (plugins.Source, error) {
 		nodeExporter := &nodeexporter.NodeExporter{}
 		err := nodeExporter.Init(context.Background(), conf.PluginInnerConfig)
@@ -86,6 +107,7 @@ func init() {
 			logTailerConf.RecoveryConfig.LastPositionStoreDir == "" {
 			logTailerConf.RecoveryConfig.LastPositionStoreDir = path2.PositionStoreDir()
 		}
+		logTailerConf.RecoveryConfig.ReadOnly = conf.DryRun
 		logTailer, err := log_tailer.NewLogTailer(logTailerConf)
 		if err != nil {
 			log.WithError(err).Error("RegisterV2 logTailerInput NewLogTailer failed")
@@ -20,6 +20,8 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/oceanbase/obagent/config/monagent"
+	"github.com/oceanbase/obagent/errors"
+	"github.com/oceanbase/obagent/lib/log_analyzer"
 	"github.com/oceanbase/obagent/monitor/message"
 	"github.com/oceanbase/obagent/stat"
 )
@@ -36,6 +38,19 @@ func NewLogTailer(conf monagent.LogTailerConfig) (*LogTailer, error) {
 	if conf.ProcessQueueCapacity == 0 {
 		conf.ProcessQueueCapacity = 10
 	}
+	for _, tailConfig := range conf.TailConfigs {
+		if tailConfig.LogAnalyzerType == log_analyzer.TypePattern {
+			if err := log_analyzer.ValidatePattern(tailConfig.LogPattern); err != nil {
+				return nil, errors.Wrapf(err, "tail %s", tailConfig.GetLogFileRealPath())
+			}
+		}
+		if tailConfig.MultiLine == nil {
+			continue
+		}
+		if _, err := newMultiLineAssembler(tailConfig.MultiLine); err != nil {
+			return nil, errors.Wrapf(err, "tail %s", tailConfig.GetLogFileRealPath())
+		}
+	}
 	return &LogTailer{
 		conf:        conf,
 		executors:   make([]*LogTailerExecutor, 0),
@@ -42,6 +42,8 @@ type LogTailerExecutor struct {
 	toBeStopped      chan bool
 	isStoppedFlag    bool
 	tailLineCount    uint64
+	multiLine        *multiLineAssembler
+	throttle         *logThrottle
 }
 
 func NewLogTailerExecutor(
@@ -50,7 +52,7 @@ func NewLogTailerExecutor(
 	toBeStopped chan bool,
 	out chan<- []*message.Message,
 ) *LogTailerExecutor {
-	return &LogTailerExecutor{
+	executor := &LogTailerExecutor{
 		tailConf:         tailConf,
 		recoveryConf:     recoveryConf,
 		out:              out,
@@ -58,6 +60,18 @@ func NewLogTailerExecutor(
 		stopFlagMutex:    &sync.Mutex{},
 		toBeStopped:      toBeStopped,
 	}
+	if tailConf.MultiLine != nil {
+		multiLine, err := newMultiLineAssembler(tailConf.MultiLine)
+		if err != nil {
+			log.WithError(err).WithField("tailConf", tailConf).Warn("multi-line disabled")
+		} else {
+			executor.multiLine = multiLine
+		}
+	}
+	if tailConf.Throttle != nil {
+		executor.throttle = newLogThrottle(tailConf.Throttle, tailConf.LogFileName)
+	}
+	return executor
 }
 func (l *LogTailerExecutor) isStopped() bool {
 	l.stopFlagMutex.Lock()
@@ -101,14 +115,17 @@ func (l *LogTailerExecutor) processLogByLine(
 ) error {
 	fd := fileInfo.fileDesc
 	ctxLog := log.WithContext(ctx).WithField("fileName", fd.Name())
-	analyzer := log_analyzer.GetLogAnalyzer(fileInfo.logAnalyzerType, fileInfo.fileName)
+	analyzer, err := log_analyzer.NewLogAnalyzer(fileInfo.logAnalyzerType, fileInfo.fileName, l.tailConf.LogPattern)
+	if err != nil {
+		return err
+	}
 	fdScanner := bufio.NewScanner(fd)
 	fdScanner.Split(file.ScanLines)
 	lineHandler := func() (string, bool, error) {
 		select {
 		case _, isOpen := <-l.toBeStopped:
 			if !isOpen {
-				l.markAsStopped(ctx)
+				l.stop(ctx, fileInfo)
 				ctxLog.Info("stop process line")
 				return "", false, nil
 			}
@@ -127,23 +144,107 @@ func (l *LogTailerExecutor) processLogByLine(
 		return text, true, nil
 	}
 	msgConsumer := func(m *message.Message) bool {
-		select {
-		case _, isOpen := <-l.toBeStopped:
-			if !isOpen {
-				l.markAsStopped(ctx)
-				ctxLog.Info("stop consume line")
-				return false
+		return l.consumeMessage(ctx, fileInfo, m)
+	}
+	if l.multiLine != nil {
+		return l.assembleLines(ctx, fileInfo, analyzer, lineHandler, msgConsumer)
+	}
+	return log_analyzer.ParseLines(analyzer, lineHandler, msgConsumer)
+}
+
+func (l *LogTailerExecutor) consumeMessage(ctx context.Context, fileInfo *logFileInfo, m *message.Message) bool {
+	select {
+	case _, isOpen := <-l.toBeStopped:
+		if !isOpen {
+			if !l.isStopped() {
+				l.emit(fileInfo, m)
 			}
-		default:
+			l.stop(ctx, fileInfo)
+			log.WithContext(ctx).WithField("fileName", fileInfo.fileDesc.Name()).Info("stop consume line")
+			return false
 		}
-		m.AddTag(common.LogSourceType, l.tailConf.LogSourceType)
-		m.AddTag(common.AbsLogFileName, filepath.Join(l.tailConf.LogDir, l.tailConf.LogFileName))
-		fileInfo.offsetLineLogAt = m.GetTime()
+	default:
+	}
+	l.emit(fileInfo, m)
+	l.checkAndStoreLastPosition(ctx)
+	return true
+}
+
+func (l *LogTailerExecutor) emit(fileInfo *logFileInfo, m *message.Message) {
+	m.AddTag(common.LogSourceType, l.tailConf.LogSourceType)
+	m.AddTag(common.AbsLogFileName, filepath.Join(l.tailConf.LogDir, l.tailConf.LogFileName))
+	fileInfo.offsetLineLogAt = m.GetTime()
+	if l.throttle == nil || l.throttle.admit(m, time.Now()) {
 		l.out <- []*message.Message{m}
-		l.checkAndStoreLastPosition(ctx)
-		return true
 	}
-	return log_analyzer.ParseLines(analyzer, lineHandler, msgConsumer)
+}
+
+// stop emits the pending event and the logs held by throttle before marking as stopped, out may be closed once all executors are stopped.
+// It is only called by the goroutine of handleFileQueue.
+func (l *LogTailerExecutor) stop(ctx context.Context, fileInfo *logFileInfo) {
+	if l.isStopped() {
+		return
+	}
+	if l.multiLine != nil && fileInfo != nil {
+		if event := l.multiLine.flush(); event != nil {
+			l.emit(fileInfo, event.toMessage(fileInfo.fileName, l.defaultEventTime(fileInfo)))
+		}
+	}
+	if l.throttle != nil {
+		if msgs := l.throttle.flush(); len(msgs) > 0 {
+			l.out <- msgs
+		}
+	}
+	l.markAsStopped(ctx)
+}
+
+// emitDeduplicatedLogs emits the logs held by throttle whose dedup window ended
+func (l *LogTailerExecutor) emitDeduplicatedLogs() {
+	if l.throttle == nil {
+		return
+	}
+	if msgs := l.throttle.expired(time.Now()); len(msgs) > 0 {
+		l.out <- msgs
+	}
+}
+
+// assembleLines the pending event is kept after the file is read to the end,
+// and emitted when a new event starts or it expires
+func (l *LogTailerExecutor) assembleLines(
+	ctx context.Context,
+	fileInfo *logFileInfo,
+	analyzer log_analyzer.LogAnalyzer,
+	lineProvider func() (string, bool, error),
+	msgConsumer func(*message.Message) bool,
+) error {
+	for {
+		line, ok, err := lineProvider()
+		if !ok {
+			if l.multiLine.expired(time.Now()) {
+				l.flushMultiLine(fileInfo, msgConsumer)
+			}
+			return err
+		}
+		msg, isNewLine := analyzer.ParseLine(line)
+		event := l.multiLine.add(line, msg, isNewLine, time.Now())
+		if event != nil && !msgConsumer(event.toMessage(fileInfo.fileName, l.defaultEventTime(fileInfo))) {
+			return nil
+		}
+	}
+}
+
+func (l *LogTailerExecutor) flushMultiLine(fileInfo *logFileInfo, msgConsumer func(*message.Message) bool) {
+	if event := l.multiLine.flush(); event != nil {
+		msgConsumer(event.toMessage(fileInfo.fileName, l.defaultEventTime(fileInfo)))
+	}
+}
+
+// defaultEventTime time of events whose first line has no time, follows the previous event
+func (l *LogTailerExecutor) defaultEventTime(fileInfo *logFileInfo) time.Time {
+	if fileInfo.offsetLineLogAt.IsZero() {
+		return time.Now()
+	}
+	return fileInfo.offsetLineLogAt
 }
 
 func (l *LogTailerExecutor) handleFileQueue(ctx context.Context) error {
@@ -160,7 +261,7 @@ func (l *LogTailerExecutor) handleFileQueue(ctx context.Context) error {
 		select {
 		case _, isOpen := <-l.toBeStopped:
 			if !isOpen {
-				l.markAsStopped(ctx)
+				l.stop(ctx, queueHead)
 				ctxLog.Info("stop handleFileProcessQueue")
 				return nil
 			}
@@ -177,6 +278,12 @@ func (l *LogTailerExecutor) handleFileQueue(ctx context.Context) error {
 			if l.fileProcessQueue.getLen() > 1 || l.fileProcessQueue.getHeadIsRename() {
 				fileName := queueHead.fileDesc.Name()
 				ctxLog.WithField("fileName", fileName).Info("pop head from fileProcessQueue")
+				if l.multiLine != nil {
+					// events do not span files
+					l.flushMultiLine(queueHead, func(m *message.Message) bool {
+						return l.consumeMessage(ctx, queueHead, m)
+					})
+				}
 				// pop and then close to prevent other goroutine from getting the closed file
 				l.fileProcessQueue.popHead()
 				closeFile(ctx, queueHead.fileDesc)
@@ -184,6 +291,7 @@ func (l *LogTailerExecutor) handleFileQueue(ctx context.Context) error {
 		} else {
 			time.Sleep(l.tailConf.ProcessLogInterval)
 		}
+		l.emitDeduplicatedLogs()
 
 		time.Sleep(l.tailConf.ProcessLogInterval)
 	}
@@ -207,7 +315,7 @@ func (l *LogTailerExecutor) WatchFile(ctx context.Context) error {
 		select {
 		case _, isOpen := <-l.toBeStopped:
 			if !isOpen {
-				l.markAsStopped(ctx)
+				// marked as stopped by handleFileQueue after the pending logs are emitted
 				ctxLog.Info("stop WatchFile")
 				return nil
 			}
@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package log_tailer
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/oceanbase/obagent/config/monagent"
+	"github.com/oceanbase/obagent/errors"
+	"github.com/oceanbase/obagent/monitor/message"
+)
+
+const (
+	defaultMultiLineMaxLines     = 500
+	defaultMultiLineFlushTimeout = 3 * time.Second
+)
+
+// multiLineEvent lines of an event, head is the message parsed from the first line
+type multiLineEvent struct {
+	head  *message.Message
+	lines []string
+}
+
+// multiLineAssembler keeps the pending event between reads of the file,
+// so continuation lines written later are not split from their event
+type multiLineAssembler struct {
+	maxLines           int
+	flushTimeout       time.Duration
+	startRegexp        *regexp.Regexp
+	continuationRegexp *regexp.Regexp
+
+	pending    *multiLineEvent
+	lastLineAt time.Time
+}
+
+func newMultiLineAssembler(config *monagent.MultiLineConfig) (*multiLineAssembler, error) {
+	a := &multiLineAssembler{
+		maxLines:     config.MaxLines,
+		flushTimeout: config.FlushTimeout,
+	}
+	if a.maxLines <= 0 {
+		a.maxLines = defaultMultiLineMaxLines
+	}
+	if a.flushTimeout <= 0 {
+		a.flushTimeout = defaultMultiLineFlushTimeout
+	}
+	var err error
+	if config.StartPattern != "" {
+		a.startRegexp, err = regexp.Compile(config.StartPattern)
+		if err != nil {
+			return nil, errors.Wrap(err, "compile multi-line start pattern")
+		}
+	}
+	if config.ContinuationPattern != "" {
+		a.continuationRegexp, err = regexp.Compile(config.ContinuationPattern)
+		if err != nil {
+			return nil, errors.Wrap(err, "compile multi-line continuation pattern")
+		}
+	}
+	return a, nil
+}
+
+// isContinuation isNewLine of the log analyzer decides when no pattern is set
+func (a *multiLineAssembler) isContinuation(line string, isNewLine bool) bool {
+	if a.startRegexp != nil && a.startRegexp.MatchString(line) {
+		return false
+	}
+	if a.continuationRegexp != nil {
+		return a.continuationRegexp.MatchString(line)
+	}
+	if a.startRegexp != nil {
+		return true
+	}
+	return !isNewLine
+}
+
+// add appends the line to the pending event, the completed event is returned when the line starts a new one
+// or the pending event reaches max lines
+func (a *multiLineAssembler) add(line string, msg *message.Message, isNewLine bool, now time.Time) *multiLineEvent {
+	a.lastLineAt = now
+	// lines are scanned with the line break
+	line = strings.TrimRight(line, "\r\n")
+	if a.pending != nil && a.isContinuation(line, isNewLine) {
+		a.pending.lines = append(a.pending.lines, line)
+		if len(a.pending.lines) >= a.maxLines {
+			return a.flush()
+		}
+		return nil
+	}
+	completed := a.flush()
+	a.pending = &multiLineEvent{head: msg, lines: []string{line}}
+	return completed
+}
+
+func (a *multiLineAssembler) flush() *multiLineEvent {
+	event := a.pending
+	a.pending = nil
+	return event
+}
+
+// expired the pending event waited long enough for continuation lines
+func (a *multiLineAssembler) expired(now time.Time) bool {
+	return a.pending != nil && now.Sub(a.lastLineAt) >= a.flushTimeout
+}
+
+// toMessage the first line not parsed by the log analyzer is kept as raw
+func (e *multiLineEvent) toMessage(fileName string, defaultTime time.Time) *message.Message {
+	msg := e.head
+	if msg == nil {
+		msg = message.NewMessage(fileName, message.Log, defaultTime)
+		msg.AddField("raw", e.lines[0])
+	}
+	msg.AddField("extra", strings.Join(e.lines[1:], "\n"))
+	return msg
+}
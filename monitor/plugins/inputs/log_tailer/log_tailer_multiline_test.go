@@ -0,0 +1,148 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package log_tailer
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/oceanbase/obagent/config/monagent"
+	"github.com/oceanbase/obagent/monitor/message"
+)
+
+func TestMultiLineAssembler(t *testing.T) {
+	now := time.Now()
+	Convey("按起始行正则组装", t, func() {
+		a, err := newMultiLineAssembler(&monagent.MultiLineConfig{StartPattern: `^\d{4}-`, MaxLines: 3})
+		So(err, ShouldBeNil)
+		So(a.add("2023-05-01 a", nil, false, now), ShouldBeNil)
+		So(a.add("  at b", nil, false, now), ShouldBeNil)
+		event := a.add("2023-05-01 c", nil, false, now)
+		So(event.lines, ShouldResemble, []string{"2023-05-01 a", "  at b"})
+
+		So(a.add("  at d", nil, false, now), ShouldBeNil)
+		// reaches max lines
+		event = a.add("  at e", nil, false, now)
+		So(event.lines, ShouldResemble, []string{"2023-05-01 c", "  at d", "  at e"})
+		So(a.flush(), ShouldBeNil)
+	})
+
+	Convey("按续行正则组装", t, func() {
+		a, err := newMultiLineAssembler(&monagent.MultiLineConfig{ContinuationPattern: `^\s+`})
+		So(err, ShouldBeNil)
+		So(a.add("a", nil, false, now), ShouldBeNil)
+		So(a.add("\tb", nil, false, now), ShouldBeNil)
+		So(a.add("c", nil, false, now).lines, ShouldResemble, []string{"a", "\tb"})
+	})
+
+	Convey("未配置正则时按日志解析结果组装，超时后输出", t, func() {
+		a, err := newMultiLineAssembler(&monagent.MultiLineConfig{FlushTimeout: time.Second})
+		So(err, ShouldBeNil)
+		head := message.NewMessage("monagent.log", message.Log, now)
+		So(a.add("head", head, true, now), ShouldBeNil)
+		So(a.add("stack", nil, false, now), ShouldBeNil)
+		So(a.expired(now), ShouldBeFalse)
+		So(a.expired(now.Add(time.Second)), ShouldBeTrue)
+		msg := a.flush().toMessage("monagent.log", now)
+		So(msg, ShouldEqual, head)
+		extra, _ := msg.GetField("extra")
+		So(extra, ShouldEqual, "stack")
+	})
+
+	Convey("非法正则", t, func() {
+		_, err := newMultiLineAssembler(&monagent.MultiLineConfig{StartPattern: "("})
+		So(err, ShouldNotBeNil)
+		_, err = NewLogTailer(monagent.LogTailerConfig{TailConfigs: []monagent.TailConfig{{MultiLine: &monagent.MultiLineConfig{ContinuationPattern: "("}}}})
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestLogTailer_processMultiLine(t *testing.T) {
+	tmpDir, err := prepareTestDirTree("multiline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	tmpFile, err := os.Create(tmpDir + "/monagent.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tmpFile.Close()
+	readFd, err := os.Open(tmpFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer readFd.Close()
+
+	Convey("panic 堆栈跨多次读取组装为一条日志", t, func() {
+		out := make(chan []*message.Message, 10)
+		executor := NewLogTailerExecutor(monagent.TailConfig{
+			LogDir:          tmpDir,
+			LogFileName:     "monagent.log",
+			LogAnalyzerType: "agent",
+			MultiLine:       &monagent.MultiLineConfig{FlushTimeout: time.Millisecond},
+		}, monagent.RecoveryConfig{}, make(chan bool), out)
+		So(executor.multiLine, ShouldNotBeNil)
+		fileInfo := &logFileInfo{fileName: "monagent.log", fileDesc: readFd, logAnalyzerType: "agent"}
+
+		_, err := tmpFile.WriteString("2023-05-01T10:00:00.12345+08:00 ERROR [123,] caller=main.go:10:main: collect failed\n" +
+			"panic: runtime error: invalid memory address or nil pointer dereference\n")
+		So(err, ShouldBeNil)
+		So(executor.processLogByLine(context.Background(), fileInfo), ShouldBeNil)
+		So(len(out), ShouldEqual, 0)
+
+		_, err = tmpFile.WriteString("goroutine 1 [running]:\nmain.main()\n")
+		So(err, ShouldBeNil)
+		So(executor.processLogByLine(context.Background(), fileInfo), ShouldBeNil)
+		So(len(out), ShouldEqual, 0)
+
+		// no more lines within the flush timeout
+		time.Sleep(5 * time.Millisecond)
+		So(executor.processLogByLine(context.Background(), fileInfo), ShouldBeNil)
+		So(len(out), ShouldEqual, 1)
+		msg := (<-out)[0]
+		level, _ := msg.GetTag("level")
+		So(level, ShouldEqual, "error")
+		extra, _ := msg.GetField("extra")
+		So(extra, ShouldEqual, "panic: runtime error: invalid memory address or nil pointer dereference\ngoroutine 1 [running]:\nmain.main()")
+	})
+
+	Convey("停止时输出未完成的日志", t, func() {
+		out := make(chan []*message.Message, 10)
+		toBeStopped := make(chan bool)
+		executor := NewLogTailerExecutor(monagent.TailConfig{
+			LogDir:          tmpDir,
+			LogFileName:     "monagent.log",
+			LogAnalyzerType: "agent",
+			MultiLine:       &monagent.MultiLineConfig{FlushTimeout: time.Hour},
+		}, monagent.RecoveryConfig{}, toBeStopped, out)
+		fileInfo := &logFileInfo{fileName: "monagent.log", fileDesc: readFd, logAnalyzerType: "agent"}
+
+		_, err := tmpFile.WriteString("2023-05-01T10:01:00.12345+08:00 ERROR [123,] caller=main.go:10:main: collect failed\n" +
+			"goroutine 1 [running]:\n")
+		So(err, ShouldBeNil)
+		So(executor.processLogByLine(context.Background(), fileInfo), ShouldBeNil)
+		So(len(out), ShouldEqual, 0)
+
+		close(toBeStopped)
+		So(executor.processLogByLine(context.Background(), fileInfo), ShouldBeNil)
+		So(executor.isStopped(), ShouldBeTrue)
+		So(len(out), ShouldEqual, 1)
+		extra, _ := (<-out)[0].GetField("extra")
+		So(extra, ShouldEqual, "goroutine 1 [running]:")
+	})
+}
@@ -33,7 +33,7 @@ func getLastPositionStorePath(lastPositionStoreDir, logSourceType, logFileName s
 
 // storeLastPosition Persist the last query location
 func storeLastPosition(ctx context.Context, recoveryConf monagent.RecoveryConfig, fileInfo *logFileInfo) error {
-	if !recoveryConf.Enabled || fileInfo == nil {
+	if !recoveryConf.Enabled || recoveryConf.ReadOnly || fileInfo == nil {
 		return nil
 	}
 	positionStoreFilePath := getLastPositionStorePath(recoveryConf.LastPositionStoreDir, fileInfo.logSourceType, fileInfo.fileName)
@@ -84,4 +84,21 @@ func TestLogTailer_storeLastPosition(t *testing.T) {
 		So(toBeStoredFileInfo.fileOffset, ShouldEqual, loadedLogFileInfo.fileOffset)
 		So(toBeStoredFileInfo.fileName, ShouldEqual, loadedLogFileInfo.fileName)
 	})
+
+	Convey("dry run 不保存位置", t, func() {
+		readOnlyConfig := recoveryConfig
+		readOnlyConfig.ReadOnly = true
+		movedFileInfo := &logFileInfo{
+			logSourceType:   "observer",
+			fileName:        "ob.log.wf",
+			fileDesc:        tmpLogFile,
+			fileOffset:      4444,
+			offsetLineLogAt: tmpLogFileModTime,
+		}
+		So(storeLastPosition(context.Background(), readOnlyConfig, movedFileInfo), ShouldBeNil)
+
+		loadedLogFileInfo, err := loadLastPosition(context.Background(), readOnlyConfig, tailConfig)
+		So(err, ShouldBeNil)
+		So(loadedLogFileInfo.fileOffset, ShouldEqual, 3333)
+	})
 }
@@ -0,0 +1,187 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package log_tailer
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oceanbase/obagent/config/monagent"
+	"github.com/oceanbase/obagent/monitor/message"
+	"github.com/oceanbase/obagent/monitor/plugins/common"
+	"github.com/oceanbase/obagent/stat"
+)
+
+const (
+	dropReasonDeduplicated = "deduplicated"
+	dropReasonSampled      = "sampled"
+	dropReasonRateLimited  = "rate_limited"
+
+	defaultMaxDedupEntries = 10000
+	repeatCountField       = "repeat_count"
+)
+
+// farFuture is after the end of any dedup window
+var farFuture = time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// variableTokenRegexp words with digits, e.g. ids, addresses, durations and trace ids, are ignored by deduplication
+var variableTokenRegexp = regexp.MustCompile(`[0-9A-Za-z_.:-]*\d[0-9A-Za-z_.:-]*`)
+
+type dedupEntry struct {
+	msg      *message.Message
+	count    int
+	expireAt time.Time
+}
+
+// logThrottle deduplicates, samples and rate limits the logs of a tail config, it is not goroutine safe
+type logThrottle struct {
+	config     *monagent.ThrottleConfig
+	fileName   string
+	keepLevels map[string]bool
+	maxEntries int
+
+	tokens     float64
+	burst      float64
+	lastRefill time.Time
+
+	sampleAcc map[string]float64
+	pending   map[string]*dedupEntry
+}
+
+func newLogThrottle(config *monagent.ThrottleConfig, fileName string) *logThrottle {
+	t := &logThrottle{
+		config:     config,
+		fileName:   fileName,
+		keepLevels: make(map[string]bool, len(config.KeepLevels)),
+		maxEntries: config.MaxDedupEntries,
+		burst:      float64(config.Burst),
+		sampleAcc:  make(map[string]float64),
+		pending:    make(map[string]*dedupEntry),
+	}
+	for _, level := range config.KeepLevels {
+		t.keepLevels[strings.ToLower(level)] = true
+	}
+	if t.maxEntries <= 0 {
+		t.maxEntries = defaultMaxDedupEntries
+	}
+	if t.burst <= 0 {
+		// at least 1, otherwise a rate limit below 1 never passes
+		t.burst = math.Max(1, math.Ceil(config.RateLimit))
+	}
+	t.tokens = t.burst
+	return t
+}
+
+// admit returns true when the message should be emitted now.
+// Messages held for deduplication are emitted by expired when the window ends.
+func (t *logThrottle) admit(msg *message.Message, now time.Time) bool {
+	level, _ := msg.GetTag(common.Level)
+	level = strings.ToLower(level)
+
+	var key string
+	if t.config.DedupWindow > 0 {
+		key = dedupKey(msg, level)
+		if entry, ok := t.pending[key]; ok {
+			entry.count++
+			t.drop(dropReasonDeduplicated)
+			return false
+		}
+	}
+	if !t.keepLevels[level] {
+		if !t.sample(level) {
+			t.drop(dropReasonSampled)
+			return false
+		}
+		if !t.takeToken(now) {
+			t.drop(dropReasonRateLimited)
+			return false
+		}
+	}
+	if key == "" || len(t.pending) >= t.maxEntries {
+		return true
+	}
+	t.pending[key] = &dedupEntry{msg: msg, count: 1, expireAt: now.Add(t.config.DedupWindow)}
+	return false
+}
+
+// sample keeps the ratio of logs of the level evenly
+func (t *logThrottle) sample(level string) bool {
+	rate, ok := t.config.SampleRates[level]
+	if !ok || rate >= 1 {
+		return true
+	}
+	acc := t.sampleAcc[level] + rate
+	if acc >= 1 {
+		t.sampleAcc[level] = acc - 1
+		return true
+	}
+	t.sampleAcc[level] = acc
+	return false
+}
+
+func (t *logThrottle) takeToken(now time.Time) bool {
+	if t.config.RateLimit <= 0 {
+		return true
+	}
+	if !t.lastRefill.IsZero() {
+		t.tokens += now.Sub(t.lastRefill).Seconds() * t.config.RateLimit
+		if t.tokens > t.burst {
+			t.tokens = t.burst
+		}
+	}
+	t.lastRefill = now
+	if t.tokens < 1 {
+		return false
+	}
+	t.tokens--
+	return true
+}
+
+func (t *logThrottle) drop(reason string) {
+	stat.LogTailerDroppedCount.With(prometheus.Labels{stat.LogFileName: t.fileName, stat.SkipReasonKey: reason}).Inc()
+}
+
+// expired returns the held messages whose window ended, ordered by time
+func (t *logThrottle) expired(now time.Time) []*message.Message {
+	var ret []*message.Message
+	for key, entry := range t.pending {
+		if now.Before(entry.expireAt) {
+			continue
+		}
+		ret = append(ret, entry.msg.AddField(repeatCountField, entry.count))
+		delete(t.pending, key)
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].GetTime().Before(ret[j].GetTime())
+	})
+	return ret
+}
+
+// flush returns all the held messages, ordered by time
+func (t *logThrottle) flush() []*message.Message {
+	return t.expired(farFuture)
+}
+
+func dedupKey(msg *message.Message, level string) string {
+	content, ok := msg.GetField("content")
+	if !ok {
+		content, _ = msg.GetField("raw")
+	}
+	text, _ := content.(string)
+	return level + "\x00" + variableTokenRegexp.ReplaceAllString(text, "?")
+}
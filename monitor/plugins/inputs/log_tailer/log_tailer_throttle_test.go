@@ -0,0 +1,137 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package log_tailer
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/oceanbase/obagent/config/monagent"
+	"github.com/oceanbase/obagent/monitor/message"
+	"github.com/oceanbase/obagent/stat"
+)
+
+func newThrottleTestLog(t time.Time, level string, content string) *message.Message {
+	return message.NewMessage("observer.log", message.Log, t).AddTag("level", level).AddField("content", content)
+}
+
+func countAdmitted(throttle *logThrottle, msgs []*message.Message, now time.Time) int {
+	admitted := 0
+	for _, msg := range msgs {
+		if throttle.admit(msg, now) {
+			admitted++
+		}
+	}
+	return admitted
+}
+
+func droppedCount(fileName string, reason string) float64 {
+	return testutil.ToFloat64(stat.LogTailerDroppedCount.With(prometheus.Labels{stat.LogFileName: fileName, stat.SkipReasonKey: reason}))
+}
+
+func TestLogThrottle_sampleAndRateLimit(t *testing.T) {
+	now := time.Now()
+	Convey("按级别采样，保留级别不受影响", t, func() {
+		throttle := newLogThrottle(&monagent.ThrottleConfig{
+			SampleRates: map[string]float64{"info": 0.25},
+			KeepLevels:  []string{"ERROR"},
+		}, "sample.log")
+		var infos, errs []*message.Message
+		for i := 0; i < 100; i++ {
+			infos = append(infos, newThrottleTestLog(now, "INFO", fmt.Sprintf("info %d", i)))
+			errs = append(errs, newThrottleTestLog(now, "ERROR", fmt.Sprintf("error %d", i)))
+		}
+		So(countAdmitted(throttle, infos, now), ShouldEqual, 25)
+		So(countAdmitted(throttle, errs, now), ShouldEqual, 100)
+		So(droppedCount("sample.log", dropReasonSampled), ShouldEqual, 75)
+	})
+
+	Convey("限速", t, func() {
+		throttle := newLogThrottle(&monagent.ThrottleConfig{RateLimit: 10, KeepLevels: []string{"error"}}, "rate.log")
+		var msgs []*message.Message
+		for i := 0; i < 20; i++ {
+			msgs = append(msgs, newThrottleTestLog(now, "warn", "disk is full"))
+		}
+		So(countAdmitted(throttle, msgs, now), ShouldEqual, 10)
+		So(throttle.admit(newThrottleTestLog(now, "error", "disk is full"), now), ShouldBeTrue)
+		So(countAdmitted(throttle, msgs, now.Add(500*time.Millisecond)), ShouldEqual, 5)
+		So(droppedCount("rate.log", dropReasonRateLimited), ShouldEqual, 25)
+	})
+
+	Convey("限速小于 1 条每秒", t, func() {
+		throttle := newLogThrottle(&monagent.ThrottleConfig{RateLimit: 0.5}, "slow.log")
+		So(throttle.admit(newThrottleTestLog(now, "warn", "disk is full"), now), ShouldBeTrue)
+		So(throttle.admit(newThrottleTestLog(now, "warn", "disk is full"), now.Add(time.Second)), ShouldBeFalse)
+		So(throttle.admit(newThrottleTestLog(now, "warn", "disk is full"), now.Add(3*time.Second)), ShouldBeTrue)
+	})
+}
+
+func TestLogThrottle_dedup(t *testing.T) {
+	now := time.Now()
+	Convey("窗口内相同内容合并为一条", t, func() {
+		throttle := newLogThrottle(&monagent.ThrottleConfig{DedupWindow: 10 * time.Second, MaxDedupEntries: 2}, "dedup.log")
+		first := newThrottleTestLog(now, "warn", "write file /data/1/block_file failed, ret=-4184, used=99.5%")
+		So(throttle.admit(first, now), ShouldBeFalse)
+		for i := 0; i < 5; i++ {
+			msg := newThrottleTestLog(now, "warn", fmt.Sprintf("write file /data/%d/block_file failed, ret=-4184, used=99.%d%%", i, i))
+			So(throttle.admit(msg, now), ShouldBeFalse)
+		}
+		// different level is not the same log
+		So(throttle.admit(newThrottleTestLog(now.Add(time.Second), "error", "write file /data/1/block_file failed, ret=-4184, used=99.5%"), now), ShouldBeFalse)
+		// exceeds max entries
+		So(throttle.admit(newThrottleTestLog(now, "warn", "other"), now), ShouldBeTrue)
+
+		So(len(throttle.expired(now.Add(5*time.Second))), ShouldEqual, 0)
+		expired := throttle.expired(now.Add(10 * time.Second))
+		So(len(expired), ShouldEqual, 2)
+		So(expired[0], ShouldEqual, first)
+		count, _ := first.GetField(repeatCountField)
+		So(count, ShouldEqual, 6)
+		count, _ = expired[1].GetField(repeatCountField)
+		So(count, ShouldEqual, 1)
+		So(droppedCount("dedup.log", dropReasonDeduplicated), ShouldEqual, 5)
+
+		// a new window starts after expired
+		So(throttle.admit(newThrottleTestLog(now, "warn", "write file /data/2/block_file failed"), now.Add(11*time.Second)), ShouldBeFalse)
+		So(len(throttle.pending), ShouldEqual, 1)
+	})
+
+	Convey("停止时输出窗口未结束的日志", t, func() {
+		out := make(chan []*message.Message, 10)
+		toBeStopped := make(chan bool)
+		executor := NewLogTailerExecutor(monagent.TailConfig{
+			LogFileName: "observer.log",
+			Throttle:    &monagent.ThrottleConfig{DedupWindow: time.Hour},
+		}, monagent.RecoveryConfig{}, toBeStopped, out)
+		fileInfo := &logFileInfo{fileName: "observer.log"}
+		So(executor.consumeMessage(context.Background(), fileInfo, newThrottleTestLog(now, "warn", "disk is full")), ShouldBeTrue)
+		So(executor.consumeMessage(context.Background(), fileInfo, newThrottleTestLog(now, "warn", "disk is full")), ShouldBeTrue)
+		So(len(out), ShouldEqual, 0)
+
+		close(toBeStopped)
+		executor.stop(context.Background(), fileInfo)
+		So(executor.isStopped(), ShouldBeTrue)
+		So(len(out), ShouldEqual, 1)
+		msgs := <-out
+		So(len(msgs), ShouldEqual, 1)
+		count, _ := msgs[0].GetField(repeatCountField)
+		So(count, ShouldEqual, 2)
+		So(len(executor.throttle.pending), ShouldEqual, 0)
+	})
+}
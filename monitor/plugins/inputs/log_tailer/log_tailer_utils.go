@@ -209,9 +209,9 @@ type FilterLogFunc func(ctx context.Context, fd *os.File) (isFilter bool)
 
 func getLogsWithinTime(ctx context.Context, conf monagent.TailConfig, start, end time.Time) ([]*os.File, error) {
 	ctxLog := log.WithContext(ctx)
-	logAnalyzer := log_analyzer.GetLogAnalyzer(conf.LogAnalyzerType, conf.LogSourceType)
-	if logAnalyzer == nil {
-		return nil, errors.Errorf("get log analyzer failed, logAnalyzerType: %s", conf.LogAnalyzerType)
+	logAnalyzer, err := log_analyzer.NewLogAnalyzer(conf.LogAnalyzerType, conf.LogSourceType, conf.LogPattern)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get log analyzer failed, logAnalyzerType: %s", conf.LogAnalyzerType)
 	}
 	matchedFileInfos, err := findFilesAndSortByMTime(ctx, conf.LogDir, conf.LogFileName, start, end, logAnalyzer.GetFileEndTime)
 	if err != nil {
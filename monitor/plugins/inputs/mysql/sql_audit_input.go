@@ -0,0 +1,484 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+
+	"github.com/oceanbase/obagent/errors"
+	agentlog "github.com/oceanbase/obagent/log"
+	"github.com/oceanbase/obagent/monitor/message"
+	"github.com/oceanbase/obagent/monitor/plugins/common"
+	"github.com/oceanbase/obagent/monitor/utils"
+	"github.com/oceanbase/obagent/stat"
+)
+
+const sqlAuditSampleConfig = `
+connection:
+  url: user:password@tcp(127.0.0.1:2881)/oceanbase?interpolateParams=true
+  maxIdle: 2
+  maxOpen: 8
+ob_svr_ip: 127.0.0.1
+ob_svr_port: 2882
+sqlAudit:
+  enabled: true
+  minObVersion: 4.0.0.0
+  batchSize: 10000
+  includeInnerSql: false
+  maxSqlTextLength: 1024
+ash:
+  enabled: true
+  minObVersion: 4.2.0.0
+  batchSize: 10000
+collect_interval: 60s
+`
+
+const sqlAuditDescription = `
+collect per sql id statistics from GV$OB_SQL_AUDIT and sampled sessions from GV$OB_ACTIVE_SESSION_HISTORY of the local observer incrementally
+`
+
+const (
+	selectSqlAuditMaxRequestId = "select /*+ MONITOR_AGENT */ max(request_id) from GV$OB_SQL_AUDIT where svr_ip = ? and svr_port = ?"
+	selectSqlAudit             = "select /*+ MONITOR_AGENT */ svr_ip, svr_port, request_id, tenant_id, tenant_name, user_name, db_name, sql_id, plan_id, " +
+		"query_sql, ret_code, elapsed_time, execute_time, total_wait_time_micro, return_rows, affected_rows, retry_cnt " +
+		"from GV$OB_SQL_AUDIT where svr_ip = ? and svr_port = ? and request_id > ? %s order by request_id limit ?"
+
+	selectAshMaxSampleId = "select /*+ MONITOR_AGENT */ max(sample_id) from GV$OB_ACTIVE_SESSION_HISTORY where svr_ip = ? and svr_port = ?"
+	selectAsh            = "select /*+ MONITOR_AGENT */ svr_ip, svr_port, sample_id, sample_time, con_id, user_id, session_id, session_type, " +
+		"session_state, sql_id, plan_id, trace_id, event, wait_class, time_waited " +
+		"from GV$OB_ACTIVE_SESSION_HISTORY where svr_ip = ? and svr_port = ? and sample_id > ? order by sample_id limit ?"
+)
+
+const (
+	sqlAuditMetricName = "ob_sql_audit"
+	ashMetricName      = "ob_ash"
+)
+
+const ashTimeLayout = "2006-01-02 15:04:05.999999"
+
+const (
+	defaultSqlAuditBatchSize       = 10000
+	defaultSqlAuditCollectInterval = time.Minute
+)
+
+type SqlAuditSourceConfig struct {
+	Enabled      bool   `yaml:"enabled"`
+	MinObVersion string `yaml:"minObVersion"`
+	MaxObVersion string `yaml:"maxObVersion"`
+	// BatchSize max rows read in one collect, the rest are read in the next collect
+	BatchSize int `yaml:"batchSize"`
+	// IncludeInnerSql whether to collect inner sql, only for sqlAudit
+	IncludeInnerSql bool `yaml:"includeInnerSql"`
+	// MaxSqlTextLength query_sql longer than this is truncated, only for sqlAudit
+	MaxSqlTextLength int `yaml:"maxSqlTextLength"`
+}
+
+// SqlAuditInputConfig only the rows of the local observer are collected, as an agent runs on each observer
+type SqlAuditInputConfig struct {
+	DbConnectionConfig *common.DbConnectionConfig `yaml:"connection"`
+	ObSvrIp            string                     `yaml:"ob_svr_ip"`
+	ObSvrPort          int64                      `yaml:"ob_svr_port"`
+	SqlAudit           *SqlAuditSourceConfig      `yaml:"sqlAudit"`
+	Ash                *SqlAuditSourceConfig      `yaml:"ash"`
+	CollectInterval    time.Duration              `yaml:"collect_interval"`
+}
+
+// incrementalSource reads rows of a GV$ view newer than the cursor,
+// the cursor is a per server monotonic id like request_id or sample_id
+type incrementalSource struct {
+	name         string
+	config       *SqlAuditSourceConfig
+	maxSql       string
+	querySql     string
+	cursorColumn string
+	cursor       int64
+	// started the cursor is set at the first collect
+	started bool
+}
+
+type SqlAuditInput struct {
+	Config *SqlAuditInputConfig
+	Db     *sql.DB
+	Ob     *common.Observer
+
+	sqlAudit *incrementalSource
+	ash      *incrementalSource
+	// queryRows can be replaced in tests
+	queryRows func(ctx context.Context, query string, args ...interface{}) ([]map[string]interface{}, error)
+
+	ctx  context.Context
+	done chan struct{}
+}
+
+func (s *SqlAuditInput) SampleConfig() string {
+	return sqlAuditSampleConfig
+}
+
+func (s *SqlAuditInput) Description() string {
+	return sqlAuditDescription
+}
+
+func (s *SqlAuditInput) Init(ctx context.Context, config map[string]interface{}) error {
+	var pluginConfig SqlAuditInputConfig
+	configBytes, err := yaml.Marshal(config)
+	if err != nil {
+		return errors.Wrap(err, "sqlAuditInput encode config")
+	}
+	err = yaml.Unmarshal(configBytes, &pluginConfig)
+	if err != nil {
+		return errors.Wrap(err, "sqlAuditInput decode config")
+	}
+	if pluginConfig.SqlAudit == nil {
+		pluginConfig.SqlAudit = &SqlAuditSourceConfig{}
+	}
+	if pluginConfig.Ash == nil {
+		pluginConfig.Ash = &SqlAuditSourceConfig{}
+	}
+	for _, sourceConfig := range []*SqlAuditSourceConfig{pluginConfig.SqlAudit, pluginConfig.Ash} {
+		if sourceConfig.BatchSize <= 0 {
+			sourceConfig.BatchSize = defaultSqlAuditBatchSize
+		}
+	}
+	if pluginConfig.CollectInterval <= 0 {
+		pluginConfig.CollectInterval = defaultSqlAuditCollectInterval
+	}
+	if pluginConfig.ObSvrIp == "" || pluginConfig.ObSvrPort <= 0 {
+		return errors.New("sqlAuditInput ob_svr_ip and ob_svr_port not set")
+	}
+	s.Config = &pluginConfig
+	s.ctx = context.Background()
+	s.done = make(chan struct{})
+
+	innerSqlCondition := "and is_inner_sql = 0"
+	if pluginConfig.SqlAudit.IncludeInnerSql {
+		innerSqlCondition = ""
+	}
+	s.sqlAudit = &incrementalSource{
+		name:         sqlAuditMetricName,
+		config:       pluginConfig.SqlAudit,
+		maxSql:       selectSqlAuditMaxRequestId,
+		querySql:     fmt.Sprintf(selectSqlAudit, innerSqlCondition),
+		cursorColumn: "request_id",
+	}
+	s.ash = &incrementalSource{
+		name:         ashMetricName,
+		config:       pluginConfig.Ash,
+		maxSql:       selectAshMaxSampleId,
+		querySql:     selectAsh,
+		cursorColumn: "sample_id",
+	}
+
+	if s.queryRows != nil {
+		return nil
+	}
+	if pluginConfig.DbConnectionConfig == nil {
+		return errors.New("sqlAuditInput connection not set")
+	}
+	log.WithContext(ctx).Infof("init sqlAuditInput with connection %s", pluginConfig.DbConnectionConfig)
+	s.Db, err = sql.Open("mysql", pluginConfig.DbConnectionConfig.Url)
+	if err != nil {
+		return errors.Wrap(err, "db init")
+	}
+	s.Db.SetMaxOpenConns(pluginConfig.DbConnectionConfig.MaxOpen)
+	s.Db.SetMaxIdleConns(pluginConfig.DbConnectionConfig.MaxIdle)
+	s.queryRows = s.dbQueryRows
+	s.Ob, err = common.GetObserver(pluginConfig.DbConnectionConfig)
+	if err != nil {
+		return errors.Wrap(err, "get obVersion failed")
+	}
+	return nil
+}
+
+func (s *SqlAuditInput) Start(out chan<- []*message.Message) error {
+	log.Info("start sqlAuditInput plugin")
+	go s.update(out)
+	return nil
+}
+
+func (s *SqlAuditInput) update(out chan<- []*message.Message) {
+	ticker := time.NewTicker(s.Config.CollectInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			msgs, err := s.CollectMsgs(s.ctx)
+			if err != nil {
+				log.WithContext(s.ctx).Warnf("sqlAuditInput collect failed, reason: %s", err)
+				continue
+			}
+			out <- msgs
+		case <-s.done:
+			log.Info("sqlAuditInput plugin exited")
+			return
+		}
+	}
+}
+
+func (s *SqlAuditInput) Stop() {
+	if s.done != nil {
+		close(s.done)
+	}
+	if s.Db != nil {
+		s.Db.Close()
+	}
+}
+
+func (s *SqlAuditInput) obVersion() string {
+	if s.Ob == nil || s.Ob.MetaInfo == nil {
+		return ""
+	}
+	return s.Ob.MetaInfo.Version
+}
+
+func (s *SqlAuditInput) CollectMsgs(ctx context.Context) ([]*message.Message, error) {
+	enabled := func(source *incrementalSource) bool {
+		return source.config.Enabled &&
+			versionSatisfied(source.config.MinObVersion, source.config.MaxObVersion, s.obVersion())
+	}
+	if !enabled(s.sqlAudit) && !enabled(s.ash) {
+		return nil, nil
+	}
+	now := time.Now()
+	msgs := make([]*message.Message, 0)
+	if enabled(s.sqlAudit) {
+		rows, err := s.collectSource(ctx, s.sqlAudit)
+		if err != nil {
+			log.WithContext(ctx).Warnf("sqlAuditInput collect failed, reason: %s", err)
+		}
+		msgs = append(msgs, aggregateSqlAudit(rows, s.Config.SqlAudit.MaxSqlTextLength, now)...)
+	}
+	if enabled(s.ash) {
+		rows, err := s.collectSource(ctx, s.ash)
+		if err != nil {
+			log.WithContext(ctx).Warnf("sqlAuditInput collect failed, reason: %s", err)
+		}
+		msgs = append(msgs, convertAshRows(rows, now)...)
+	}
+	return msgs, nil
+}
+
+func (s *SqlAuditInput) collectSource(ctx context.Context, source *incrementalSource) ([]map[string]interface{}, error) {
+	if !source.started {
+		// start from the newest row at the first collect, history is not read
+		maxId, err := s.queryMaxId(ctx, source)
+		if err != nil {
+			return nil, errors.Wrapf(err, "collect %s", source.name)
+		}
+		source.cursor = maxId
+		source.started = true
+		return nil, nil
+	}
+
+	tStart := time.Now()
+	entry := log.WithContext(context.WithValue(ctx, agentlog.StartTimeKey, tStart)).WithField("name", source.name)
+	rows, err := s.queryRows(ctx, source.querySql, s.Config.ObSvrIp, s.Config.ObSvrPort, source.cursor, source.config.BatchSize)
+	entry.Debug("execute end")
+	stat.MonitorAgentTableInputHistogram.WithLabelValues(source.name).Observe(time.Now().Sub(tStart).Seconds())
+	if err != nil {
+		return nil, errors.Wrapf(err, "collect %s", source.name)
+	}
+	if len(rows) == 0 {
+		// ids restart from 0 after the observer restarted
+		maxId, err := s.queryMaxId(ctx, source)
+		if err == nil && maxId < source.cursor {
+			log.WithContext(ctx).Infof("%s cursor reset from %d to %d", source.name, source.cursor, maxId)
+			source.cursor = maxId
+		}
+		return nil, nil
+	}
+	for _, row := range rows {
+		if id, ok := utils.ConvertToFloat64(row[source.cursorColumn]); ok && int64(id) > source.cursor {
+			source.cursor = int64(id)
+		}
+	}
+	return rows, nil
+}
+
+func (s *SqlAuditInput) queryMaxId(ctx context.Context, source *incrementalSource) (int64, error) {
+	rows, err := s.queryRows(ctx, source.maxSql, s.Config.ObSvrIp, s.Config.ObSvrPort)
+	if err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	for _, v := range rows[0] {
+		maxId, _ := utils.ConvertToFloat64(v)
+		return int64(maxId), nil
+	}
+	return 0, nil
+}
+
+func (s *SqlAuditInput) dbQueryRows(ctx context.Context, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	results, err := s.Db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+	columns, err := results.Columns()
+	if err != nil {
+		return nil, errors.Errorf("get columns failed, err: %s", err)
+	}
+	values := make([]interface{}, len(columns))
+	valuePtrs := make([]interface{}, len(columns))
+	for i := range columns {
+		valuePtrs[i] = &values[i]
+	}
+	ret := make([]map[string]interface{}, 0)
+	for results.Next() {
+		if err = results.Scan(valuePtrs...); err != nil {
+			return nil, errors.Wrap(err, "sql results scan value")
+		}
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			row[strings.ToLower(column)] = values[i]
+		}
+		ret = append(ret, row)
+	}
+	return ret, results.Err()
+}
+
+func toString(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	str, _ := utils.ConvertToString(v)
+	return str
+}
+
+func toFloat64(v interface{}) float64 {
+	f, _ := utils.ConvertToFloat64(v)
+	return f
+}
+
+var sqlAuditTagColumns = []string{"svr_ip", "svr_port", "tenant_id", "tenant_name", "user_name", "db_name", "sql_id", "plan_id"}
+
+type sqlAuditStat struct {
+	tags []message.TagEntry
+	// querySql the first seen sql text of the sql id
+	querySql       string
+	execCount      float64
+	failCount      float64
+	elapsedTimeSum float64
+	elapsedTimeMax float64
+	executeTimeSum float64
+	cpuTimeSum     float64
+	waitTimeSum    float64
+	returnRowsSum  float64
+	affectedRowSum float64
+	retryCountSum  float64
+}
+
+// aggregateSqlAudit aggregates sql audit rows by server, tenant, user, db, sql id and plan id,
+// times are in microseconds as they are in GV$OB_SQL_AUDIT
+func aggregateSqlAudit(rows []map[string]interface{}, maxSqlTextLength int, t time.Time) []*message.Message {
+	stats := make(map[string]*sqlAuditStat)
+	keys := make([]string, 0)
+	for _, row := range rows {
+		tags := make([]message.TagEntry, 0, len(sqlAuditTagColumns))
+		values := make([]string, 0, len(sqlAuditTagColumns))
+		for _, column := range sqlAuditTagColumns {
+			value := toString(row[column])
+			values = append(values, value)
+			if value != "" {
+				tags = append(tags, message.TagEntry{Name: column, Value: value})
+			}
+		}
+		key := strings.Join(values, "\x00")
+		st, ok := stats[key]
+		if !ok {
+			st = &sqlAuditStat{tags: tags, querySql: toString(row["query_sql"])}
+			if maxSqlTextLength > 0 && len(st.querySql) > maxSqlTextLength {
+				st.querySql = st.querySql[:maxSqlTextLength]
+			}
+			stats[key] = st
+			keys = append(keys, key)
+		}
+		elapsedTime := toFloat64(row["elapsed_time"])
+		executeTime := toFloat64(row["execute_time"])
+		waitTime := toFloat64(row["total_wait_time_micro"])
+		st.execCount++
+		if toFloat64(row["ret_code"]) != 0 {
+			st.failCount++
+		}
+		st.elapsedTimeSum += elapsedTime
+		if elapsedTime > st.elapsedTimeMax {
+			st.elapsedTimeMax = elapsedTime
+		}
+		st.executeTimeSum += executeTime
+		if executeTime > waitTime {
+			st.cpuTimeSum += executeTime - waitTime
+		}
+		st.waitTimeSum += waitTime
+		st.returnRowsSum += toFloat64(row["return_rows"])
+		st.affectedRowSum += toFloat64(row["affected_rows"])
+		st.retryCountSum += toFloat64(row["retry_cnt"])
+	}
+	sort.Strings(keys)
+	msgs := make([]*message.Message, 0, len(keys))
+	for _, key := range keys {
+		st := stats[key]
+		msg := message.NewMessageWithTagsFields(sqlAuditMetricName, message.Log, t, st.tags, []message.FieldEntry{
+			{Name: "query_sql", Value: st.querySql},
+			{Name: "exec_count", Value: st.execCount},
+			{Name: "fail_count", Value: st.failCount},
+			{Name: "elapsed_time_sum", Value: st.elapsedTimeSum},
+			{Name: "elapsed_time_max", Value: st.elapsedTimeMax},
+			{Name: "execute_time_sum", Value: st.executeTimeSum},
+			{Name: "cpu_time_sum", Value: st.cpuTimeSum},
+			{Name: "wait_time_sum", Value: st.waitTimeSum},
+			{Name: "return_rows_sum", Value: st.returnRowsSum},
+			{Name: "affected_rows_sum", Value: st.affectedRowSum},
+			{Name: "retry_count_sum", Value: st.retryCountSum},
+		})
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+var ashTagColumns = []string{"svr_ip", "svr_port", "con_id", "session_type", "session_state", "sql_id", "plan_id", "trace_id", "event", "wait_class"}
+
+// convertAshRows converts each sampled session to a message at its sample time
+func convertAshRows(rows []map[string]interface{}, now time.Time) []*message.Message {
+	msgs := make([]*message.Message, 0, len(rows))
+	for _, row := range rows {
+		t, err := time.ParseInLocation(ashTimeLayout, toString(row["sample_time"]), time.Local)
+		if err != nil {
+			t = now
+		}
+		msg := message.NewMessage(ashMetricName, message.Log, t)
+		for _, column := range ashTagColumns {
+			if value := toString(row[column]); value != "" {
+				name := column
+				if column == "con_id" {
+					name = "tenant_id"
+				}
+				msg.AddTag(name, value)
+			}
+		}
+		msg.AddField("sample_id", toFloat64(row["sample_id"])).
+			AddField("user_id", toFloat64(row["user_id"])).
+			AddField("session_id", toFloat64(row["session_id"])).
+			AddField("time_waited", toFloat64(row["time_waited"]))
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
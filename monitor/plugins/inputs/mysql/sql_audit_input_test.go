@@ -0,0 +1,187 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oceanbase/obagent/monitor/message"
+	"github.com/oceanbase/obagent/monitor/plugins/common"
+	"github.com/oceanbase/obagent/monitor/utils"
+)
+
+// fakeAuditDb serves the queries of SqlAuditInput from in memory rows of one server
+type fakeAuditDb struct {
+	maxRequestId int64
+	audits       []map[string]interface{}
+	queried      []int64
+	servers      []string
+}
+
+func (f *fakeAuditDb) queryRows(ctx context.Context, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	f.servers = append(f.servers, fmt.Sprintf("%v:%v", args[0], args[1]))
+	switch {
+	case query == selectSqlAuditMaxRequestId:
+		return []map[string]interface{}{{"max(request_id)": f.maxRequestId}}, nil
+	case strings.Contains(query, "from GV$OB_SQL_AUDIT"):
+		cursor := args[2].(int64)
+		f.queried = append(f.queried, cursor)
+		ret := make([]map[string]interface{}, 0)
+		for _, row := range f.audits {
+			if row["request_id"].(int64) > cursor {
+				ret = append(ret, row)
+			}
+		}
+		return ret, nil
+	}
+	return nil, nil
+}
+
+func newTestSqlAuditInput(t *testing.T, db *fakeAuditDb, config string) *SqlAuditInput {
+	configMap, err := utils.DecodeYaml(config)
+	require.Nil(t, err)
+	input := &SqlAuditInput{queryRows: db.queryRows}
+	require.Nil(t, input.Init(context.Background(), configMap))
+	input.Ob = &common.Observer{MetaInfo: &common.ObserverMetaInfo{Version: "4.2.1.0"}}
+	return input
+}
+
+func auditRow(requestId int64, sqlId string, elapsed int64, retCode int64) map[string]interface{} {
+	return map[string]interface{}{
+		"svr_ip": "10.0.0.1", "svr_port": int64(2882), "request_id": requestId,
+		"tenant_id": int64(1002), "tenant_name": []byte("t1"), "user_name": "root", "db_name": nil,
+		"sql_id": sqlId, "plan_id": int64(1), "query_sql": []byte("select * from t where id = 1"),
+		"ret_code": retCode, "elapsed_time": elapsed, "execute_time": elapsed - 10, "total_wait_time_micro": int64(5),
+		"return_rows": int64(1), "affected_rows": int64(0), "retry_cnt": int64(0),
+	}
+}
+
+func TestSqlAuditInput_incremental(t *testing.T) {
+	db := &fakeAuditDb{maxRequestId: 10}
+	input := newTestSqlAuditInput(t, db, `
+ob_svr_ip: 10.0.0.1
+ob_svr_port: 2882
+sqlAudit:
+  enabled: true
+  minObVersion: 4.0.0.0
+`)
+	// the first collect only remembers the newest request id
+	msgs, err := input.CollectMsgs(context.Background())
+	require.Nil(t, err)
+	require.Equal(t, 0, len(msgs))
+	require.Equal(t, 0, len(db.queried))
+
+	db.audits = []map[string]interface{}{
+		auditRow(11, "A", 100, 0),
+		auditRow(12, "A", 300, -4012),
+		auditRow(13, "B", 50, 0),
+	}
+	msgs, err = input.CollectMsgs(context.Background())
+	require.Nil(t, err)
+	require.Equal(t, 2, len(msgs))
+	require.Equal(t, []int64{10}, db.queried)
+	require.Equal(t, message.Log, msgs[0].GetMetricType())
+	sqlId, _ := msgs[0].GetTag("sql_id")
+	require.Equal(t, "A", sqlId)
+	tenant, _ := msgs[0].GetTag("tenant_name")
+	require.Equal(t, "t1", tenant)
+	_, found := msgs[0].GetTag("db_name")
+	require.False(t, found)
+	count, _ := msgs[0].GetField("exec_count")
+	require.Equal(t, 2.0, count)
+	fail, _ := msgs[0].GetField("fail_count")
+	require.Equal(t, 1.0, fail)
+	elapsed, _ := msgs[0].GetField("elapsed_time_sum")
+	require.Equal(t, 400.0, elapsed)
+	elapsedMax, _ := msgs[0].GetField("elapsed_time_max")
+	require.Equal(t, 300.0, elapsedMax)
+	cpu, _ := msgs[0].GetField("cpu_time_sum")
+	require.Equal(t, 370.0, cpu)
+	querySql, _ := msgs[0].GetField("query_sql")
+	require.Equal(t, "select * from t where id = 1", querySql)
+
+	// only newer rows are read
+	msgs, _ = input.CollectMsgs(context.Background())
+	require.Equal(t, 0, len(msgs))
+	require.Equal(t, []int64{10, 13}, db.queried)
+
+	// request ids restart after the observer restarted
+	db.audits = nil
+	db.maxRequestId = 2
+	_, _ = input.CollectMsgs(context.Background())
+	db.audits = []map[string]interface{}{auditRow(3, "C", 10, 0)}
+	msgs, _ = input.CollectMsgs(context.Background())
+	require.Equal(t, 1, len(msgs))
+	for _, server := range db.servers {
+		require.Equal(t, "10.0.0.1:2882", server)
+	}
+}
+
+func TestSqlAuditInput_versionGating(t *testing.T) {
+	db := &fakeAuditDb{}
+	input := newTestSqlAuditInput(t, db, `
+ob_svr_ip: 10.0.0.1
+ob_svr_port: 2882
+sqlAudit:
+  enabled: true
+  minObVersion: 4.3.0.0
+`)
+	msgs, err := input.CollectMsgs(context.Background())
+	require.Nil(t, err)
+	require.Equal(t, 0, len(msgs))
+	require.False(t, input.sqlAudit.started)
+	require.Equal(t, 0, len(db.servers))
+}
+
+func TestSqlAuditInput_localServerRequired(t *testing.T) {
+	configMap, err := utils.DecodeYaml(`
+sqlAudit:
+  enabled: true
+`)
+	require.Nil(t, err)
+	input := &SqlAuditInput{queryRows: (&fakeAuditDb{}).queryRows}
+	require.NotNil(t, input.Init(context.Background(), configMap))
+}
+
+func TestAggregateSqlAudit_truncate(t *testing.T) {
+	msgs := aggregateSqlAudit([]map[string]interface{}{auditRow(1, "A", 10, 0)}, 6, time.Now())
+	require.Equal(t, 1, len(msgs))
+	querySql, _ := msgs[0].GetField("query_sql")
+	require.Equal(t, "select", querySql)
+}
+
+func TestConvertAshRows(t *testing.T) {
+	now := time.Now()
+	msgs := convertAshRows([]map[string]interface{}{
+		{"svr_ip": "10.0.0.1", "svr_port": int64(2882), "sample_id": int64(7), "sample_time": []byte("2023-05-01 10:00:00.123456"),
+			"con_id": int64(1002), "session_id": int64(3221487617), "session_state": "WAITING", "event": "palf write",
+			"wait_class": "SYSTEM_IO", "sql_id": nil, "time_waited": int64(100)},
+		{"sample_id": int64(8), "sample_time": nil},
+	}, now)
+	require.Equal(t, 2, len(msgs))
+	expected, _ := time.ParseInLocation(ashTimeLayout, "2023-05-01 10:00:00.123456", time.Local)
+	require.Equal(t, expected, msgs[0].GetTime())
+	tenant, _ := msgs[0].GetTag("tenant_id")
+	require.Equal(t, "1002", tenant)
+	_, found := msgs[0].GetTag("sql_id")
+	require.False(t, found)
+	waited, _ := msgs[0].GetField("time_waited")
+	require.Equal(t, 100.0, waited)
+	require.Equal(t, now, msgs[1].GetTime())
+}
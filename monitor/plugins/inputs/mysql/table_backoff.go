@@ -0,0 +1,193 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package mysql
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oceanbase/obagent/stat"
+)
+
+const (
+	skipReasonStretched   = "stretched"
+	skipReasonLowPriority = "low_priority"
+	skipReasonPaused      = "paused"
+)
+
+// BackoffConfig reduces the load of collecting when the database is struggling:
+// the interval of a slow or failed sql is doubled up to MaxFactor times, and halved back after it recovers;
+// sqls with priority not less than SkipPriority are skipped while the database is overloaded, except one probe each round;
+// a sql timed out PauseAfterTimeouts times in a row is paused for PauseDuration.
+type BackoffConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// SlowThreshold a sql slower than it is regarded as slow, default 1s
+	SlowThreshold time.Duration `yaml:"slowThreshold"`
+	// QueryTimeout timeout of a sql, default 10s
+	QueryTimeout time.Duration `yaml:"queryTimeout"`
+	// MaxFactor max factor to stretch the collect interval, default 8
+	MaxFactor int `yaml:"maxFactor"`
+	// OverloadRatio the database is overloaded when the ratio of slow or failed sqls in a round reaches it, default 0.5
+	OverloadRatio float64 `yaml:"overloadRatio"`
+	// SkipPriority sqls with priority not less than it are skipped while overloaded, default 1
+	SkipPriority int `yaml:"skipPriority"`
+	// PauseAfterTimeouts consecutive timeouts to pause a sql, default 3
+	PauseAfterTimeouts int `yaml:"pauseAfterTimeouts"`
+	// PauseDuration default 10m
+	PauseDuration time.Duration `yaml:"pauseDuration"`
+}
+
+func (c *BackoffConfig) init() {
+	if c.SlowThreshold <= 0 {
+		c.SlowThreshold = time.Second
+	}
+	if c.QueryTimeout <= 0 {
+		c.QueryTimeout = 10 * time.Second
+	}
+	if c.MaxFactor <= 0 {
+		c.MaxFactor = 8
+	}
+	if c.OverloadRatio <= 0 {
+		c.OverloadRatio = 0.5
+	}
+	if c.SkipPriority <= 0 {
+		c.SkipPriority = 1
+	}
+	if c.PauseAfterTimeouts <= 0 {
+		c.PauseAfterTimeouts = 3
+	}
+	if c.PauseDuration <= 0 {
+		c.PauseDuration = 10 * time.Minute
+	}
+}
+
+type queryBackoffState struct {
+	factor              int
+	rounds              int
+	consecutiveTimeouts int
+	pausedUntil         time.Time
+}
+
+type tableBackoff struct {
+	config *BackoffConfig
+	target string
+
+	lock       sync.Mutex
+	states     map[string]*queryBackoffState
+	overloaded bool
+	// probed a low priority sql is run in this round while overloaded
+	probed    bool
+	executed  int
+	struggled int
+}
+
+func newTableBackoff(config *BackoffConfig, target string) *tableBackoff {
+	config.init()
+	return &tableBackoff{
+		config: config,
+		target: target,
+		states: make(map[string]*queryBackoffState),
+	}
+}
+
+func (b *tableBackoff) state(name string) *queryBackoffState {
+	s, ok := b.states[name]
+	if !ok {
+		s = &queryBackoffState{factor: 1}
+		b.states[name] = s
+	}
+	return s
+}
+
+// shouldRun decides whether to run the sql in this round, a reason is returned when skipped
+func (b *tableBackoff) shouldRun(config *TableCollectConfig, now time.Time) (bool, string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	s := b.state(config.Name)
+	reason := ""
+	if now.Before(s.pausedUntil) {
+		reason = skipReasonPaused
+	} else if b.overloaded && config.Priority >= b.config.SkipPriority && b.probed {
+		reason = skipReasonLowPriority
+	} else {
+		s.rounds++
+		if s.rounds%s.factor != 0 {
+			reason = skipReasonStretched
+		} else if b.overloaded && config.Priority >= b.config.SkipPriority {
+			// one low priority sql runs in each round, so the overload is still detected
+			// and recovered when all the sqls are low priority
+			b.probed = true
+		}
+	}
+	if reason != "" {
+		stat.MonitorAgentTableInputSkipTotal.WithLabelValues(config.Name, reason).Inc()
+		return false, reason
+	}
+	return true, ""
+}
+
+// observe adjusts the interval of the sql by its duration and error, timedOut means the sql exceeded QueryTimeout
+func (b *tableBackoff) observe(ctx context.Context, config *TableCollectConfig, duration time.Duration, err error, timedOut bool, now time.Time) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	s := b.state(config.Name)
+	b.executed++
+	if timedOut {
+		s.consecutiveTimeouts++
+		if s.consecutiveTimeouts >= b.config.PauseAfterTimeouts {
+			s.pausedUntil = now.Add(b.config.PauseDuration)
+			s.consecutiveTimeouts = 0
+			log.WithContext(ctx).Warnf("sql %s timed out %d times in a row, pause until %s", config.Name, b.config.PauseAfterTimeouts, s.pausedUntil)
+		}
+	} else {
+		s.consecutiveTimeouts = 0
+	}
+	if err != nil || timedOut || duration > b.config.SlowThreshold {
+		b.struggled++
+		if s.factor < b.config.MaxFactor {
+			s.factor *= 2
+			if s.factor > b.config.MaxFactor {
+				s.factor = b.config.MaxFactor
+			}
+			log.WithContext(ctx).Infof("sql %s is slow or failed, stretch interval by %d times", config.Name, s.factor)
+		}
+	} else if s.factor > 1 {
+		s.factor /= 2
+	}
+	s.rounds = 0
+	stat.MonitorAgentTableInputIntervalFactor.WithLabelValues(config.Name).Set(float64(s.factor))
+}
+
+// endRound decides whether the database is overloaded by the sqls executed in the round
+func (b *tableBackoff) endRound(ctx context.Context) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.executed > 0 {
+		overloaded := float64(b.struggled)/float64(b.executed) >= b.config.OverloadRatio
+		if overloaded != b.overloaded {
+			log.WithContext(ctx).Warnf("database %s overloaded changed to %v, %d of %d sqls are slow or failed", b.target, overloaded, b.struggled, b.executed)
+		}
+		b.overloaded = overloaded
+	}
+	b.executed = 0
+	b.struggled = 0
+	b.probed = false
+	value := 0.0
+	if b.overloaded {
+		value = 1.0
+	}
+	stat.MonitorAgentTableInputOverloaded.WithLabelValues(b.target).Set(value)
+}
@@ -0,0 +1,172 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package mysql
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oceanbase/obagent/monitor/utils"
+)
+
+func runRounds(b *tableBackoff, config *TableCollectConfig, rounds int, now time.Time) int {
+	ran := 0
+	for i := 0; i < rounds; i++ {
+		if ok, _ := b.shouldRun(config, now); ok {
+			ran++
+		}
+	}
+	return ran
+}
+
+func TestTableBackoff_stretch(t *testing.T) {
+	ctx := context.Background()
+	b := newTableBackoff(&BackoffConfig{Enabled: true, MaxFactor: 4}, "test")
+	config := &TableCollectConfig{Name: "q1"}
+	now := time.Now()
+
+	require.Equal(t, 4, runRounds(b, config, 4, now))
+
+	b.observe(ctx, config, 2*time.Second, nil, false, now)
+	require.Equal(t, 2, b.states["q1"].factor)
+	b.observe(ctx, config, 0, errors.New("failed"), false, now)
+	b.observe(ctx, config, 0, errors.New("failed"), false, now)
+	require.Equal(t, 4, b.states["q1"].factor)
+	ok, reason := b.shouldRun(config, now)
+	require.False(t, ok)
+	require.Equal(t, skipReasonStretched, reason)
+	require.Equal(t, 1, runRounds(b, config, 3, now))
+
+	// restore after recovered
+	b.observe(ctx, config, time.Millisecond, nil, false, now)
+	b.observe(ctx, config, time.Millisecond, nil, false, now)
+	require.Equal(t, 1, b.states["q1"].factor)
+	require.Equal(t, 4, runRounds(b, config, 4, now))
+}
+
+func TestTableBackoff_overload(t *testing.T) {
+	ctx := context.Background()
+	b := newTableBackoff(&BackoffConfig{Enabled: true}, "test")
+	important := &TableCollectConfig{Name: "important"}
+	minor := &TableCollectConfig{Name: "minor", Priority: 1}
+	now := time.Now()
+
+	b.observe(ctx, important, time.Millisecond, nil, false, now)
+	b.observe(ctx, minor, 2*time.Second, nil, false, now)
+	b.endRound(ctx)
+	require.True(t, b.overloaded)
+
+	other := &TableCollectConfig{Name: "other", Priority: 2}
+	ok, reason := b.shouldRun(minor, now)
+	require.False(t, ok)
+	require.Equal(t, skipReasonStretched, reason)
+	// the first low priority sql not stretched is the probe of the round
+	ok, _ = b.shouldRun(other, now)
+	require.True(t, ok)
+	ok, reason = b.shouldRun(minor, now)
+	require.False(t, ok)
+	require.Equal(t, skipReasonLowPriority, reason)
+	ok, _ = b.shouldRun(important, now)
+	require.True(t, ok)
+
+	b.observe(ctx, important, time.Millisecond, nil, false, now)
+	b.observe(ctx, other, time.Millisecond, nil, false, now)
+	b.endRound(ctx)
+	require.False(t, b.overloaded)
+	// minor is still stretched after recovering from overload
+	require.Equal(t, 1, runRounds(b, minor, 2, now))
+}
+
+func TestTableBackoff_recoverWithLowPriorityOnly(t *testing.T) {
+	ctx := context.Background()
+	b := newTableBackoff(&BackoffConfig{Enabled: true}, "test")
+	configs := []*TableCollectConfig{{Name: "q1", Priority: 1}, {Name: "q2", Priority: 1}}
+	now := time.Now()
+
+	for _, config := range configs {
+		b.observe(ctx, config, 2*time.Second, nil, false, now)
+	}
+	b.endRound(ctx)
+	require.True(t, b.overloaded)
+
+	// the database recovered, the probes are fast
+	for round := 0; round < 4 && b.overloaded; round++ {
+		for _, config := range configs {
+			if ok, _ := b.shouldRun(config, now); ok {
+				b.observe(ctx, config, time.Millisecond, nil, false, now)
+			}
+		}
+		b.endRound(ctx)
+	}
+	require.False(t, b.overloaded)
+}
+
+func TestTableBackoff_pause(t *testing.T) {
+	ctx := context.Background()
+	b := newTableBackoff(&BackoffConfig{Enabled: true, PauseAfterTimeouts: 2, PauseDuration: time.Minute}, "test")
+	config := &TableCollectConfig{Name: "q1"}
+	now := time.Now()
+
+	b.observe(ctx, config, time.Second, context.DeadlineExceeded, true, now)
+	b.observe(ctx, config, time.Millisecond, nil, false, now)
+	b.observe(ctx, config, time.Second, context.DeadlineExceeded, true, now)
+	require.True(t, b.states["q1"].pausedUntil.IsZero())
+	b.observe(ctx, config, time.Second, context.DeadlineExceeded, true, now)
+
+	ok, reason := b.shouldRun(config, now.Add(30*time.Second))
+	require.False(t, ok)
+	require.Equal(t, skipReasonPaused, reason)
+	require.True(t, runRounds(b, config, 8, now.Add(2*time.Minute)) > 0)
+}
+
+func TestCollectWithBackoff(t *testing.T) {
+	config := `
+      connection:
+        url: user:pass@tcp(127.0.0.1:9878)/oceanbase?interpolateParams=true
+        maxIdle: 2
+        maxOpen: 32
+      backoff:
+        enabled: true
+        overloadRatio: 0.6
+      collectConfig:
+        - sql: select t1, m2 from test_metric
+          name: test_backoff
+          tags:
+            tag1: t1
+          metrics:
+            metric2: m2
+        - sql: select t1, m2 from not_exist_table
+          name: test_backoff_failed
+          priority: 1
+          tags:
+            tag1: t1
+          metrics:
+            metric2: m2
+    `
+	configMap, _ := utils.DecodeYaml(config)
+	tableInput := &TableInput{}
+	require.Nil(t, tableInput.Init(context.Background(), configMap))
+	defer tableInput.Stop()
+	require.NotNil(t, tableInput.backoff)
+	require.Equal(t, 10*time.Second, tableInput.backoff.config.QueryTimeout)
+
+	metrics, err := tableInput.CollectMsgs(context.Background())
+	require.Nil(t, err)
+	require.Equal(t, 4, len(metrics))
+	require.Equal(t, 2, tableInput.backoff.states["test_backoff_failed"].factor)
+	require.False(t, tableInput.backoff.overloaded)
+}
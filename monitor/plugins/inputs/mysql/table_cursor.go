@@ -0,0 +1,323 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package mysql
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oceanbase/obagent/errors"
+	"github.com/oceanbase/obagent/monitor/message"
+	"github.com/oceanbase/obagent/monitor/utils"
+)
+
+const (
+	CursorTypeId        = "id"
+	CursorTypeTimestamp = "timestamp"
+)
+
+const cursorTimeLayout = "2006-01-02 15:04:05.999999"
+
+// CursorConfig incremental collect of append-only tables, the last value of the cursor column is bound to
+// the last ? of the sql, e.g. select * from __all_server_event_history where id > ? order by id limit 1000
+//
+// Timestamps are not unique, with `gmt_create > ? ... limit N` the rows sharing the last timestamp of a batch
+// but not returned in it are skipped forever. Set DedupColumn and use `gmt_create >= ?` instead, e.g.
+// select * from __all_rootservice_event_history where gmt_create >= ? order by gmt_create limit 1000
+type CursorConfig struct {
+	// Column monotonic column of the result
+	Column string `yaml:"column"`
+	// Type id or timestamp, default id. rows are emitted at the time of a timestamp cursor
+	Type string `yaml:"type"`
+	// InitialValue cursor value when no position is stored, default 0 for id and 1970-01-01 00:00:00 for timestamp
+	InitialValue string `yaml:"initialValue"`
+	// DedupColumn unique column of the rows, e.g. id. rows at the cursor value already emitted are skipped by it,
+	// so the sql can use >= for a non-unique cursor column. the limit must exceed the rows sharing a cursor value.
+	DedupColumn string `yaml:"dedupColumn"`
+}
+
+// CursorInfo persistence of the cursor values of a collect config, by tenant name when collected from each tenant
+type CursorInfo struct {
+	Name   string            `json:"name"`
+	Values map[string]string `json:"values"`
+	// Emitted values of the dedup column of the rows at the cursor value
+	Emitted   map[string][]string `json:"emitted,omitempty"`
+	UpdatedAt time.Time           `json:"updatedAt"`
+}
+
+type tableCursor struct {
+	name     string
+	config   *CursorConfig
+	storeDir string
+	readOnly bool
+
+	lock    sync.Mutex
+	values  map[string]string
+	emitted map[string]map[string]bool
+}
+
+// cursorBatch rows of one query, the cursor is advanced when the batch is committed
+type cursorBatch struct {
+	key      string
+	start    string
+	emitted  map[string]bool
+	maxValue string
+	maxDedup []string
+}
+
+func (c *CursorConfig) init() error {
+	if c.Column == "" {
+		return errors.New("cursor column not set")
+	}
+	switch c.Type {
+	case "":
+		c.Type = CursorTypeId
+	case CursorTypeId, CursorTypeTimestamp:
+	default:
+		return errors.Errorf("unknown cursor type %s", c.Type)
+	}
+	if c.InitialValue == "" {
+		if c.Type == CursorTypeId {
+			c.InitialValue = "0"
+		} else {
+			c.InitialValue = "1970-01-01 00:00:00"
+		}
+	}
+	return nil
+}
+
+// newTableCursor a read-only cursor starts from the stored position, but only advances in memory
+func newTableCursor(ctx context.Context, name string, config *CursorConfig, storeDir string, readOnly bool) (*tableCursor, error) {
+	if err := config.init(); err != nil {
+		return nil, errors.Wrapf(err, "collect config %s", name)
+	}
+	c := &tableCursor{
+		name:     name,
+		config:   config,
+		storeDir: storeDir,
+		readOnly: readOnly,
+		values:   make(map[string]string),
+		emitted:  make(map[string]map[string]bool),
+	}
+	if err := c.load(); err != nil {
+		log.WithContext(ctx).Warnf("load cursor of %s failed, start from %s, reason: %s", name, config.InitialValue, err)
+	}
+	return c, nil
+}
+
+func (c *tableCursor) storePath() string {
+	return filepath.Join(c.storeDir, "table_cursor_"+c.name+".json")
+}
+
+func (c *tableCursor) load() error {
+	if c.storeDir == "" {
+		return nil
+	}
+	content, err := ioutil.ReadFile(c.storePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	info := &CursorInfo{}
+	if err = json.Unmarshal(content, info); err != nil {
+		return err
+	}
+	for k, v := range info.Values {
+		c.values[k] = v
+	}
+	for k, dedupValues := range info.Emitted {
+		c.emitted[k] = toSet(dedupValues)
+	}
+	return nil
+}
+
+// store writes to a temp file and renames it, so a crash never leaves a broken file
+func (c *tableCursor) store() error {
+	if c.storeDir == "" || c.readOnly {
+		return nil
+	}
+	info := &CursorInfo{Name: c.name, Values: c.values, UpdatedAt: time.Now()}
+	if len(c.emitted) > 0 {
+		info.Emitted = make(map[string][]string, len(c.emitted))
+		for k, set := range c.emitted {
+			info.Emitted[k] = fromSet(set)
+		}
+	}
+	content, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(c.storeDir, 0755); err != nil {
+		return err
+	}
+	tmpPath := c.storePath() + ".tmp"
+	if err = ioutil.WriteFile(tmpPath, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, c.storePath())
+}
+
+func (c *tableCursor) newBatch(key string) *cursorBatch {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	start, ok := c.values[key]
+	if !ok {
+		start = c.config.InitialValue
+	}
+	return &cursorBatch{key: key, start: start, emitted: c.emitted[key]}
+}
+
+// add returns false if the row was emitted by the last batches
+func (c *tableCursor) add(batch *cursorBatch, value string, row map[string]interface{}) bool {
+	dedupValue := ""
+	if c.config.DedupColumn != "" {
+		dedupValue, _ = utils.ConvertToString(row[c.config.DedupColumn])
+		if c.equal(value, batch.start) && batch.emitted[dedupValue] {
+			return false
+		}
+	}
+	if batch.maxValue == "" || c.less(batch.maxValue, value) {
+		batch.maxValue = value
+		batch.maxDedup = batch.maxDedup[:0]
+	}
+	if c.config.DedupColumn != "" && c.equal(value, batch.maxValue) {
+		batch.maxDedup = append(batch.maxDedup, dedupValue)
+	}
+	return true
+}
+
+// commit moves the cursor forward to the max value of the batch and persists it
+func (c *tableCursor) commit(ctx context.Context, batch *cursorBatch) {
+	if batch.maxValue == "" {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	current, ok := c.values[batch.key]
+	if ok && c.less(batch.maxValue, current) {
+		return
+	}
+	if ok && c.equal(current, batch.maxValue) {
+		if len(batch.maxDedup) == 0 {
+			return
+		}
+		emitted := c.emitted[batch.key]
+		if emitted == nil {
+			emitted = make(map[string]bool)
+			c.emitted[batch.key] = emitted
+		}
+		for _, v := range batch.maxDedup {
+			emitted[v] = true
+		}
+	} else {
+		c.values[batch.key] = batch.maxValue
+		if len(batch.maxDedup) > 0 {
+			c.emitted[batch.key] = toSet(batch.maxDedup)
+		} else {
+			delete(c.emitted, batch.key)
+		}
+	}
+	if err := c.store(); err != nil {
+		log.WithContext(ctx).Warnf("store cursor of %s failed, reason: %s", c.name, err)
+	}
+}
+
+// valueOf the cursor value of a row, returns false if the column is null or of an unsupported type
+func (c *tableCursor) valueOf(row map[string]interface{}) (string, bool) {
+	v, ok := row[c.config.Column]
+	if !ok || v == nil {
+		return "", false
+	}
+	switch value := v.(type) {
+	case []byte:
+		return string(value), true
+	case string:
+		return value, true
+	case time.Time:
+		return value.Format(cursorTimeLayout), true
+	case int64:
+		return strconv.FormatInt(value, 10), true
+	case uint64:
+		return strconv.FormatUint(value, 10), true
+	default:
+		return "", false
+	}
+}
+
+func (c *tableCursor) less(a, b string) bool {
+	if c.config.Type == CursorTypeId {
+		ia, errA := strconv.ParseInt(a, 10, 64)
+		ib, errB := strconv.ParseInt(b, 10, 64)
+		if errA == nil && errB == nil {
+			return ia < ib
+		}
+	} else {
+		ta, errA := time.ParseInLocation(cursorTimeLayout, a, time.Local)
+		tb, errB := time.ParseInLocation(cursorTimeLayout, b, time.Local)
+		if errA == nil && errB == nil {
+			return ta.Before(tb)
+		}
+	}
+	return a < b
+}
+
+func (c *tableCursor) equal(a, b string) bool {
+	return !c.less(a, b) && !c.less(b, a)
+}
+
+// timeOf the time to emit a row, only timestamp cursors have one
+func (c *tableCursor) timeOf(value string) (time.Time, bool) {
+	if c.config.Type != CursorTypeTimestamp {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation(cursorTimeLayout, value, time.Local)
+	return t, err == nil
+}
+
+// cursorKey cursors of a collect config are kept by tenant when collected from each tenant
+func cursorKey(extraTags []message.TagEntry) string {
+	for _, tag := range extraTags {
+		if tag.Name == "tenant_name" {
+			return tag.Value
+		}
+	}
+	return ""
+}
+
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
+
+func fromSet(set map[string]bool) []string {
+	values := make([]string, 0, len(set))
+	for v := range set {
+		values = append(values, v)
+	}
+	sort.Strings(values)
+	return values
+}
@@ -0,0 +1,213 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package mysql
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oceanbase/obagent/monitor/message"
+	"github.com/oceanbase/obagent/monitor/utils"
+)
+
+func cursorTableInput(t *testing.T, storeDir string) *TableInput {
+	config := `
+      connection:
+        url: user:pass@tcp(127.0.0.1:9878)/oceanbase?interpolateParams=true
+        maxIdle: 2
+        maxOpen: 32
+      cursorStoreDir: ` + storeDir + `
+      collectConfig:
+        - sql: select t1, t2, m1, m2 from test_metric where m2 > ? order by m2 limit 2
+          name: test_event
+          cursor:
+            column: m2
+          tags:
+            tag1: t1
+          metrics:
+            metric1: m1
+    `
+	configMap, _ := utils.DecodeYaml(config)
+	tableInput := &TableInput{}
+	require.Nil(t, tableInput.Init(context.Background(), configMap))
+	return tableInput
+}
+
+func collectM2(t *testing.T, tableInput *TableInput) []float64 {
+	metrics, err := tableInput.CollectMsgs(context.Background())
+	require.Nil(t, err)
+	ret := make([]float64, 0, len(metrics))
+	for _, metric := range metrics {
+		require.Equal(t, message.Log, metric.GetMetricType())
+		t2, found := metric.GetField("t2")
+		require.True(t, found)
+		require.IsType(t, "", t2)
+		m2, _ := metric.GetField("m2")
+		v, _ := utils.ConvertToFloat64(m2)
+		ret = append(ret, v)
+	}
+	sort.Float64s(ret)
+	return ret
+}
+
+func TestCollectWithCursor(t *testing.T) {
+	storeDir, err := ioutil.TempDir("", "table_cursor")
+	require.Nil(t, err)
+	defer os.RemoveAll(storeDir)
+
+	tableInput := cursorTableInput(t, storeDir)
+	require.Equal(t, []float64{1, 2}, collectM2(t, tableInput))
+	require.Equal(t, []float64{3, 4}, collectM2(t, tableInput))
+	require.Equal(t, []float64{}, collectM2(t, tableInput))
+	tableInput.Stop()
+
+	// the cursor is recovered after restart
+	tableInput = cursorTableInput(t, storeDir)
+	defer tableInput.Stop()
+	require.Equal(t, "4", cursorValue(tableInput.cursors["test_event"], ""))
+	require.Equal(t, []float64{}, collectM2(t, tableInput))
+}
+
+func TestCollectWithUnusableCursor(t *testing.T) {
+	config := `
+      connection:
+        url: user:pass@tcp(127.0.0.1:9878)/oceanbase?interpolateParams=true
+        maxIdle: 2
+        maxOpen: 32
+      cursorStoreDir: ` + t.TempDir() + `
+      collectConfig:
+        - sql: select t1, m1, m2, null as c from test_metric where m2 > ? order by m2 limit 2
+          name: test_event
+          cursor:
+            column: c
+          tags:
+            tag1: t1
+          metrics:
+            metric1: m1
+    `
+	configMap, _ := utils.DecodeYaml(config)
+	tableInput := &TableInput{}
+	require.Nil(t, tableInput.Init(context.Background(), configMap))
+	defer tableInput.Stop()
+
+	// rows without a cursor value are skipped instead of being emitted again every interval
+	metrics, err := tableInput.CollectMsgs(context.Background())
+	require.Nil(t, err)
+	require.Empty(t, metrics)
+	require.Equal(t, "0", cursorValue(tableInput.cursors["test_event"], ""))
+}
+
+func cursorValue(c *tableCursor, key string) string {
+	return c.newBatch(key).start
+}
+
+func advanceCursor(c *tableCursor, key string, value string) {
+	batch := c.newBatch(key)
+	batch.maxValue = value
+	c.commit(context.Background(), batch)
+}
+
+func TestTableCursor(t *testing.T) {
+	_, err := newTableCursor(context.Background(), "c", &CursorConfig{}, "", false)
+	require.NotNil(t, err)
+	_, err = newTableCursor(context.Background(), "c", &CursorConfig{Column: "id", Type: "unknown"}, "", false)
+	require.NotNil(t, err)
+
+	cursor, err := newTableCursor(context.Background(), "c", &CursorConfig{Column: "gmt_create", Type: CursorTypeTimestamp}, "", false)
+	require.Nil(t, err)
+	require.Equal(t, "1970-01-01 00:00:00", cursorValue(cursor, "t1"))
+	require.True(t, cursor.less("2023-05-01 10:00:00.5", "2023-05-01 10:00:00.51"))
+	require.True(t, cursor.less("2023-05-01 10:00:00", "2023-05-01 10:00:00.000001"))
+
+	at := time.Date(2023, 5, 1, 10, 0, 0, 123000000, time.Local)
+	value, ok := cursor.valueOf(map[string]interface{}{"gmt_create": at})
+	require.True(t, ok)
+	require.Equal(t, "2023-05-01 10:00:00.123", value)
+	rowTime, ok := cursor.timeOf(value)
+	require.True(t, ok)
+	require.True(t, at.Equal(rowTime))
+
+	advanceCursor(cursor, "t1", "2023-05-01 10:00:00")
+	advanceCursor(cursor, "t1", "2023-04-01 10:00:00")
+	require.Equal(t, "2023-05-01 10:00:00", cursorValue(cursor, "t1"))
+
+	idCursor, err := newTableCursor(context.Background(), "c", &CursorConfig{Column: "id"}, "", false)
+	require.Nil(t, err)
+	value, ok = idCursor.valueOf(map[string]interface{}{"id": uint64(10)})
+	require.True(t, ok)
+	require.Equal(t, "10", value)
+	_, ok = idCursor.valueOf(map[string]interface{}{"id": nil})
+	require.False(t, ok)
+	_, ok = idCursor.valueOf(map[string]interface{}{"id": 1.5})
+	require.False(t, ok)
+	require.True(t, idCursor.less("9", "10"))
+	_, ok = idCursor.timeOf("10")
+	require.False(t, ok)
+}
+
+func collectBatch(cursor *tableCursor, key string, rows [][2]interface{}) []int64 {
+	batch := cursor.newBatch(key)
+	ret := make([]int64, 0)
+	for _, row := range rows {
+		resultMap := map[string]interface{}{"gmt_create": row[0], "id": row[1]}
+		value, _ := cursor.valueOf(resultMap)
+		if cursor.add(batch, value, resultMap) {
+			ret = append(ret, row[1].(int64))
+		}
+	}
+	cursor.commit(context.Background(), batch)
+	return ret
+}
+
+func TestTableCursor_dedup(t *testing.T) {
+	storeDir := t.TempDir()
+	config := &CursorConfig{Column: "gmt_create", Type: CursorTypeTimestamp, DedupColumn: "id"}
+	cursor, err := newTableCursor(context.Background(), "c", config, storeDir, false)
+	require.Nil(t, err)
+
+	t1 := time.Date(2023, 5, 1, 10, 0, 0, 0, time.Local)
+	t2 := t1.Add(time.Second)
+	// gmt_create >= ? order by gmt_create limit 3, ids 3 and 4 share t2 with id 2
+	require.Equal(t, []int64{1, 2, 3}, collectBatch(cursor, "", [][2]interface{}{{t1, int64(1)}, {t2, int64(2)}, {t2, int64(3)}}))
+	require.Equal(t, "2023-05-01 10:00:01", cursorValue(cursor, ""))
+	require.Equal(t, []int64{4}, collectBatch(cursor, "", [][2]interface{}{{t2, int64(2)}, {t2, int64(3)}, {t2, int64(4)}}))
+
+	// emitted rows are recovered after restart
+	cursor, err = newTableCursor(context.Background(), "c", config, storeDir, false)
+	require.Nil(t, err)
+	require.Equal(t, []int64{5}, collectBatch(cursor, "", [][2]interface{}{{t2, int64(2)}, {t2, int64(3)}, {t2, int64(4)}, {t2.Add(time.Second), int64(5)}}))
+	require.Equal(t, map[string]bool{"5": true}, cursor.emitted[""])
+}
+
+func TestTableCursor_readOnly(t *testing.T) {
+	storeDir := t.TempDir()
+	cursor, err := newTableCursor(context.Background(), "c", &CursorConfig{Column: "id"}, storeDir, false)
+	require.Nil(t, err)
+	advanceCursor(cursor, "", "10")
+
+	readOnly, err := newTableCursor(context.Background(), "c", &CursorConfig{Column: "id"}, storeDir, true)
+	require.Nil(t, err)
+	require.Equal(t, "10", cursorValue(readOnly, ""))
+	advanceCursor(readOnly, "", "20")
+	require.Equal(t, "20", cursorValue(readOnly, ""))
+
+	cursor, err = newTableCursor(context.Background(), "c", &CursorConfig{Column: "id"}, storeDir, false)
+	require.Nil(t, err)
+	require.Equal(t, "10", cursorValue(cursor, ""))
+}
@@ -15,6 +15,7 @@ package mysql
 import (
 	"context"
 	"database/sql"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -37,6 +38,15 @@ connection:
   url: user:password@tcp(127.0.0.1:2881)/oceanbase?interpolateParams=true
   maxIdle: 2
   maxOpen: 32
+connections:
+  tenant1:
+    url: user@tenant1:password@tcp(127.0.0.1:2881)/oceanbase?interpolateParams=true
+    maxIdle: 1
+    maxOpen: 4
+tenantConnection:
+  url: user@{tenant}:password@tcp(127.0.0.1:2881)/oceanbase?interpolateParams=true
+  maxIdle: 1
+  maxOpen: 4
 defaultConditionValues:
   key: value
 collectConfig:
@@ -54,6 +64,28 @@ collectConfig:
     enableCache: true
     cacheExpire: 10m
     cacheDataExpire: 20m
+  - name: tenantMetricName
+    sql: select c1, c2 from t
+    forEachTenant: true
+    metrics:
+      m1: c2
+  - name: eventName
+    sql: select id, gmt_create, event from event_history where id > ? order by id limit 1000
+    cursor:
+      column: id
+      type: id
+    tags:
+      event: event
+cursorStoreDir: /home/admin/obagent/run/table_cursor
+backoff:
+  enabled: true
+  slowThreshold: 1s
+  queryTimeout: 10s
+  maxFactor: 8
+  overloadRatio: 0.5
+  skipPriority: 1
+  pauseAfterTimeouts: 3
+  pauseDuration: 10m
 `
 
 const description = `
@@ -73,14 +105,30 @@ type TableCollectConfig struct {
 	SqlSlowThreshold        time.Duration     `yaml:"sqlSlowThreshold"`
 	MinObVersion            string            `yaml:"minObVersion"`
 	MaxObVersion            string            `yaml:"maxObVersion"`
+	// Connection name of the connection to query with, empty means the default connection
+	Connection string `yaml:"connection"`
+	// ForEachTenant query in every user tenant on the observer and tag results with ob_tenant_id and tenant_name
+	ForEachTenant bool `yaml:"forEachTenant"`
+	// Cursor collect new rows only and emit them as log messages, columns not in tags and metrics are kept as fields
+	Cursor *CursorConfig `yaml:"cursor"`
+	// Priority 0 is the most important, sqls with priority not less than backoff.skipPriority are skipped while overloaded
+	Priority int `yaml:"priority"`
 }
 
 type TableInputConfig struct {
-	DbConnectionConfig       *common.DbConnectionConfig `yaml:"connection"`
+	DbConnectionConfig *common.DbConnectionConfig `yaml:"connection"`
+	// Connections named connections, e.g. users of some tenants
+	Connections map[string]*common.DbConnectionConfig `yaml:"connections"`
+	// TenantConnection connection template of user tenants, {tenant} in url is replaced by tenant name
+	TenantConnection         *common.DbConnectionConfig `yaml:"tenantConnection"`
 	DefaultConditionValueMap map[string]interface{}     `yaml:"defaultConditionValues"`
 	CollectConfigs           []*TableCollectConfig      `yaml:"collectConfig"`
 	CollectInterval          time.Duration              `yaml:"collect_interval"`
 	TimeAlign                bool                       `yaml:"timeAlign"`
+	// CursorStoreDir directory to persist cursors, cursors are kept in memory only when empty
+	CursorStoreDir string `yaml:"cursorStoreDir"`
+	// Backoff stretch intervals, skip or pause sqls when the database is overloaded
+	Backoff *BackoffConfig `yaml:"backoff"`
 }
 
 type TableInput struct {
@@ -88,35 +136,33 @@ type TableInput struct {
 	ConditionValueMap sync.Map
 	Db                *sql.DB
 	Ob                *common.Observer
+	Conns             *common.ConnectionManager
+	cursors           map[string]*tableCursor
+	backoff           *tableBackoff
 	configLocker      sync.RWMutex
+	// ReadOnlyCursors cursors are loaded but never persisted, e.g. in dry run
+	ReadOnlyCursors bool
 
 	ctx  context.Context
 	done chan struct{}
 }
 
 func (t *TableInput) initDbConnection() error {
-	db, err := sql.Open("mysql", t.Config.DbConnectionConfig.Url)
+	t.Conns = common.NewConnectionManager(t.Config.DbConnectionConfig, t.Config.Connections, t.Config.TenantConnection)
+	err := t.Conns.Init()
 	if err != nil {
 		return errors.Wrap(err, "db init")
 	}
-	db.SetMaxOpenConns(t.Config.DbConnectionConfig.MaxOpen)
-	db.SetMaxIdleConns(t.Config.DbConnectionConfig.MaxIdle)
-	timeoutCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-	err = db.PingContext(timeoutCtx)
-	t.Db = db
-	if err != nil {
-		return errors.Wrap(err, "db ping")
-	}
-	return nil
+	t.Db, err = t.Conns.Db("")
+	return err
 }
 
 func (t *TableInput) Close() error {
 	if t.done != nil {
 		close(t.done)
 	}
-	if t.Db != nil {
-		return t.Db.Close()
+	if t.Conns != nil {
+		t.Conns.Close()
 	}
 	return nil
 }
@@ -154,6 +200,22 @@ func (t *TableInput) Init(ctx context.Context, config map[string]interface{}) er
 		return err
 	}
 
+	t.cursors = make(map[string]*tableCursor)
+	for _, collectConfig := range t.Config.CollectConfigs {
+		if collectConfig.Cursor == nil {
+			continue
+		}
+		cursor, err := newTableCursor(ctx, collectConfig.Name, collectConfig.Cursor, t.Config.CursorStoreDir, t.ReadOnlyCursors)
+		if err != nil {
+			return err
+		}
+		t.cursors[collectConfig.Name] = cursor
+	}
+
+	if t.Config.Backoff != nil && t.Config.Backoff.Enabled {
+		t.backoff = newTableBackoff(t.Config.Backoff, t.Config.DbConnectionConfig.Target())
+	}
+
 	for k, v := range t.Config.DefaultConditionValueMap {
 		t.ConditionValueMap.Store(k, v)
 	}
@@ -196,8 +258,8 @@ func (t *TableInput) Stop() {
 	if t.done != nil {
 		close(t.done)
 	}
-	if t.Db != nil {
-		t.Db.Close()
+	if t.Conns != nil {
+		t.Conns.Close()
 	}
 }
 
@@ -242,7 +304,6 @@ func versionSatisfied(minVersion string, maxVersion string, obVersion string) bo
 
 func (t *TableInput) collectWithConfig(ctx context.Context, cancel context.CancelFunc, config *TableCollectConfig) ([]*message.Message, error) {
 	var metrics []*message.Message
-	currentTime := time.Now()
 
 	args := make([]interface{}, 0, 2)
 	for _, conditionValueName := range config.Params {
@@ -264,9 +325,47 @@ func (t *TableInput) collectWithConfig(ctx context.Context, cancel context.Cance
 	if !doCollect {
 		return nil, nil
 	}
+	if !config.ForEachTenant {
+		db, err := t.Conns.Db(config.Connection)
+		if err != nil {
+			return nil, err
+		}
+		return t.queryWithDb(ctx, cancel, config, db, querySql, args, nil)
+	}
+	tenantConns, err := t.Conns.TenantConnections(ctx, t.Ob)
+	if err != nil {
+		return nil, err
+	}
+	for _, conn := range tenantConns {
+		tenantTags := []message.TagEntry{
+			{Name: "ob_tenant_id", Value: strconv.FormatInt(conn.TenantId, 10)},
+			{Name: "tenant_name", Value: conn.TenantName},
+		}
+		// a table missing in one tenant does not stop collecting from others
+		tenantMetrics, err := t.queryWithDb(ctx, nil, config, conn.Db, querySql, args, tenantTags)
+		if err != nil {
+			log.WithContext(ctx).Warnf("collect %s in tenant %s failed, err: %s", config.Name, conn.TenantName, err)
+			continue
+		}
+		metrics = append(metrics, tenantMetrics...)
+	}
+	return metrics, nil
+}
+
+// queryWithDb runs the query and converts rows to messages, extraTags are added to every message.
+// The collect config is removed when the table does not exist unless cancel is nil.
+func (t *TableInput) queryWithDb(ctx context.Context, cancel context.CancelFunc, config *TableCollectConfig, db *sql.DB, querySql string, args []interface{}, extraTags []message.TagEntry) ([]*message.Message, error) {
+	var metrics []*message.Message
+	currentTime := time.Now()
+	cursor := t.cursors[config.Name]
+	var batch *cursorBatch
+	if cursor != nil {
+		batch = cursor.newBatch(cursorKey(extraTags))
+		args = append(append(make([]interface{}, 0, len(args)+1), args...), batch.start)
+	}
 	tStart := time.Now()
 	entry := log.WithContext(context.WithValue(ctx, agentlog.StartTimeKey, tStart)).WithField("query sql", querySql)
-	results, err := t.Db.QueryContext(ctx, querySql, args...)
+	results, err := db.QueryContext(ctx, querySql, args...)
 	entry.Debug("execute end")
 	duration := time.Now().Sub(tStart)
 	stat.MonitorAgentTableInputHistogram.WithLabelValues(config.Name).Observe(duration.Seconds())
@@ -275,7 +374,7 @@ func (t *TableInput) collectWithConfig(ctx context.Context, cancel context.Cance
 	}
 	if err != nil {
 		// 1146: Table xxx doesn't exist
-		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1146 {
+		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1146 && cancel != nil {
 			cancel()
 			t.deleteCollect(ctx, config)
 			log.WithContext(ctx).Warnf("collect %s, sql: %s, err: %s", config.Name, querySql, err)
@@ -312,7 +411,8 @@ func (t *TableInput) collectWithConfig(ctx context.Context, cancel context.Cance
 			resultMap[colName] = values[i]
 		}
 		fields := make([]message.FieldEntry, 0, len(config.MetricColumnMap))
-		tags := make([]message.TagEntry, 0, len(config.TagColumnMap))
+		tags := make([]message.TagEntry, 0, len(config.TagColumnMap)+len(extraTags))
+		tags = append(tags, extraTags...)
 		for metricName, metricColumnName := range config.MetricColumnMap {
 			metricValue, found := resultMap[metricColumnName]
 			if found {
@@ -335,9 +435,29 @@ func (t *TableInput) collectWithConfig(ctx context.Context, cancel context.Cance
 				}
 			}
 		}
-		metricEntry := message.NewMessageWithTagsFields(config.Name, message.Untyped, currentTime, tags, fields)
+		metricType := message.Untyped
+		metricTime := currentTime
+		if cursor != nil {
+			metricType = message.Log
+			value, ok := cursor.valueOf(resultMap)
+			if !ok {
+				log.WithContext(ctx).Warnf("cursor column %s of %s is null or not supported, value: %v, row skipped", cursor.config.Column, config.Name, resultMap[cursor.config.Column])
+				continue
+			}
+			if !cursor.add(batch, value, resultMap) {
+				continue
+			}
+			if rowTime, ok := cursor.timeOf(value); ok {
+				metricTime = rowTime
+			}
+			fields = appendUnmappedColumns(fields, config, columns, resultMap)
+		}
+		metricEntry := message.NewMessageWithTagsFields(config.Name, metricType, metricTime, tags, fields)
 		metrics = append(metrics, metricEntry)
 	}
+	if cursor != nil {
+		cursor.commit(ctx, batch)
+	}
 	for conditionName, conditionColumnName := range config.ConditionValueColumnMap {
 		if lastRow != nil {
 			conditionValue, found := (*lastRow)[conditionColumnName]
@@ -370,7 +490,18 @@ func (t *TableInput) doCollect(ctx context.Context, config *TableCollectConfig,
 	}
 
 	entry := log.WithContext(context.WithValue(ctx, agentlog.StartTimeKey, time.Now())).WithField("name", config.Name)
-	metrics, err := t.collectWithConfig(ctx, func() {}, config)
+	var metrics []*message.Message
+	var err error
+	if t.backoff != nil {
+		queryCtx, cancel := context.WithTimeout(ctx, t.backoff.config.QueryTimeout)
+		start := time.Now()
+		metrics, err = t.collectWithConfig(queryCtx, func() {}, config)
+		timedOut := queryCtx.Err() == context.DeadlineExceeded
+		cancel()
+		t.backoff.observe(ctx, config, time.Since(start), err, timedOut, time.Now())
+	} else {
+		metrics, err = t.collectWithConfig(ctx, func() {}, config)
+	}
 	entry.Debug("collect table data end")
 	if err != nil {
 		entry.Warnf("collect table err: %+v", err)
@@ -391,15 +522,46 @@ func (t *TableInput) CollectMsgs(ctx context.Context) ([]*message.Message, error
 	t.configLocker.RLock()
 	collectConfigs := t.Config.CollectConfigs
 	t.configLocker.RUnlock()
+	now := time.Now()
 	for _, collectConfig := range collectConfigs {
+		if t.backoff != nil {
+			if ok, reason := t.backoff.shouldRun(collectConfig, now); !ok {
+				log.WithContext(ctx).Debugf("skip collect %s, reason: %s", collectConfig.Name, reason)
+				continue
+			}
+		}
 		wgCollect.Add(1)
 		go t.doCollect(ctx, collectConfig, metricChan, wgCollect)
 	}
 
 	wgCollect.Wait()
+	if t.backoff != nil {
+		t.backoff.endRound(ctx)
+	}
 	log.WithContext(ctx).Debug("mysqlTableInput do collect all done")
 	close(metricChan)
 	wgRecv.Wait()
 	log.WithContext(ctx).Debug("mysqlTableInput do recv all done")
 	return metrics, nil
 }
+
+// appendUnmappedColumns keeps columns not used as tags or metrics as string fields
+func appendUnmappedColumns(fields []message.FieldEntry, config *TableCollectConfig, columns []string, row map[string]interface{}) []message.FieldEntry {
+	mapped := make(map[string]bool, len(config.TagColumnMap)+len(config.MetricColumnMap))
+	for _, column := range config.TagColumnMap {
+		mapped[column] = true
+	}
+	for _, column := range config.MetricColumnMap {
+		mapped[column] = true
+	}
+	for _, column := range columns {
+		column = strings.ToLower(column)
+		value := row[column]
+		if mapped[column] || value == nil {
+			continue
+		}
+		v, _ := utils.ConvertToString(value)
+		fields = append(fields, message.FieldEntry{Name: column, Value: v})
+	}
+	return fields
+}
@@ -14,9 +14,13 @@ package mysql
 
 import (
 	"context"
-	"github.com/oceanbase/obagent/monitor/utils"
-	"github.com/stretchr/testify/require"
 	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oceanbase/obagent/monitor/plugins/common"
+	"github.com/oceanbase/obagent/monitor/utils"
 )
 
 func TestCollect(t *testing.T) {
@@ -238,3 +242,55 @@ func TestVersionSatisfied(t *testing.T) {
 	noVersion := versionSatisfied("", "", "3.2.3")
 	require.True(t, noVersion)
 }
+
+func TestCollectForEachTenant(t *testing.T) {
+	tableInput := &TableInput{}
+
+	config := `
+      connection:
+        url: user:pass@tcp(127.0.0.1:9878)/oceanbase?interpolateParams=true
+        maxIdle: 2
+        maxOpen: 32
+      tenantConnection:
+        url: '{tenant}:pass@tcp(127.0.0.1:9878)/oceanbase?interpolateParams=true'
+        maxIdle: 1
+        maxOpen: 2
+      collectConfig:
+        - sql: select t1, m1 from test_metric
+          name: test
+          forEachTenant: true
+          tags:
+            tag1: t1
+          metrics:
+            metric1: m1
+        - sql: select t1, m1 from test_metric
+          name: test_missing_connection
+          connection: tenant1
+          metrics:
+            metric1: m1
+    `
+	configMap, _ := utils.DecodeYaml(config)
+	require.Nil(t, tableInput.Init(context.Background(), configMap))
+	defer tableInput.Stop()
+
+	_, err := tableInput.Db.Exec("create table __all_tenant (tenant_id bigint primary key, tenant_name varchar(128))")
+	require.Nil(t, err)
+	defer tableInput.Db.Exec("drop table __all_tenant")
+	_, err = tableInput.Db.Exec("insert into __all_tenant values (1, 'sys'), (1002, 'user')")
+	require.Nil(t, err)
+	db, err := sqlx.Connect("mysql", tableInput.Config.DbConnectionConfig.Url)
+	require.Nil(t, err)
+	defer db.Close()
+	tableInput.Ob = &common.Observer{Db: db, MetaInfo: &common.ObserverMetaInfo{Version: "2.2.77", AllTenantIds: []int64{1, 1002}}}
+
+	metrics, err := tableInput.CollectMsgs(context.Background())
+	require.Nil(t, err)
+	require.Equal(t, 4, len(metrics))
+	for _, metric := range metrics {
+		require.Equal(t, "test", metric.GetName())
+		tenantName, _ := metric.GetTag("tenant_name")
+		require.Equal(t, "user", tenantName)
+		tenantId, _ := metric.GetTag("ob_tenant_id")
+		require.Equal(t, "1002", tenantId)
+	}
+}
@@ -15,6 +15,8 @@ package net
 import (
 	"context"
 	"net"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -31,22 +33,60 @@ timeout: 10s
 targets:
   t1: '1.1.1.1:8080'
   t2: '2.2.2.2:8080'
+buckets: [0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5]
+probes:
+  - name: observer_sql
+    type: mysql
+    address: '1.1.1.1:2881'
+    labels:
+      zone: zone1
+  - name: obagent_http
+    type: http
+    address: 'https://1.1.1.1:8089/metrics/stat'
+    timeout: 5s
+    http:
+      expectedStatus: [200, 401]
+      bodyRegex: 'ob_'
+      insecureSkipVerify: true
+  - name: dns
+    type: dns
+    address: '1.1.1.1:53'
+    dns:
+      queryName: example.com
+  - name: syslog
+    type: udp
+    address: '1.1.1.1:514'
+    udp:
+      payload: ping
 `
 
 const description = `
 check network connectivity
 `
 
+const defaultProbeTimeout = 10 * time.Second
+
+var defaultBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
 type ConnectivityConfig struct {
-	Timeout         time.Duration     `yaml:"timeout"`
-	Targets         map[string]string `yaml:"targets"`
-	CollectInterval time.Duration     `yaml:"collect_interval"`
+	Timeout time.Duration `yaml:"timeout"`
+	// Targets plain tcp connectivity, reported as net_connectivity
+	Targets map[string]string `yaml:"targets"`
+	// Probes reported as net_probe_success, net_probe_duration_seconds and type specific gauges
+	Probes []*ProbeConfig `yaml:"probes"`
+	// Buckets upper bounds in seconds of the net_probe_duration_seconds histogram
+	Buckets         []float64     `yaml:"buckets"`
+	CollectInterval time.Duration `yaml:"collect_interval"`
 }
 
 type ConnectivityInput struct {
 	Config *ConnectivityConfig
 	ctx    context.Context
 	done   chan struct{}
+
+	// histograms of probe durations, by probe name
+	histograms map[string]*message.CumulativeHistogram
+	lock       sync.Mutex
 }
 
 func (c *ConnectivityInput) Init(ctx context.Context, config map[string]interface{}) error {
@@ -59,9 +99,29 @@ func (c *ConnectivityInput) Init(ctx context.Context, config map[string]interfac
 	if err != nil {
 		return errors.Wrap(err, "connectivity input decode config")
 	}
+	if len(pluginConfig.Buckets) == 0 {
+		pluginConfig.Buckets = defaultBuckets
+	}
+	sort.Float64s(pluginConfig.Buckets)
+	probeTimeout := pluginConfig.Timeout
+	if probeTimeout <= 0 {
+		probeTimeout = defaultProbeTimeout
+	}
+	names := make(map[string]bool, len(pluginConfig.Probes))
+	for _, probe := range pluginConfig.Probes {
+		err = probe.init(probeTimeout)
+		if err != nil {
+			return errors.Wrap(err, "connectivity input init probe")
+		}
+		if names[probe.Name] {
+			return errors.Errorf("connectivity input duplicated probe %s", probe.Name)
+		}
+		names[probe.Name] = true
+	}
 	c.Config = &pluginConfig
 	c.ctx = ctx
 	c.done = make(chan struct{})
+	c.histograms = make(map[string]*message.CumulativeHistogram)
 
 	return nil
 }
@@ -123,5 +183,65 @@ func (c *ConnectivityInput) CollectMsgs() ([]*message.Message, error) {
 			AddField("value", value)
 		metrics = append(metrics, metricEntry)
 	}
+	metrics = append(metrics, c.runProbes(ctx)...)
 	return metrics, nil
 }
+
+// runProbes runs all the probes concurrently
+func (c *ConnectivityInput) runProbes(ctx context.Context) []*message.Message {
+	results := make([]*probeResult, len(c.Config.Probes))
+	var wg sync.WaitGroup
+	for i, probe := range c.Config.Probes {
+		wg.Add(1)
+		go func(i int, probe *ProbeConfig) {
+			defer wg.Done()
+			results[i] = probe.probe(ctx)
+		}(i, probe)
+	}
+	wg.Wait()
+
+	now := time.Now()
+	metrics := make([]*message.Message, 0, len(results)*3)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for i, probe := range c.Config.Probes {
+		result := results[i]
+		newMessage := func(name string, metricType message.Type) *message.Message {
+			msg := message.NewMessage(name, metricType, now).
+				AddTag("target", probe.Name).
+				AddTag("type", string(probe.Type))
+			for k, v := range probe.Labels {
+				msg.AddTag(k, v)
+			}
+			return msg
+		}
+		success := newMessage("net_probe_success", message.Gauge)
+		if result.err != nil {
+			log.WithContext(ctx).WithError(result.err).Warnf("probe %s: %s failed", probe.Name, probe.Address)
+			success.AddTag("reason", result.reason).AddField("value", 0.0)
+		} else {
+			success.AddField("value", 1.0)
+		}
+		metrics = append(metrics, success)
+
+		h, ok := c.histograms[probe.Name]
+		if !ok {
+			h = message.NewCumulativeHistogram(c.Config.Buckets)
+			c.histograms[probe.Name] = h
+		}
+		h.Observe(result.duration.Seconds())
+		metrics = append(metrics, newMessageWithFields(newMessage("net_probe_duration_seconds", message.Histogram), h.Fields()))
+
+		for name, value := range result.gauges {
+			metrics = append(metrics, newMessage("net_probe_"+name, message.Gauge).AddField("value", value))
+		}
+	}
+	return metrics
+}
+
+func newMessageWithFields(msg *message.Message, fields []message.FieldEntry) *message.Message {
+	for _, field := range fields {
+		msg.AddField(field.Name, field.Value)
+	}
+	return msg
+}
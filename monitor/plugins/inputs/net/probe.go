@@ -0,0 +1,400 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package net
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type ProbeType string
+
+const (
+	TcpProbe   ProbeType = "tcp"
+	HttpProbe  ProbeType = "http"
+	MysqlProbe ProbeType = "mysql"
+	UdpProbe   ProbeType = "udp"
+	DnsProbe   ProbeType = "dns"
+)
+
+// failure reasons reported as tag reason
+const (
+	reasonTimeout          = "timeout"
+	reasonRefused          = "connection_refused"
+	reasonResolve          = "resolve"
+	reasonConnect          = "connect"
+	reasonTls              = "tls"
+	reasonStatus           = "unexpected_status"
+	reasonBodyMismatch     = "body_mismatch"
+	reasonHandshake        = "handshake"
+	reasonResponseMismatch = "response_mismatch"
+	reasonNoAnswer         = "no_answer"
+	reasonUnknown          = "unknown"
+)
+
+const (
+	defaultMaxBodySize      = 1 << 20
+	defaultDnsQueryName     = "localhost"
+	mysqlProtocolVersion10  = 0x0a
+	mysqlErrPacketHeader    = 0xff
+	mysqlPacketHeaderLength = 4
+)
+
+type HttpProbeConfig struct {
+	Method string            `yaml:"method"`
+	Header map[string]string `yaml:"header"`
+	// ExpectedStatus default 2xx
+	ExpectedStatus []int `yaml:"expectedStatus"`
+	// BodyRegex the response body must match when set
+	BodyRegex          string `yaml:"bodyRegex"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify"`
+
+	bodyRegex *regexp.Regexp
+}
+
+type UdpProbeConfig struct {
+	// Payload sent to the target
+	Payload string `yaml:"payload"`
+	// ExpectResponse regex the response must match, the target is not required to respond when empty
+	ExpectResponse string `yaml:"expectResponse"`
+
+	expectResponse *regexp.Regexp
+}
+
+type DnsProbeConfig struct {
+	// QueryName the name to resolve with the target dns server
+	QueryName string `yaml:"queryName"`
+}
+
+// ProbeConfig a probe to a target. Address is host:port, or url for http probes.
+type ProbeConfig struct {
+	Name    string            `yaml:"name"`
+	Type    ProbeType         `yaml:"type"`
+	Address string            `yaml:"address"`
+	Timeout time.Duration     `yaml:"timeout"`
+	Labels  map[string]string `yaml:"labels"`
+	Http    *HttpProbeConfig  `yaml:"http"`
+	Udp     *UdpProbeConfig   `yaml:"udp"`
+	Dns     *DnsProbeConfig   `yaml:"dns"`
+}
+
+// probeResult result of a probe, reason is empty on success
+type probeResult struct {
+	duration time.Duration
+	reason   string
+	err      error
+	// extra gauges like http status code, named without prefix
+	gauges map[string]float64
+}
+
+func (p *ProbeConfig) init(defaultTimeout time.Duration) error {
+	if p.Name == "" || p.Address == "" {
+		return errors.New("name or address of probe is empty")
+	}
+	if p.Timeout <= 0 {
+		p.Timeout = defaultTimeout
+	}
+	switch p.Type {
+	case "":
+		p.Type = TcpProbe
+	case TcpProbe, MysqlProbe:
+	case HttpProbe:
+		if p.Http == nil {
+			p.Http = &HttpProbeConfig{}
+		}
+		if p.Http.Method == "" {
+			p.Http.Method = http.MethodGet
+		}
+		if p.Http.BodyRegex != "" {
+			var err error
+			p.Http.bodyRegex, err = regexp.Compile(p.Http.BodyRegex)
+			if err != nil {
+				return errors.Wrapf(err, "invalid bodyRegex of probe %s", p.Name)
+			}
+		}
+	case UdpProbe:
+		if p.Udp == nil {
+			p.Udp = &UdpProbeConfig{}
+		}
+		if p.Udp.ExpectResponse != "" {
+			var err error
+			p.Udp.expectResponse, err = regexp.Compile(p.Udp.ExpectResponse)
+			if err != nil {
+				return errors.Wrapf(err, "invalid expectResponse of probe %s", p.Name)
+			}
+		}
+	case DnsProbe:
+		if p.Dns == nil {
+			p.Dns = &DnsProbeConfig{}
+		}
+		if p.Dns.QueryName == "" {
+			p.Dns.QueryName = defaultDnsQueryName
+		}
+	default:
+		return errors.Errorf("unknown type %s of probe %s", p.Type, p.Name)
+	}
+	return nil
+}
+
+func (p *ProbeConfig) probe(ctx context.Context) *probeResult {
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+	start := time.Now()
+	result := &probeResult{gauges: make(map[string]float64)}
+	var err error
+	switch p.Type {
+	case HttpProbe:
+		err = p.probeHttp(ctx, result)
+	case MysqlProbe:
+		err = p.probeMysql(ctx)
+	case UdpProbe:
+		err = p.probeUdp(ctx)
+	case DnsProbe:
+		err = p.probeDns(ctx)
+	default:
+		err = p.probeTcp(ctx)
+	}
+	result.duration = time.Since(start)
+	if err != nil {
+		result.err = err
+		result.reason = failureReason(err)
+	}
+	return result
+}
+
+// probeError an error with known reason
+type probeError struct {
+	reason string
+	err    error
+}
+
+func (e *probeError) Error() string {
+	if e.err == nil {
+		return e.reason
+	}
+	return e.reason + ": " + e.err.Error()
+}
+
+func newProbeError(reason string, err error) error {
+	return &probeError{reason: reason, err: err}
+}
+
+func failureReason(err error) string {
+	var pe *probeError
+	if errors.As(err, &pe) {
+		return pe.reason
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return reasonTimeout
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return reasonTimeout
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return reasonRefused
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return reasonResolve
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return reasonConnect
+	}
+	return reasonUnknown
+}
+
+func (p *ProbeConfig) probeTcp(ctx context.Context) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", p.Address)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func (p *ProbeConfig) probeHttp(ctx context.Context, result *probeResult) error {
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: p.Http.InsecureSkipVerify},
+			DisableKeepAlives: true,
+		},
+	}
+	req, err := http.NewRequestWithContext(ctx, p.Http.Method, p.Address, nil)
+	if err != nil {
+		return errors.Wrap(err, "create request")
+	}
+	for k, v := range p.Http.Header {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		if isTlsError(err) {
+			return newProbeError(reasonTls, err)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	result.gauges["http_status_code"] = float64(resp.StatusCode)
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		earliest := resp.TLS.PeerCertificates[0].NotAfter
+		for _, cert := range resp.TLS.PeerCertificates[1:] {
+			if cert.NotAfter.Before(earliest) {
+				earliest = cert.NotAfter
+			}
+		}
+		result.gauges["tls_cert_expiry_timestamp_seconds"] = float64(earliest.Unix())
+	}
+	if !p.statusExpected(resp.StatusCode) {
+		return newProbeError(reasonStatus, errors.Errorf("status code %d", resp.StatusCode))
+	}
+	if p.Http.bodyRegex != nil {
+		body, err := ioutil.ReadAll(io.LimitReader(resp.Body, defaultMaxBodySize))
+		if err != nil {
+			return errors.Wrap(err, "read body")
+		}
+		if !p.Http.bodyRegex.Match(body) {
+			return newProbeError(reasonBodyMismatch, nil)
+		}
+	}
+	return nil
+}
+
+func isTlsError(err error) bool {
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var certInvalidErr x509.CertificateInvalidError
+	var hostnameErr x509.HostnameError
+	var recordHeaderErr tls.RecordHeaderError
+	return errors.As(err, &unknownAuthorityErr) || errors.As(err, &certInvalidErr) ||
+		errors.As(err, &hostnameErr) || errors.As(err, &recordHeaderErr)
+}
+
+func (p *ProbeConfig) statusExpected(statusCode int) bool {
+	if len(p.Http.ExpectedStatus) == 0 {
+		return statusCode >= 200 && statusCode < 300
+	}
+	for _, expected := range p.Http.ExpectedStatus {
+		if statusCode == expected {
+			return true
+		}
+	}
+	return false
+}
+
+// probeMysql reads the initial handshake packet sent by the server after connected,
+// which is enough to know that observer or obproxy is serving, without authentication.
+func (p *ProbeConfig) probeMysql(ctx context.Context) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", p.Address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	header := make([]byte, mysqlPacketHeaderLength)
+	if _, err = io.ReadFull(conn, header); err != nil {
+		return newProbeError(reasonHandshake, err)
+	}
+	length := int(binary.LittleEndian.Uint32(append(header[:3:3], 0)))
+	if length == 0 {
+		return newProbeError(reasonHandshake, errors.New("empty handshake packet"))
+	}
+	payload := make([]byte, length)
+	if _, err = io.ReadFull(conn, payload); err != nil {
+		return newProbeError(reasonHandshake, err)
+	}
+	switch payload[0] {
+	case mysqlProtocolVersion10:
+		return nil
+	case mysqlErrPacketHeader:
+		// e.g. too many connections
+		message := ""
+		if len(payload) > 3 {
+			message = strings.TrimPrefix(string(payload[3:]), "#")
+		}
+		return newProbeError(reasonHandshake, errors.Errorf("server error: %s", message))
+	default:
+		return newProbeError(reasonHandshake, errors.Errorf("unknown protocol version %d", payload[0]))
+	}
+}
+
+func (p *ProbeConfig) probeUdp(ctx context.Context) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", p.Address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	if _, err = conn.Write([]byte(p.Udp.Payload)); err != nil {
+		return err
+	}
+	buf := make([]byte, 65536)
+	n, err := conn.Read(buf)
+	if p.Udp.expectResponse == nil {
+		// no response is fine, but a refused port reported by icmp is a failure
+		if err != nil && failureReason(err) == reasonTimeout {
+			return nil
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if !p.Udp.expectResponse.Match(buf[:n]) {
+		return newProbeError(reasonResponseMismatch, nil)
+	}
+	return nil
+}
+
+func (p *ProbeConfig) probeDns(ctx context.Context) error {
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, p.Address)
+		},
+	}
+	addrs, err := resolver.LookupHost(ctx, p.Dns.QueryName)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsTimeout {
+			return newProbeError(reasonTimeout, err)
+		}
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return newProbeError(reasonNoAnswer, err)
+		}
+		return err
+	}
+	if len(addrs) == 0 {
+		return newProbeError(reasonNoAnswer, fmt.Errorf("no answer for %s", p.Dns.QueryName))
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package net
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"github.com/oceanbase/obagent/monitor/message"
+)
+
+func newProbe(t *testing.T, configStr string) *ProbeConfig {
+	probe := &ProbeConfig{}
+	require.Nil(t, yaml.Unmarshal([]byte(configStr), probe))
+	require.Nil(t, probe.init(time.Second))
+	return probe
+}
+
+// serveOnce accepts connections and writes the packet to each of them
+func serveOnce(t *testing.T, packet []byte) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write(packet)
+			conn.Close()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func closedAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	address := listener.Addr().String()
+	listener.Close()
+	return address
+}
+
+func TestProbe_tcp(t *testing.T) {
+	probe := newProbe(t, "{name: t, address: '"+serveOnce(t, nil)+"'}")
+	require.Equal(t, TcpProbe, probe.Type)
+	result := probe.probe(context.Background())
+	require.Nil(t, result.err)
+
+	probe = newProbe(t, "{name: t, address: '"+closedAddress(t)+"'}")
+	result = probe.probe(context.Background())
+	require.NotNil(t, result.err)
+	require.Equal(t, reasonRefused, result.reason)
+}
+
+func TestProbe_http(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/missing" {
+			writer.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writer.Write([]byte("ob_server_num 3"))
+	}))
+	defer server.Close()
+
+	probe := newProbe(t, `
+name: h
+type: http
+address: `+server.URL+`
+http:
+  bodyRegex: 'ob_server_num \d+'
+  insecureSkipVerify: true
+`)
+	result := probe.probe(context.Background())
+	require.Nil(t, result.err)
+	require.Equal(t, 200.0, result.gauges["http_status_code"])
+	require.Equal(t, float64(server.Certificate().NotAfter.Unix()), result.gauges["tls_cert_expiry_timestamp_seconds"])
+
+	probe.Http.bodyRegex = nil
+	probe.Address = server.URL + "/missing"
+	result = probe.probe(context.Background())
+	require.Equal(t, reasonStatus, result.reason)
+
+	probe.Http.ExpectedStatus = []int{404}
+	result = probe.probe(context.Background())
+	require.Nil(t, result.err)
+
+	probe = newProbe(t, "{name: h, type: http, address: '"+server.URL+"', http: {bodyRegex: 'observer'}}")
+	result = probe.probe(context.Background())
+	require.Equal(t, reasonTls, result.reason)
+
+	probe.Http.InsecureSkipVerify = true
+	result = probe.probe(context.Background())
+	require.Equal(t, reasonBodyMismatch, result.reason)
+}
+
+func TestProbe_mysql(t *testing.T) {
+	handshake := []byte{0x0a}
+	handshake = append(handshake, []byte("5.7.25-OceanBase-v4.2.1.0\x00")...)
+	packet := append([]byte{byte(len(handshake)), 0, 0, 0}, handshake...)
+	probe := newProbe(t, "{name: m, type: mysql, address: '"+serveOnce(t, packet)+"'}")
+	result := probe.probe(context.Background())
+	require.Nil(t, result.err)
+
+	errPacket := append([]byte{0xff, 0x10, 0x04}, []byte("#08004Too many connections")...)
+	packet = append([]byte{byte(len(errPacket)), 0, 0, 0}, errPacket...)
+	probe = newProbe(t, "{name: m, type: mysql, address: '"+serveOnce(t, packet)+"'}")
+	result = probe.probe(context.Background())
+	require.Equal(t, reasonHandshake, result.reason)
+	require.Contains(t, result.err.Error(), "Too many connections")
+
+	// not a mysql server
+	probe = newProbe(t, "{name: m, type: mysql, address: '"+serveOnce(t, []byte("HTTP/1.1 400\r\n"))+"'}")
+	result = probe.probe(context.Background())
+	require.Equal(t, reasonHandshake, result.reason)
+}
+
+func TestProbe_udp(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer conn.Close()
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteTo(append([]byte("pong:"), buf[:n]...), addr)
+		}
+	}()
+
+	probe := newProbe(t, "{name: u, type: udp, address: '"+conn.LocalAddr().String()+"', udp: {payload: ping, expectResponse: '^pong:ping$'}}")
+	result := probe.probe(context.Background())
+	require.Nil(t, result.err)
+
+	probe = newProbe(t, "{name: u, type: udp, address: '"+conn.LocalAddr().String()+"', udp: {payload: ping, expectResponse: 'other'}}")
+	result = probe.probe(context.Background())
+	require.Equal(t, reasonResponseMismatch, result.reason)
+}
+
+func TestProbe_dnsTimeout(t *testing.T) {
+	// a udp server never answers
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer conn.Close()
+
+	probe := newProbe(t, "{name: d, type: dns, address: '"+conn.LocalAddr().String()+"', timeout: 200ms, dns: {queryName: example.com}}")
+	result := probe.probe(context.Background())
+	require.Equal(t, reasonTimeout, result.reason)
+}
+
+func TestProbeConfig_invalid(t *testing.T) {
+	require.NotNil(t, (&ProbeConfig{Name: "a"}).init(time.Second))
+	require.NotNil(t, (&ProbeConfig{Name: "a", Address: "b", Type: "icmp"}).init(time.Second))
+	require.NotNil(t, (&ProbeConfig{Name: "a", Address: "b", Type: HttpProbe, Http: &HttpProbeConfig{BodyRegex: "("}}).init(time.Second))
+}
+
+func TestConnectivityInput_probes(t *testing.T) {
+	var configMap map[string]interface{}
+	require.Nil(t, yaml.Unmarshal([]byte(`
+timeout: 1s
+buckets: [1, 0.1]
+probes:
+  - name: ok
+    address: '`+serveOnce(t, nil)+`'
+    labels:
+      zone: z1
+  - name: refused
+    address: '`+closedAddress(t)+`'
+`), &configMap))
+	input := &ConnectivityInput{}
+	require.Nil(t, input.Init(context.Background(), configMap))
+
+	var msgs []*message.Message
+	for i := 0; i < 2; i++ {
+		var err error
+		msgs, err = input.CollectMsgs()
+		require.Nil(t, err)
+	}
+	require.Equal(t, 4, len(msgs))
+	require.Equal(t, "net_probe_success", msgs[0].GetName())
+	zone, _ := msgs[0].GetTag("zone")
+	require.Equal(t, "z1", zone)
+	value, _ := msgs[0].GetField("value")
+	require.Equal(t, 1.0, value)
+
+	require.Equal(t, message.Histogram, msgs[1].GetMetricType())
+	count, _ := msgs[1].GetField("count")
+	require.Equal(t, 2.0, count)
+	bucket, _ := msgs[1].GetField("1")
+	require.Equal(t, 2.0, bucket)
+	require.Equal(t, "0.1", msgs[1].Fields()[0].Name)
+
+	reason, _ := msgs[2].GetTag("reason")
+	require.Equal(t, reasonRefused, reason)
+	value, _ = msgs[2].GetField("value")
+	require.Equal(t, 0.0, value)
+}
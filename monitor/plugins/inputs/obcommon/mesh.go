@@ -0,0 +1,299 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package obcommon
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+
+	"github.com/oceanbase/obagent/lib/trace"
+	"github.com/oceanbase/obagent/monitor/message"
+	"github.com/oceanbase/obagent/monitor/plugins/common"
+)
+
+const meshSampleConfig = `
+connection:
+  url: 'user:password@tcp(127.0.0.1:2881)/oceanbase?interpolateParams=true'
+  maxOpen: 2
+  maxIdle: 1
+timeout: 3s
+refreshInterval: 1m
+collect_interval: 15s
+`
+
+const meshDescription = `
+probe rpc and sql ports of peer observers in the same cluster
+`
+
+const (
+	selectPeers = "select s.svr_ip, s.svr_port, s.inner_port, s.zone, z.info " +
+		"from __all_server s left join __all_zone z on s.zone = z.zone and z.name = 'idc'"
+	selectPeersForObVersion4 = "select s.svr_ip, s.svr_port, s.sql_port, s.zone, z.idc " +
+		"from DBA_OB_SERVERS s left join DBA_OB_ZONES z on s.zone = z.zone"
+)
+
+const obVersion4 = "4.0.0.0"
+
+const (
+	defaultMeshTimeout         = 3 * time.Second
+	defaultMeshRefreshInterval = time.Minute
+	defaultMeshCollectInterval = 15 * time.Second
+)
+
+const (
+	rpcPortType = "rpc"
+	sqlPortType = "sql"
+)
+
+type MeshConfig struct {
+	DbConnectionConfig *common.DbConnectionConfig `yaml:"connection"`
+	// Timeout of each tcp dial
+	Timeout time.Duration `yaml:"timeout"`
+	// RefreshInterval interval to reload peer observers from the cluster
+	RefreshInterval time.Duration `yaml:"refreshInterval"`
+	CollectInterval time.Duration `yaml:"collect_interval"`
+}
+
+// peer an observer of the cluster
+type peer struct {
+	Ip      string
+	RpcPort int64
+	SqlPort int64
+	Zone    string
+	Idc     string
+}
+
+// MeshInput probes every peer observer from the local observer, the results of all the
+// obagents of a cluster make up a src -> dst connectivity and latency matrix
+type MeshInput struct {
+	Config *MeshConfig
+	Ob     *common.Observer
+
+	// listPeers can be replaced in tests
+	listPeers   func(ctx context.Context) ([]*peer, error)
+	peers       []*peer
+	lastRefresh time.Time
+
+	ctx  context.Context
+	done chan struct{}
+}
+
+func (m *MeshInput) Init(ctx context.Context, config map[string]interface{}) error {
+	var pluginConfig MeshConfig
+	configBytes, err := yaml.Marshal(config)
+	if err != nil {
+		return errors.Wrap(err, "mesh connectivity input encode config")
+	}
+	err = yaml.Unmarshal(configBytes, &pluginConfig)
+	if err != nil {
+		return errors.Wrap(err, "mesh connectivity input decode config")
+	}
+	if pluginConfig.Timeout <= 0 {
+		pluginConfig.Timeout = defaultMeshTimeout
+	}
+	if pluginConfig.RefreshInterval <= 0 {
+		pluginConfig.RefreshInterval = defaultMeshRefreshInterval
+	}
+	if pluginConfig.CollectInterval <= 0 {
+		pluginConfig.CollectInterval = defaultMeshCollectInterval
+	}
+	m.Config = &pluginConfig
+	m.ctx = ctx
+	m.done = make(chan struct{})
+
+	if m.listPeers == nil {
+		if pluginConfig.DbConnectionConfig == nil {
+			return errors.New("mesh connectivity input connection not set")
+		}
+		// the observer is resolved when collecting, so the pipeline is built even if it is down
+		m.listPeers = m.queryPeers
+	}
+	return nil
+}
+
+func (m *MeshInput) Start(out chan<- []*message.Message) error {
+	log.WithContext(m.ctx).Info("meshConnectivityInput started")
+	go m.update(m.ctx, out)
+	return nil
+}
+
+func (m *MeshInput) update(ctx context.Context, out chan<- []*message.Message) {
+	ticker := time.NewTicker(m.Config.CollectInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			msgs, err := m.CollectMsgs()
+			if err != nil {
+				log.WithContext(ctx).Warnf("collect mesh connectivity messages failed, reason: %s", err)
+			}
+			out <- msgs
+		case <-m.done:
+			log.WithContext(ctx).Info("meshConnectivityInput exited")
+			return
+		}
+	}
+}
+
+func (m *MeshInput) Stop() {
+	if m.done != nil {
+		close(m.done)
+	}
+}
+
+func (m *MeshInput) SampleConfig() string {
+	return meshSampleConfig
+}
+
+func (m *MeshInput) Description() string {
+	return meshDescription
+}
+
+func (m *MeshInput) queryPeers(ctx context.Context) ([]*peer, error) {
+	if m.Ob == nil {
+		ob, err := common.GetObserver(m.Config.DbConnectionConfig)
+		if err != nil {
+			return nil, errors.Wrap(err, "get observer")
+		}
+		m.Ob = ob
+	}
+	query := selectPeers
+	result, err := common.CompareVersion(m.Ob.MetaInfo.Version, obVersion4)
+	if err != nil {
+		return nil, errors.Wrap(err, "compare observer version 4.0.0.0")
+	}
+	if result >= 0 {
+		query = selectPeersForObVersion4
+	}
+	rows, err := m.Ob.Db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "query peer observers")
+	}
+	defer rows.Close()
+	peers := make([]*peer, 0)
+	for rows.Next() {
+		p := &peer{}
+		var idc sql.NullString
+		if err = rows.Scan(&p.Ip, &p.RpcPort, &p.SqlPort, &p.Zone, &idc); err != nil {
+			return nil, errors.Wrap(err, "scan peer observer")
+		}
+		p.Idc = idc.String
+		peers = append(peers, p)
+	}
+	return peers, rows.Err()
+}
+
+// refreshPeers reloads peers when the refresh interval elapsed, the last peers are kept on failure
+func (m *MeshInput) refreshPeers(ctx context.Context) {
+	if m.peers != nil && time.Since(m.lastRefresh) < m.Config.RefreshInterval {
+		return
+	}
+	peers, err := m.listPeers(ctx)
+	if err != nil {
+		log.WithContext(ctx).Warnf("refresh peer observers failed, keep %d last peers, reason: %s", len(m.peers), err)
+		return
+	}
+	m.peers = peers
+	m.lastRefresh = time.Now()
+}
+
+func (m *MeshInput) self() (string, int64) {
+	if m.Ob == nil || m.Ob.MetaInfo == nil {
+		return "", 0
+	}
+	return m.Ob.MetaInfo.Ip, m.Ob.MetaInfo.Port
+}
+
+func (m *MeshInput) CollectMsgs() ([]*message.Message, error) {
+	ctx := trace.ContextWithRandomTraceId()
+	m.refreshPeers(ctx)
+
+	srcIp, srcPort := m.self()
+	src := &peer{Ip: srcIp, RpcPort: srcPort}
+	dsts := make([]*peer, 0, len(m.peers))
+	for _, p := range m.peers {
+		if p.Ip == srcIp && p.RpcPort == srcPort {
+			src = p
+			continue
+		}
+		dsts = append(dsts, p)
+	}
+
+	now := time.Now()
+	msgs := make([]*message.Message, 2*len(dsts)*2)
+	wg := sync.WaitGroup{}
+	for i, dst := range dsts {
+		for j, portType := range []string{rpcPortType, sqlPortType} {
+			wg.Add(1)
+			go func(idx int, dst *peer, portType string) {
+				defer wg.Done()
+				address := net.JoinHostPort(dst.Ip, strconv.FormatInt(portOf(dst, portType), 10))
+				success, latency := m.dial(ctx, address)
+				msgs[idx] = newMeshMessage("ob_peer_connectivity", now, src, dst, portType).
+					AddField("value", success)
+				msgs[idx+1] = newMeshMessage("ob_peer_latency_seconds", now, src, dst, portType).
+					AddField("value", latency)
+			}(2*(2*i+j), dst, portType)
+		}
+	}
+	wg.Wait()
+
+	ret := make([]*message.Message, 0, len(msgs))
+	for i := 0; i < len(msgs); i += 2 {
+		ret = append(ret, msgs[i])
+		// latency of an unreachable peer is meaningless
+		if v, _ := msgs[i].GetField("value"); v == 1.0 {
+			ret = append(ret, msgs[i+1])
+		}
+	}
+	return ret, nil
+}
+
+func (m *MeshInput) dial(ctx context.Context, address string) (float64, float64) {
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", address, m.Config.Timeout)
+	latency := time.Since(start).Seconds()
+	if err != nil {
+		log.WithContext(ctx).Debugf("dial peer %s failed, reason: %s", address, err)
+		return 0.0, latency
+	}
+	conn.Close()
+	return 1.0, latency
+}
+
+func newMeshMessage(name string, t time.Time, src *peer, dst *peer, portType string) *message.Message {
+	return message.NewMessage(name, message.Gauge, t).
+		AddTag("src_ip", src.Ip).
+		AddTag("src_zone", src.Zone).
+		AddTag("src_idc", src.Idc).
+		AddTag("dst_ip", dst.Ip).
+		AddTag("dst_port", strconv.FormatInt(portOf(dst, portType), 10)).
+		AddTag("dst_zone", dst.Zone).
+		AddTag("dst_idc", dst.Idc).
+		AddTag("port_type", portType)
+}
+
+func portOf(p *peer, portType string) int64 {
+	if portType == sqlPortType {
+		return p.SqlPort
+	}
+	return p.RpcPort
+}
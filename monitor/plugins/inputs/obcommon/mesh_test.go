@@ -0,0 +1,125 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package obcommon
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oceanbase/obagent/monitor/message"
+)
+
+func listenPort(t *testing.T) int64 {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	t.Cleanup(func() { listener.Close() })
+	return int64(listener.Addr().(*net.TCPAddr).Port)
+}
+
+func closedPort(t *testing.T) int64 {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	port := int64(listener.Addr().(*net.TCPAddr).Port)
+	listener.Close()
+	return port
+}
+
+func findMeshMessage(msgs []*message.Message, name string, portType string) *message.Message {
+	for _, msg := range msgs {
+		if tag, _ := msg.GetTag("port_type"); msg.GetName() == name && tag == portType {
+			return msg
+		}
+	}
+	return nil
+}
+
+func TestMeshInput_Init(t *testing.T) {
+	input := &MeshInput{}
+	require.NotNil(t, input.Init(context.Background(), map[string]interface{}{}))
+	require.Equal(t, meshSampleConfig, input.SampleConfig())
+	require.Equal(t, meshDescription, input.Description())
+}
+
+func TestMeshInput_observerDown(t *testing.T) {
+	input := &MeshInput{}
+	require.Nil(t, input.Init(context.Background(), map[string]interface{}{
+		"connection": map[string]interface{}{
+			"url": fmt.Sprintf("user:pass@tcp(127.0.0.1:%d)/oceanbase?timeout=1s", closedPort(t)),
+		},
+	}))
+	msgs, err := input.CollectMsgs()
+	require.Nil(t, err)
+	require.Equal(t, 0, len(msgs))
+	require.Nil(t, input.Ob)
+}
+
+func TestMeshInput_CollectMsgs(t *testing.T) {
+	peers := []*peer{
+		{Ip: "127.0.0.1", RpcPort: listenPort(t), SqlPort: closedPort(t), Zone: "zone2", Idc: "hz"},
+	}
+	calls := 0
+	var listErr error
+	input := &MeshInput{
+		listPeers: func(ctx context.Context) ([]*peer, error) {
+			calls++
+			return peers, listErr
+		},
+	}
+	require.Nil(t, input.Init(context.Background(), map[string]interface{}{"timeout": "1s"}))
+
+	msgs, err := input.CollectMsgs()
+	require.Nil(t, err)
+	require.Equal(t, 3, len(msgs))
+
+	rpc := findMeshMessage(msgs, "ob_peer_connectivity", rpcPortType)
+	value, _ := rpc.GetField("value")
+	require.Equal(t, 1.0, value)
+	zone, _ := rpc.GetTag("dst_zone")
+	require.Equal(t, "zone2", zone)
+	idc, _ := rpc.GetTag("dst_idc")
+	require.Equal(t, "hz", idc)
+	port, _ := rpc.GetTag("dst_port")
+	require.Equal(t, strconv.FormatInt(peers[0].RpcPort, 10), port)
+	require.NotNil(t, findMeshMessage(msgs, "ob_peer_latency_seconds", rpcPortType))
+
+	sql := findMeshMessage(msgs, "ob_peer_connectivity", sqlPortType)
+	value, _ = sql.GetField("value")
+	require.Equal(t, 0.0, value)
+	require.Nil(t, findMeshMessage(msgs, "ob_peer_latency_seconds", sqlPortType))
+
+	// peers are cached within the refresh interval
+	_, _ = input.CollectMsgs()
+	require.Equal(t, 1, calls)
+
+	// last peers are kept when refresh failed
+	input.lastRefresh = time.Time{}
+	listErr = errors.New("query failed")
+	peers = nil
+	msgs, _ = input.CollectMsgs()
+	require.Equal(t, 2, calls)
+	require.Equal(t, 3, len(msgs))
+
+	// membership changes are picked up
+	input.lastRefresh = time.Time{}
+	listErr = nil
+	peers = []*peer{}
+	msgs, _ = input.CollectMsgs()
+	require.Equal(t, 0, len(msgs))
+}
@@ -0,0 +1,415 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package obproxy
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+
+	"github.com/oceanbase/obagent/errors"
+	agentlog "github.com/oceanbase/obagent/log"
+	"github.com/oceanbase/obagent/monitor/message"
+	"github.com/oceanbase/obagent/monitor/plugins/common"
+	"github.com/oceanbase/obagent/monitor/utils"
+)
+
+const sampleConfig = `
+connection:
+  url: root@proxysys:password@tcp(127.0.0.1:2883)/?interpolateParams=true
+  maxIdle: 1
+  maxOpen: 4
+clusterName: obcluster
+appName: obproxy
+collect_interval: 15s
+timeout: 10s
+collectConfig:
+  - name: obproxy_stat
+    sql: show proxystat
+    tags:
+      stat_name: name
+    metrics:
+      value: value
+  - name: obproxy_session
+    sql: show proxysession
+    mode: summary
+    tags:
+      cluster: cluster
+      tenant: tenant
+`
+
+const description = `
+collect internal stats of obproxy through its admin interface
+`
+
+// CollectMode how rows of a command are converted to messages
+type CollectMode string
+
+const (
+	// RowsMode one message per row
+	RowsMode CollectMode = "rows"
+	// SummaryMode one message per distinct tag values, with field count and the sum of metric columns
+	SummaryMode CollectMode = "summary"
+)
+
+const (
+	clusterNameTag = "obproxy_cluster"
+	appNameTag     = "app_name"
+	countField     = "count"
+)
+
+const defaultTimeout = 10 * time.Second
+const defaultCollectInterval = 15 * time.Second
+
+// defaultCollectConfigs proxy stats, sessions, congestion, route cache and sql audit summaries,
+// used when collectConfig is not set
+var defaultCollectConfigs = []*CollectConfig{
+	{
+		Name:    "obproxy_stat",
+		Sql:     "show proxystat",
+		Tags:    map[string]string{"stat_name": "name"},
+		Metrics: map[string]string{"value": "value"},
+	},
+	{
+		Name: "obproxy_session",
+		Sql:  "show proxysession",
+		Mode: SummaryMode,
+		Tags: map[string]string{"cluster": "cluster", "tenant": "tenant", "user": "user", "state": "state"},
+	},
+	{
+		Name: "obproxy_congestion",
+		Sql:  "show proxycongestion all",
+		Tags: map[string]string{"cluster": "cluster_name", "svr_ip": "server_ip", "server_state": "server_state"},
+		Metrics: map[string]string{
+			"alive_congested":  "alive_congested",
+			"dead_congested":   "dead_congested",
+			"detect_congested": "detect_congested",
+			"ref_count":        "ref_count",
+		},
+	},
+	{
+		Name: "obproxy_route_cache",
+		Sql:  "show proxyroute",
+		Mode: SummaryMode,
+		Tags: map[string]string{"cluster": "cluster_name", "tenant": "tenant_name", "state": "state"},
+	},
+	{
+		Name:    "obproxy_sql_audit",
+		Sql:     "show sqlaudit",
+		Mode:    SummaryMode,
+		Tags:    map[string]string{"svr_ip": "server_ip", "sql_cmd": "sql_cmd"},
+		Metrics: map[string]string{"elapsed_time": "elapsed_time"},
+	},
+}
+
+type CollectConfig struct {
+	// Name metric name
+	Name string `yaml:"name"`
+	// Sql obproxy admin command, e.g. show proxystat
+	Sql string `yaml:"sql"`
+	// Mode rows or summary, default rows
+	Mode CollectMode `yaml:"mode"`
+	// Tags tag name to column name
+	Tags map[string]string `yaml:"tags"`
+	// Metrics field name to column name, values not numeric are skipped
+	Metrics map[string]string `yaml:"metrics"`
+}
+
+type Config struct {
+	DbConnectionConfig *common.DbConnectionConfig `yaml:"connection"`
+	// ClusterName and AppName attached to all messages as tags obproxy_cluster and app_name
+	ClusterName     string           `yaml:"clusterName"`
+	AppName         string           `yaml:"appName"`
+	CollectConfigs  []*CollectConfig `yaml:"collectConfig"`
+	CollectInterval time.Duration    `yaml:"collect_interval"`
+	Timeout         time.Duration    `yaml:"timeout"`
+}
+
+// ObproxyInput runs admin commands on obproxy, each command is collected independently,
+// a failed command, e.g. not supported by the obproxy version, does not affect others.
+type ObproxyInput struct {
+	Config *Config
+	db     *sql.DB
+
+	ctx  context.Context
+	done chan struct{}
+}
+
+func (o *ObproxyInput) SampleConfig() string {
+	return sampleConfig
+}
+
+func (o *ObproxyInput) Description() string {
+	return description
+}
+
+func (o *ObproxyInput) Init(ctx context.Context, config map[string]interface{}) error {
+	var pluginConfig Config
+	configBytes, err := yaml.Marshal(config)
+	if err != nil {
+		return errors.Wrap(err, "obproxyInput encode config")
+	}
+	err = yaml.Unmarshal(configBytes, &pluginConfig)
+	if err != nil {
+		return errors.Wrap(err, "obproxyInput decode config")
+	}
+	if pluginConfig.DbConnectionConfig == nil || pluginConfig.DbConnectionConfig.Url == "" {
+		return errors.New("obproxyInput connection url is empty")
+	}
+	if len(pluginConfig.CollectConfigs) == 0 {
+		pluginConfig.CollectConfigs = defaultCollectConfigs
+	}
+	for _, collectConfig := range pluginConfig.CollectConfigs {
+		if collectConfig.Name == "" || collectConfig.Sql == "" {
+			return errors.New("obproxyInput name or sql of collectConfig is empty")
+		}
+		switch collectConfig.Mode {
+		case "":
+			collectConfig.Mode = RowsMode
+		case RowsMode, SummaryMode:
+		default:
+			return errors.Errorf("obproxyInput unknown mode %s of %s", collectConfig.Mode, collectConfig.Name)
+		}
+	}
+	if pluginConfig.CollectInterval == 0 {
+		pluginConfig.CollectInterval = defaultCollectInterval
+	}
+	if pluginConfig.Timeout == 0 {
+		pluginConfig.Timeout = defaultTimeout
+	}
+	o.Config = &pluginConfig
+	o.ctx = context.Background()
+	o.done = make(chan struct{})
+	log.WithContext(ctx).Infof("init obproxyInput with config: %+v", o.Config)
+
+	db, err := sql.Open("mysql", pluginConfig.DbConnectionConfig.Url)
+	if err != nil {
+		return errors.Wrap(err, "obproxyInput db init")
+	}
+	db.SetMaxOpenConns(pluginConfig.DbConnectionConfig.MaxOpen)
+	db.SetMaxIdleConns(pluginConfig.DbConnectionConfig.MaxIdle)
+	o.db = db
+	// obproxy may be started later than obagent, so a failed ping is not fatal
+	timeoutCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	if err = db.PingContext(timeoutCtx); err != nil {
+		log.WithContext(ctx).WithError(err).Warn("obproxyInput ping obproxy failed")
+	}
+	return nil
+}
+
+func (o *ObproxyInput) Start(out chan<- []*message.Message) error {
+	log.Info("start obproxyInput plugin")
+	go o.update(out)
+	return nil
+}
+
+func (o *ObproxyInput) update(out chan<- []*message.Message) {
+	ticker := time.NewTicker(o.Config.CollectInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			msgs, err := o.CollectMsgs(o.ctx)
+			if err != nil {
+				log.WithContext(o.ctx).Warnf("obproxyInput collect failed, reason: %s", err)
+				continue
+			}
+			out <- msgs
+		case <-o.done:
+			log.Info("obproxyInput plugin exited")
+			return
+		}
+	}
+}
+
+func (o *ObproxyInput) Stop() {
+	if o.done != nil {
+		close(o.done)
+	}
+	if o.db != nil {
+		o.db.Close()
+	}
+}
+
+func (o *ObproxyInput) CollectMsgs(ctx context.Context) ([]*message.Message, error) {
+	var metrics []*message.Message
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	for _, collectConfig := range o.Config.CollectConfigs {
+		wg.Add(1)
+		go func(collectConfig *CollectConfig) {
+			defer wg.Done()
+			msgs, err := o.collect(ctx, collectConfig)
+			if err != nil {
+				log.WithContext(ctx).Warnf("obproxyInput collect %s failed, sql: %s, err: %s", collectConfig.Name, collectConfig.Sql, err)
+				return
+			}
+			mutex.Lock()
+			metrics = append(metrics, msgs...)
+			mutex.Unlock()
+		}(collectConfig)
+	}
+	wg.Wait()
+	return metrics, nil
+}
+
+func (o *ObproxyInput) collect(ctx context.Context, collectConfig *CollectConfig) ([]*message.Message, error) {
+	ctx, cancel := context.WithTimeout(ctx, o.Config.Timeout)
+	defer cancel()
+	now := time.Now()
+	entry := log.WithContext(context.WithValue(ctx, agentlog.StartTimeKey, now)).WithField("query sql", collectConfig.Sql)
+	rows, err := o.query(ctx, collectConfig.Sql)
+	entry.Debug("execute end")
+	if err != nil {
+		return nil, err
+	}
+	msgs := convertRows(ctx, collectConfig, rows, now)
+	for _, msg := range msgs {
+		if o.Config.ClusterName != "" {
+			msg.AddTag(clusterNameTag, o.Config.ClusterName)
+		}
+		if o.Config.AppName != "" {
+			msg.AddTag(appNameTag, o.Config.AppName)
+		}
+	}
+	return msgs, nil
+}
+
+// query returns rows as maps of lower case column name to value
+func (o *ObproxyInput) query(ctx context.Context, querySql string) ([]map[string]interface{}, error) {
+	results, err := o.db.QueryContext(ctx, querySql)
+	if err != nil {
+		return nil, errors.Wrap(err, "query")
+	}
+	defer results.Close()
+	columns, err := results.Columns()
+	if err != nil {
+		return nil, errors.Wrap(err, "get columns")
+	}
+	rows := make([]map[string]interface{}, 0)
+	for results.Next() {
+		values := make([]interface{}, len(columns))
+		valuePtrs := make([]interface{}, len(columns))
+		for i := range columns {
+			valuePtrs[i] = &values[i]
+		}
+		if err = results.Scan(valuePtrs...); err != nil {
+			return nil, errors.Wrap(err, "scan")
+		}
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			row[strings.ToLower(column)] = values[i]
+		}
+		rows = append(rows, row)
+	}
+	return rows, errors.Wrap(results.Err(), "read rows")
+}
+
+func convertRows(ctx context.Context, collectConfig *CollectConfig, rows []map[string]interface{}, t time.Time) []*message.Message {
+	if collectConfig.Mode == SummaryMode {
+		return summarizeRows(collectConfig, rows, t)
+	}
+	msgs := make([]*message.Message, 0, len(rows))
+	for _, row := range rows {
+		fields := make([]message.FieldEntry, 0, len(collectConfig.Metrics))
+		for fieldName, column := range collectConfig.Metrics {
+			value, found := row[column]
+			if !found {
+				continue
+			}
+			v, ok := utils.ConvertToFloat64(value)
+			if !ok {
+				log.WithContext(ctx).Debugf("obproxyInput can not convert value of %s %v to float64", column, value)
+				continue
+			}
+			fields = append(fields, message.FieldEntry{Name: fieldName, Value: v})
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		msgs = append(msgs, message.NewMessageWithTagsFields(collectConfig.Name, message.Untyped, t, rowTags(collectConfig, row), fields))
+	}
+	return msgs
+}
+
+type summary struct {
+	tags   []message.TagEntry
+	count  float64
+	fields map[string]float64
+}
+
+func summarizeRows(collectConfig *CollectConfig, rows []map[string]interface{}, t time.Time) []*message.Message {
+	summaries := make(map[string]*summary)
+	keys := make([]string, 0)
+	for _, row := range rows {
+		tags := rowTags(collectConfig, row)
+		sort.Slice(tags, func(i, j int) bool {
+			return tags[i].Name < tags[j].Name
+		})
+		var keyBuilder strings.Builder
+		for _, tag := range tags {
+			keyBuilder.WriteString(tag.Name)
+			keyBuilder.WriteByte(0)
+			keyBuilder.WriteString(tag.Value)
+			keyBuilder.WriteByte(0)
+		}
+		key := keyBuilder.String()
+		s, ok := summaries[key]
+		if !ok {
+			s = &summary{tags: tags, fields: make(map[string]float64)}
+			summaries[key] = s
+			keys = append(keys, key)
+		}
+		s.count++
+		for fieldName, column := range collectConfig.Metrics {
+			if v, ok := utils.ConvertToFloat64(row[column]); ok {
+				s.fields[fieldName] += v
+			}
+		}
+	}
+	msgs := make([]*message.Message, 0, len(keys))
+	for _, key := range keys {
+		s := summaries[key]
+		fields := make([]message.FieldEntry, 0, len(s.fields)+1)
+		fields = append(fields, message.FieldEntry{Name: countField, Value: s.count})
+		for fieldName, v := range s.fields {
+			fields = append(fields, message.FieldEntry{Name: fieldName + "_sum", Value: v})
+		}
+		msgs = append(msgs, message.NewMessageWithTagsFields(collectConfig.Name, message.Gauge, t, s.tags, fields))
+	}
+	return msgs
+}
+
+func rowTags(collectConfig *CollectConfig, row map[string]interface{}) []message.TagEntry {
+	tags := make([]message.TagEntry, 0, len(collectConfig.Tags))
+	for tagName, column := range collectConfig.Tags {
+		value, found := row[column]
+		if !found || value == nil {
+			continue
+		}
+		v, ok := utils.ConvertToString(value)
+		if !ok {
+			continue
+		}
+		tags = append(tags, message.TagEntry{Name: tagName, Value: v})
+	}
+	return tags
+}
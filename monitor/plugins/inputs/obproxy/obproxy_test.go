@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package obproxy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestObproxyInput_Init(t *testing.T) {
+	input := &ObproxyInput{}
+	err := input.Init(context.Background(), map[string]interface{}{})
+	require.NotNil(t, err)
+
+	var config map[string]interface{}
+	require.Nil(t, yaml.Unmarshal([]byte(`
+connection:
+  url: root@proxysys:@tcp(127.0.0.1:1)/
+clusterName: c1
+`), &config))
+	err = input.Init(context.Background(), config)
+	require.Nil(t, err)
+	defer input.Stop()
+	require.Equal(t, len(defaultCollectConfigs), len(input.Config.CollectConfigs))
+	require.Equal(t, RowsMode, input.Config.CollectConfigs[0].Mode)
+	require.Equal(t, defaultCollectInterval, input.Config.CollectInterval)
+
+	// unreachable obproxy collects nothing
+	msgs, err := input.CollectMsgs(context.Background())
+	require.Nil(t, err)
+	require.Equal(t, 0, len(msgs))
+
+	require.Nil(t, yaml.Unmarshal([]byte(`
+connection:
+  url: root@proxysys:@tcp(127.0.0.1:1)/
+collectConfig:
+  - name: obproxy_stat
+    sql: show proxystat
+    mode: unknown
+`), &config))
+	require.NotNil(t, (&ObproxyInput{}).Init(context.Background(), config))
+}
+
+func TestConvertRows(t *testing.T) {
+	collectConfig := &CollectConfig{
+		Name:    "obproxy_stat",
+		Mode:    RowsMode,
+		Tags:    map[string]string{"stat_name": "name"},
+		Metrics: map[string]string{"value": "value"},
+	}
+	rows := []map[string]interface{}{
+		{"name": []byte("client_connections"), "value": []byte("10")},
+		{"name": []byte("version"), "value": []byte("4.2.1")},
+		{"name": []byte("total_transactions"), "value": int64(100)},
+	}
+	msgs := convertRows(context.Background(), collectConfig, rows, time.Now())
+	require.Equal(t, 2, len(msgs))
+	name, _ := msgs[0].GetTag("stat_name")
+	require.Equal(t, "client_connections", name)
+	value, _ := msgs[0].GetField("value")
+	require.Equal(t, 10.0, value)
+	value, _ = msgs[1].GetField("value")
+	require.Equal(t, 100.0, value)
+}
+
+func TestConvertRows_summary(t *testing.T) {
+	collectConfig := &CollectConfig{
+		Name:    "obproxy_sql_audit",
+		Mode:    SummaryMode,
+		Tags:    map[string]string{"svr_ip": "server_ip", "sql_cmd": "sql_cmd"},
+		Metrics: map[string]string{"elapsed_time": "elapsed_time"},
+	}
+	rows := []map[string]interface{}{
+		{"server_ip": "10.0.0.1", "sql_cmd": "COM_QUERY", "elapsed_time": int64(100)},
+		{"server_ip": "10.0.0.1", "sql_cmd": "COM_QUERY", "elapsed_time": int64(300)},
+		{"server_ip": "10.0.0.2", "sql_cmd": "COM_QUERY", "elapsed_time": int64(50)},
+		{"server_ip": nil, "sql_cmd": "COM_PING", "elapsed_time": nil},
+	}
+	msgs := convertRows(context.Background(), collectConfig, rows, time.Now())
+	require.Equal(t, 3, len(msgs))
+	count, _ := msgs[0].GetField("count")
+	require.Equal(t, 2.0, count)
+	sum, _ := msgs[0].GetField("elapsed_time_sum")
+	require.Equal(t, 400.0, sum)
+	_, found := msgs[2].GetTag("svr_ip")
+	require.False(t, found)
+	count, _ = msgs[2].GetField("count")
+	require.Equal(t, 1.0, count)
+}
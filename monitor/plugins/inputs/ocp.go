@@ -42,6 +42,15 @@ func init() {
 		}
 		return connectivityInput, nil
 	})
+	plugins.GetInputManager().Register("obMeshConnectivityInput", func(conf *monagent.PluginConfig) (plugins.Source, error) {
+		meshInput := &obcommon.MeshInput{}
+		err := meshInput.Init(context.Background(), conf.PluginInnerConfig)
+		if err != nil {
+			log.WithError(err).Errorf("init meshInput failed")
+			return nil, err
+		}
+		return meshInput, nil
+	})
 	plugins.GetInputManager().Register("processInput", func(conf *monagent.PluginConfig) (plugins.Source, error) {
 		processInput := &process.ProcessInput{}
 		err := processInput.Init(context.Background(), conf.PluginInnerConfig)
@@ -0,0 +1,194 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package process
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// cgroupRoot can be changed in tests
+var cgroupRoot = "/sys/fs/cgroup"
+
+const (
+	cgroupV1 = "v1"
+	cgroupV2 = "v2"
+)
+
+// cgroupResource limits and usage of the cgroup a process belongs to, nil values are unlimited or unavailable
+type cgroupResource struct {
+	version string
+	path    string
+
+	cpuQuotaCores      *float64
+	cpuPeriods         *float64
+	cpuThrottled       *float64
+	cpuThrottledSecond *float64
+	cpuUsageSeconds    *float64
+	memoryLimitBytes   *float64
+	memoryUsageBytes   *float64
+}
+
+// readCgroupResource reads /proc/<pid>/cgroup, lines of v1 are like "4:cpu,cpuacct:/path",
+// and the line of v2 unified hierarchy is like "0::/path"
+func readCgroupResource(pid int) *cgroupResource {
+	file, err := os.Open(procPath(pid, "cgroup"))
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	v1Paths := make(map[string]string)
+	v2Path := ""
+	isV2 := false
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[0] == "0" && parts[1] == "" {
+			v2Path = parts[2]
+			isV2 = true
+			continue
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			v1Paths[controller] = parts[2]
+		}
+	}
+	if _, ok := v1Paths["cpu"]; ok {
+		return readCgroupV1(v1Paths)
+	}
+	if isV2 {
+		return readCgroupV2(v2Path)
+	}
+	return nil
+}
+
+// cgroupDir finds the directory of the cgroup, returns "" if it is not visible, e.g. the path is
+// of another cgroup namespace. The root of the controller is only used when the path is "/",
+// falling back to it would report the usage of the whole host.
+func cgroupDir(controllerDir string, path string) string {
+	dir := filepath.Join(controllerDir, path)
+	if info, err := os.Stat(dir); err == nil && info.IsDir() {
+		return dir
+	}
+	return ""
+}
+
+// v1ControllerDir finds the mount dir of a controller, which may be co-mounted like cpu,cpuacct
+func v1ControllerDir(controller string) string {
+	entries, err := ioutil.ReadDir(cgroupRoot)
+	if err != nil {
+		return ""
+	}
+	for _, entry := range entries {
+		for _, name := range strings.Split(entry.Name(), ",") {
+			if name == controller {
+				return filepath.Join(cgroupRoot, entry.Name())
+			}
+		}
+	}
+	return ""
+}
+
+func v1CgroupDir(controller string, path string) string {
+	controllerDir := v1ControllerDir(controller)
+	if controllerDir == "" || path == "" {
+		return ""
+	}
+	return cgroupDir(controllerDir, path)
+}
+
+func readCgroupV1(paths map[string]string) *cgroupResource {
+	r := &cgroupResource{version: cgroupV1, path: paths["cpu"]}
+	if dir := v1CgroupDir("cpu", paths["cpu"]); dir != "" {
+		quota, quotaErr := readCgroupValue(filepath.Join(dir, "cpu.cfs_quota_us"))
+		period, periodErr := readCgroupValue(filepath.Join(dir, "cpu.cfs_period_us"))
+		if quotaErr == nil && periodErr == nil && quota > 0 && period > 0 {
+			r.cpuQuotaCores = float64Ptr(quota / period)
+		}
+		stat := readKeyValues(filepath.Join(dir, "cpu.stat"), "")
+		r.setCpuStat(stat, "throttled_time", 1e9)
+	}
+	if dir := v1CgroupDir("cpuacct", paths["cpuacct"]); dir != "" {
+		if usage, err := readCgroupValue(filepath.Join(dir, "cpuacct.usage")); err == nil {
+			r.cpuUsageSeconds = float64Ptr(usage / 1e9)
+		}
+	}
+	if dir := v1CgroupDir("memory", paths["memory"]); dir != "" {
+		// unlimited is a huge number close to max int64
+		if limit, err := readCgroupValue(filepath.Join(dir, "memory.limit_in_bytes")); err == nil && limit < (1<<62) {
+			r.memoryLimitBytes = float64Ptr(limit)
+		}
+		if usage, err := readCgroupValue(filepath.Join(dir, "memory.usage_in_bytes")); err == nil {
+			r.memoryUsageBytes = float64Ptr(usage)
+		}
+	}
+	return r
+}
+
+func readCgroupV2(path string) *cgroupResource {
+	dir := cgroupDir(cgroupRoot, path)
+	if dir == "" {
+		return nil
+	}
+	r := &cgroupResource{version: cgroupV2, path: path}
+	// cpu.max: "$MAX $PERIOD", $MAX is "max" when unlimited
+	if content, err := ioutil.ReadFile(filepath.Join(dir, "cpu.max")); err == nil {
+		fields := strings.Fields(string(content))
+		if len(fields) == 2 {
+			quota, quotaErr := strconv.ParseFloat(fields[0], 64)
+			period, periodErr := strconv.ParseFloat(fields[1], 64)
+			if quotaErr == nil && periodErr == nil && period > 0 {
+				r.cpuQuotaCores = float64Ptr(quota / period)
+			}
+		}
+	}
+	stat := readKeyValues(filepath.Join(dir, "cpu.stat"), "")
+	r.setCpuStat(stat, "throttled_usec", 1e6)
+	if usage, ok := stat["usage_usec"]; ok {
+		r.cpuUsageSeconds = float64Ptr(usage / 1e6)
+	}
+	if limit, err := readCgroupValue(filepath.Join(dir, "memory.max")); err == nil {
+		r.memoryLimitBytes = float64Ptr(limit)
+	}
+	if usage, err := readCgroupValue(filepath.Join(dir, "memory.current")); err == nil {
+		r.memoryUsageBytes = float64Ptr(usage)
+	}
+	return r
+}
+
+func (r *cgroupResource) setCpuStat(stat map[string]float64, throttledTimeKey string, unitsPerSecond float64) {
+	if v, ok := stat["nr_periods"]; ok {
+		r.cpuPeriods = float64Ptr(v)
+	}
+	if v, ok := stat["nr_throttled"]; ok {
+		r.cpuThrottled = float64Ptr(v)
+	}
+	if v, ok := stat[throttledTimeKey]; ok {
+		r.cpuThrottledSecond = float64Ptr(v / unitsPerSecond)
+	}
+}
+
+// readCgroupValue reads a single number, "max" means unlimited and returns an error
+func readCgroupValue(path string) (float64, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(strings.TrimSpace(string(content)), 64)
+}
@@ -26,6 +26,10 @@ import (
 
 const sampleConfig = `
 processNames: [observer, obproxy]
+resources:
+  - name: observer
+  - cmdlineRegex: 'bin/obproxy .*-p 2883'
+  - pidFile: /home/admin/oceanbase/run/observer.pid
 `
 
 const description = `
@@ -33,8 +37,10 @@ collect process info
 `
 
 type ProcessConfig struct {
-	ProcessNames    []string      `yaml:"processNames"`
-	CollectInterval time.Duration `yaml:"collect_interval"`
+	ProcessNames []string `yaml:"processNames"`
+	// Resources selects processes to collect cpu, memory, fd, io and cgroup metrics
+	Resources       []*ProcessSelector `yaml:"resources"`
+	CollectInterval time.Duration      `yaml:"collect_interval"`
 }
 
 type ProcessInput struct {
@@ -55,6 +61,12 @@ func (p *ProcessInput) Init(ctx context.Context, config map[string]interface{})
 	if err != nil {
 		return errors.Wrap(err, "process input decode config")
 	}
+	for _, selector := range pluginConfig.Resources {
+		err = selector.init()
+		if err != nil {
+			return errors.Wrap(err, "process input init resources")
+		}
+	}
 	p.Config = &pluginConfig
 	p.ctx = ctx
 	p.done = make(chan struct{})
@@ -110,7 +122,7 @@ func (p *ProcessInput) CollectMsgs(ctx context.Context) ([]*message.Message, err
 	processes, err := allProcessNames()
 	if err != nil {
 		log.WithContext(ctx).Warnf("get all processes name failed, %s", err)
-		return metrics, nil
+		return append(metrics, p.collectResources(ctx)...), nil
 	}
 
 	for _, expectedName := range p.Config.ProcessNames {
@@ -128,9 +140,36 @@ func (p *ProcessInput) CollectMsgs(ctx context.Context) ([]*message.Message, err
 			AddField("value", value)
 		metrics = append(metrics, metricEntry)
 	}
+	metrics = append(metrics, p.collectResources(ctx)...)
 	return metrics, nil
 }
 
+func (p *ProcessInput) collectResources(ctx context.Context) []*message.Message {
+	var metrics []*message.Message
+	now := time.Now()
+	seen := make(map[int]bool)
+	for _, selector := range p.Config.Resources {
+		pids, err := selector.selectPids()
+		if err != nil {
+			log.WithContext(ctx).Warnf("select processes failed, %s", err)
+			continue
+		}
+		for _, pid := range pids {
+			if seen[pid] {
+				continue
+			}
+			seen[pid] = true
+			resource, err := readProcessResource(pid)
+			if err != nil {
+				log.WithContext(ctx).Debugf("read resource of process %d failed, %s", pid, err)
+				continue
+			}
+			metrics = append(metrics, resource.messages(p.Env, now)...)
+		}
+	}
+	return metrics
+}
+
 var allProcessNames = func() ([]string, error) {
 	allProcesses := common.GetProcesses()
 	processNames := make([]string, 0, len(allProcesses.Processes))
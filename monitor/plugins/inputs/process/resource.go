@@ -0,0 +1,333 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package process
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/oceanbase/obagent/monitor/message"
+)
+
+// procRoot can be changed in tests
+var procRoot = "/proc"
+
+// clockTicks USER_HZ, the unit of cpu times in /proc/<pid>/stat, 100 on all the supported platforms
+const clockTicks = 100.0
+
+// ProcessSelector selects processes to collect resource metrics.
+// When PidFile is set, the pid in it is used; otherwise processes matching both Name and CmdlineRegex are selected.
+type ProcessSelector struct {
+	// Name process name, compared with /proc/<pid>/comm
+	Name string `yaml:"name"`
+	// CmdlineRegex regex matches the command line with arguments separated by space
+	CmdlineRegex string `yaml:"cmdlineRegex"`
+	PidFile      string `yaml:"pidFile"`
+
+	cmdlineRegex *regexp.Regexp
+}
+
+func (s *ProcessSelector) init() error {
+	if s.Name == "" && s.CmdlineRegex == "" && s.PidFile == "" {
+		return errors.New("one of name, cmdlineRegex and pidFile must be set")
+	}
+	if s.CmdlineRegex != "" {
+		var err error
+		s.cmdlineRegex, err = regexp.Compile(s.CmdlineRegex)
+		if err != nil {
+			return errors.Wrapf(err, "invalid cmdlineRegex %s", s.CmdlineRegex)
+		}
+	}
+	return nil
+}
+
+func (s *ProcessSelector) selectPids() ([]int, error) {
+	if s.PidFile != "" {
+		content, err := ioutil.ReadFile(s.PidFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "read pid file %s", s.PidFile)
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid pid file %s", s.PidFile)
+		}
+		if _, err = os.Stat(filepath.Join(procRoot, strconv.Itoa(pid))); err != nil {
+			// stale pid file
+			return nil, nil
+		}
+		return []int{pid}, nil
+	}
+	entries, err := ioutil.ReadDir(procRoot)
+	if err != nil {
+		return nil, errors.Wrap(err, "list processes")
+	}
+	pids := make([]int, 0)
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		if s.Name != "" && readComm(pid) != s.Name {
+			continue
+		}
+		if s.cmdlineRegex != nil && !s.cmdlineRegex.MatchString(readCmdline(pid)) {
+			continue
+		}
+		pids = append(pids, pid)
+	}
+	return pids, nil
+}
+
+func procPath(pid int, name string) string {
+	return filepath.Join(procRoot, strconv.Itoa(pid), name)
+}
+
+func readComm(pid int) string {
+	content, err := ioutil.ReadFile(procPath(pid, "comm"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
+
+func readCmdline(pid int) string {
+	content, err := ioutil.ReadFile(procPath(pid, "cmdline"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(bytes.ReplaceAll(content, []byte{0}, []byte{' '})))
+}
+
+// processResource resource usage of a process, a value is nil when it can not be read, e.g. permission denied
+type processResource struct {
+	pid  int
+	name string
+
+	cpuSeconds        *float64
+	residentBytes     *float64
+	virtualBytes      *float64
+	threads           *float64
+	openFds           *float64
+	maxFds            *float64
+	voluntarySwitches *float64
+	involuntarySwitch *float64
+	readBytes         *float64
+	writeBytes        *float64
+	cgroup            *cgroupResource
+}
+
+func float64Ptr(v float64) *float64 {
+	return &v
+}
+
+func readProcessResource(pid int) (*processResource, error) {
+	r := &processResource{pid: pid, name: readComm(pid)}
+	if err := r.readStat(); err != nil {
+		// the process exited
+		return nil, err
+	}
+	r.readStatus()
+	r.readFds()
+	r.readIo()
+	r.cgroup = readCgroupResource(pid)
+	return r, nil
+}
+
+// readStat parses /proc/<pid>/stat, see proc(5)
+func (r *processResource) readStat() error {
+	content, err := ioutil.ReadFile(procPath(r.pid, "stat"))
+	if err != nil {
+		return errors.Wrap(err, "read stat")
+	}
+	// comm may contain spaces and parentheses
+	i := bytes.LastIndexByte(content, ')')
+	if i < 0 {
+		return errors.Errorf("invalid stat of %d", r.pid)
+	}
+	// fields[0] is the 3rd field: state
+	fields := strings.Fields(string(content[i+1:]))
+	if len(fields) < 22 {
+		return errors.Errorf("invalid stat of %d", r.pid)
+	}
+	field := func(n int) float64 {
+		v, _ := strconv.ParseFloat(fields[n-3], 64)
+		return v
+	}
+	r.cpuSeconds = float64Ptr((field(14) + field(15)) / clockTicks)
+	r.threads = float64Ptr(field(20))
+	r.virtualBytes = float64Ptr(field(23))
+	r.residentBytes = float64Ptr(field(24) * float64(os.Getpagesize()))
+	return nil
+}
+
+func (r *processResource) readStatus() {
+	values := readKeyValues(procPath(r.pid, "status"), ":")
+	if v, ok := values["voluntary_ctxt_switches"]; ok {
+		r.voluntarySwitches = float64Ptr(v)
+	}
+	if v, ok := values["nonvoluntary_ctxt_switches"]; ok {
+		r.involuntarySwitch = float64Ptr(v)
+	}
+}
+
+func (r *processResource) readFds() {
+	if fds, err := ioutil.ReadDir(procPath(r.pid, "fd")); err == nil {
+		r.openFds = float64Ptr(float64(len(fds)))
+	}
+	file, err := os.Open(procPath(r.pid, "limits"))
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "Max open files") {
+			continue
+		}
+		// Max open files            655350               655350               files
+		fields := strings.Fields(strings.TrimPrefix(line, "Max open files"))
+		if len(fields) > 0 {
+			if v, err := strconv.ParseFloat(fields[0], 64); err == nil {
+				r.maxFds = float64Ptr(v)
+			}
+		}
+	}
+}
+
+func (r *processResource) readIo() {
+	values := readKeyValues(procPath(r.pid, "io"), ":")
+	if v, ok := values["read_bytes"]; ok {
+		r.readBytes = float64Ptr(v)
+	}
+	if v, ok := values["write_bytes"]; ok {
+		r.writeBytes = float64Ptr(v)
+	}
+}
+
+// readKeyValues reads lines like "key<sep> value [unit]", non-numeric values are skipped
+func readKeyValues(path string, sep string) map[string]float64 {
+	ret := make(map[string]float64)
+	file, err := os.Open(path)
+	if err != nil {
+		return ret
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		var key, rest string
+		if sep == "" {
+			fields := strings.Fields(line)
+			if len(fields) < 2 {
+				continue
+			}
+			key, rest = fields[0], fields[1]
+		} else {
+			i := strings.Index(line, sep)
+			if i < 0 {
+				continue
+			}
+			key, rest = line[:i], line[i+len(sep):]
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+		v, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			continue
+		}
+		ret[strings.TrimSpace(key)] = v
+	}
+	return ret
+}
+
+func addField(msg *message.Message, name string, value *float64) {
+	if value != nil {
+		msg.AddField(name, *value)
+	}
+}
+
+type namedValue struct {
+	name  string
+	value *float64
+}
+
+// messages gauges and counters of the process and its cgroup, e.g. process_cpu_seconds_total after exported.
+// Gauges are fields of one message, while each counter is a message with field counter,
+// as messages with the same name and tags are deduplicated when exported.
+func (r *processResource) messages(env string, t time.Time) []*message.Message {
+	var msgs []*message.Message
+	add := func(name string, cgroupTags bool, gauges []namedValue, counters []namedValue) {
+		newMessage := func(name string, metricType message.Type) *message.Message {
+			msg := message.NewMessage(name, metricType, t).
+				AddTag("name", r.name).
+				AddTag("pid", strconv.Itoa(r.pid)).
+				AddTag("env_type", env)
+			if cgroupTags {
+				msg.AddTag("cgroup_version", r.cgroup.version).
+					AddTag("cgroup", r.cgroup.path)
+			}
+			return msg
+		}
+		gauge := newMessage(name, message.Gauge)
+		for _, v := range gauges {
+			addField(gauge, v.name, v.value)
+		}
+		if len(gauge.Fields()) > 0 {
+			msgs = append(msgs, gauge)
+		}
+		for _, v := range counters {
+			if v.value != nil {
+				msgs = append(msgs, newMessage(name+"_"+v.name, message.Counter).AddField("counter", *v.value))
+			}
+		}
+	}
+	add("process", false, []namedValue{
+		{"resident_memory_bytes", r.residentBytes},
+		{"virtual_memory_bytes", r.virtualBytes},
+		{"threads", r.threads},
+		{"open_fds", r.openFds},
+		{"max_fds", r.maxFds},
+	}, []namedValue{
+		{"cpu_seconds_total", r.cpuSeconds},
+		{"voluntary_ctxt_switches_total", r.voluntarySwitches},
+		{"nonvoluntary_ctxt_switches_total", r.involuntarySwitch},
+		{"io_read_bytes_total", r.readBytes},
+		{"io_write_bytes_total", r.writeBytes},
+	})
+	if r.cgroup == nil {
+		return msgs
+	}
+	add("process_cgroup", true, []namedValue{
+		{"cpu_quota_cores", r.cgroup.cpuQuotaCores},
+		{"memory_limit_bytes", r.cgroup.memoryLimitBytes},
+		{"memory_usage_bytes", r.cgroup.memoryUsageBytes},
+	}, []namedValue{
+		{"cpu_periods_total", r.cgroup.cpuPeriods},
+		{"cpu_throttled_periods_total", r.cgroup.cpuThrottled},
+		{"cpu_throttled_seconds_total", r.cgroup.cpuThrottledSecond},
+		{"cpu_usage_seconds_total", r.cgroup.cpuUsageSeconds},
+	})
+	return msgs
+}
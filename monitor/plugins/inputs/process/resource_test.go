@@ -0,0 +1,260 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package process
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"github.com/oceanbase/obagent/monitor/message"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		require.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.Nil(t, ioutil.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+func fakeProc(t *testing.T, root string, pid int, comm string, cmdline string, cgroup string) {
+	dir := strconv.Itoa(pid)
+	writeFiles(t, root, map[string]string{
+		dir + "/comm":    comm + "\n",
+		dir + "/cmdline": cmdline,
+		dir + "/stat": dir + " (" + comm + ") S 1 1 1 0 -1 4202752 100 0 0 0 " +
+			"250 50 0 0 20 0 8 0 100 4096000 100 18446744073709551615 0 0 0 0 0 0 0 0 0 0 0 0 17 0 0 0 0 0 0",
+		dir + "/status": "Name:\t" + comm + "\nThreads:\t8\nvoluntary_ctxt_switches:\t10\nnonvoluntary_ctxt_switches:\t3\n",
+		dir + "/io":     "rchar: 100\nwchar: 200\nread_bytes: 4096\nwrite_bytes: 8192\n",
+		dir + "/limits": "Limit                     Soft Limit           Hard Limit           Units\n" +
+			"Max open files            655350               655350               files\n",
+		dir + "/fd/0":   "",
+		dir + "/fd/1":   "",
+		dir + "/cgroup": cgroup,
+	})
+}
+
+func setRoots(t *testing.T) (string, string) {
+	dir, err := ioutil.TempDir("", "process_resource")
+	require.Nil(t, err)
+	oldProcRoot, oldCgroupRoot := procRoot, cgroupRoot
+	procRoot = filepath.Join(dir, "proc")
+	cgroupRoot = filepath.Join(dir, "cgroup")
+	t.Cleanup(func() {
+		procRoot, cgroupRoot = oldProcRoot, oldCgroupRoot
+		os.RemoveAll(dir)
+	})
+	return procRoot, cgroupRoot
+}
+
+func findMessage(msgs []*message.Message, name string, metricType message.Type) *message.Message {
+	for _, msg := range msgs {
+		if msg.GetName() == name && msg.GetMetricType() == metricType {
+			return msg
+		}
+	}
+	return nil
+}
+
+func requireCounter(t *testing.T, msgs []*message.Message, name string, expected float64) {
+	counter := findMessage(msgs, name, message.Counter)
+	require.NotNil(t, counter, name)
+	requireField(t, counter, "counter", expected)
+}
+
+func requireField(t *testing.T, msg *message.Message, name string, expected float64) {
+	v, found := msg.GetField(name)
+	require.True(t, found, name)
+	require.InDelta(t, expected, v, 1e-9, name)
+}
+
+func TestProcessSelector(t *testing.T) {
+	proc, _ := setRoots(t)
+	fakeProc(t, proc, 100, "observer", "/home/admin/oceanbase/bin/observer\x00-p\x002881\x00", "0::/\n")
+	fakeProc(t, proc, 200, "obproxy", "bin/obproxy\x00-p\x002883\x00", "0::/\n")
+	fakeProc(t, proc, 300, "obproxy", "bin/obproxy\x00-p\x002893\x00", "0::/\n")
+
+	selector := &ProcessSelector{Name: "obproxy"}
+	require.Nil(t, selector.init())
+	pids, err := selector.selectPids()
+	require.Nil(t, err)
+	require.Equal(t, []int{200, 300}, pids)
+
+	selector = &ProcessSelector{Name: "obproxy", CmdlineRegex: "-p 2893"}
+	require.Nil(t, selector.init())
+	pids, _ = selector.selectPids()
+	require.Equal(t, []int{300}, pids)
+
+	pidFile := filepath.Join(proc, "observer.pid")
+	require.Nil(t, ioutil.WriteFile(pidFile, []byte("100\n"), 0644))
+	selector = &ProcessSelector{PidFile: pidFile}
+	require.Nil(t, selector.init())
+	pids, _ = selector.selectPids()
+	require.Equal(t, []int{100}, pids)
+
+	require.NotNil(t, (&ProcessSelector{}).init())
+	require.NotNil(t, (&ProcessSelector{CmdlineRegex: "("}).init())
+}
+
+func TestReadProcessResource_cgroupV1(t *testing.T) {
+	proc, cgroup := setRoots(t)
+	fakeProc(t, proc, 100, "observer", "observer", "4:memory:/ob\n3:cpu,cpuacct:/ob\n0::/\n")
+	writeFiles(t, cgroup, map[string]string{
+		"cpu,cpuacct/ob/cpu.cfs_quota_us":  "400000\n",
+		"cpu,cpuacct/ob/cpu.cfs_period_us": "100000\n",
+		"cpu,cpuacct/ob/cpu.stat":          "nr_periods 100\nnr_throttled 20\nthrottled_time 3000000000\n",
+		"cpu,cpuacct/ob/cpuacct.usage":     "5000000000\n",
+		"memory/ob/memory.limit_in_bytes":  "9223372036854771712\n",
+		"memory/ob/memory.usage_in_bytes":  "1048576\n",
+	})
+
+	resource, err := readProcessResource(100)
+	require.Nil(t, err)
+	msgs := resource.messages("host", time.Now())
+	require.Equal(t, 11, len(msgs))
+
+	gauge := findMessage(msgs, "process", message.Gauge)
+	name, _ := gauge.GetTag("name")
+	require.Equal(t, "observer", name)
+	pid, _ := gauge.GetTag("pid")
+	require.Equal(t, "100", pid)
+	requireField(t, gauge, "resident_memory_bytes", float64(100*os.Getpagesize()))
+	requireField(t, gauge, "virtual_memory_bytes", 4096000)
+	requireField(t, gauge, "threads", 8)
+	requireField(t, gauge, "open_fds", 2)
+	requireField(t, gauge, "max_fds", 655350)
+
+	requireCounter(t, msgs, "process_cpu_seconds_total", 3)
+	requireCounter(t, msgs, "process_voluntary_ctxt_switches_total", 10)
+	requireCounter(t, msgs, "process_nonvoluntary_ctxt_switches_total", 3)
+	requireCounter(t, msgs, "process_io_read_bytes_total", 4096)
+	requireCounter(t, msgs, "process_io_write_bytes_total", 8192)
+
+	cgroupGauge := findMessage(msgs, "process_cgroup", message.Gauge)
+	version, _ := cgroupGauge.GetTag("cgroup_version")
+	require.Equal(t, "v1", version)
+	requireField(t, cgroupGauge, "cpu_quota_cores", 4)
+	requireField(t, cgroupGauge, "memory_usage_bytes", 1048576)
+	_, found := cgroupGauge.GetField("memory_limit_bytes")
+	require.False(t, found)
+
+	requireCounter(t, msgs, "process_cgroup_cpu_periods_total", 100)
+	requireCounter(t, msgs, "process_cgroup_cpu_throttled_periods_total", 20)
+	requireCounter(t, msgs, "process_cgroup_cpu_throttled_seconds_total", 3)
+	requireCounter(t, msgs, "process_cgroup_cpu_usage_seconds_total", 5)
+	cgroupCounter := findMessage(msgs, "process_cgroup_cpu_periods_total", message.Counter)
+	version, _ = cgroupCounter.GetTag("cgroup_version")
+	require.Equal(t, "v1", version)
+
+	// every series reaches the exporters
+	mfs := message.CreateMetricFamily(msgs)
+	require.Equal(t, 16, len(mfs))
+	for _, name := range []string{"process_resident_memory_bytes", "process_cpu_seconds_total", "process_io_write_bytes_total",
+		"process_cgroup_memory_usage_bytes", "process_cgroup_cpu_throttled_seconds_total"} {
+		mf, ok := mfs[name]
+		require.True(t, ok, name)
+		require.Equal(t, 1, len(mf.Samples), name)
+	}
+	require.Equal(t, message.Counter, mfs["process_cpu_seconds_total"].Type)
+	require.Equal(t, message.Gauge, mfs["process_threads"].Type)
+}
+
+func TestReadProcessResource_cgroupV2(t *testing.T) {
+	proc, cgroup := setRoots(t)
+	fakeProc(t, proc, 100, "observer", "observer", "0::/system.slice/observer.service\n")
+	writeFiles(t, cgroup, map[string]string{
+		"system.slice/observer.service/cpu.max":        "200000 100000\n",
+		"system.slice/observer.service/cpu.stat":       "usage_usec 7000000\nnr_periods 50\nnr_throttled 5\nthrottled_usec 1500000\n",
+		"system.slice/observer.service/memory.max":     "max\n",
+		"system.slice/observer.service/memory.current": "2048\n",
+	})
+
+	resource, err := readProcessResource(100)
+	require.Nil(t, err)
+	msgs := resource.messages("host", time.Now())
+	cgroupGauge := findMessage(msgs, "process_cgroup", message.Gauge)
+	version, _ := cgroupGauge.GetTag("cgroup_version")
+	require.Equal(t, "v2", version)
+	path, _ := cgroupGauge.GetTag("cgroup")
+	require.Equal(t, "/system.slice/observer.service", path)
+	requireField(t, cgroupGauge, "cpu_quota_cores", 2)
+	requireField(t, cgroupGauge, "memory_usage_bytes", 2048)
+	_, found := cgroupGauge.GetField("memory_limit_bytes")
+	require.False(t, found)
+
+	requireCounter(t, msgs, "process_cgroup_cpu_throttled_periods_total", 5)
+	requireCounter(t, msgs, "process_cgroup_cpu_throttled_seconds_total", 1.5)
+	requireCounter(t, msgs, "process_cgroup_cpu_usage_seconds_total", 7)
+}
+
+func TestReadProcessResource_cgroupNotVisible(t *testing.T) {
+	proc, cgroup := setRoots(t)
+	// the cgroup of the process is not under the mounted roots, e.g. in another cgroup namespace
+	fakeProc(t, proc, 100, "observer", "observer", "4:memory:/ob\n3:cpu,cpuacct:/ob\n")
+	fakeProc(t, proc, 200, "observer", "observer", "0::/system.slice/observer.service\n")
+	writeFiles(t, cgroup, map[string]string{
+		"cpu,cpuacct/cpu.stat":         "nr_periods 100\nnr_throttled 20\nthrottled_time 3000000000\n",
+		"cpu,cpuacct/cpuacct.usage":    "5000000000\n",
+		"memory/memory.usage_in_bytes": "1048576\n",
+		"cpu.stat":                     "usage_usec 7000000\n",
+		"memory.current":               "2048\n",
+	})
+
+	for _, pid := range []int{100, 200} {
+		resource, err := readProcessResource(pid)
+		require.Nil(t, err)
+		for _, msg := range resource.messages("host", time.Now()) {
+			require.False(t, strings.HasPrefix(msg.GetName(), "process_cgroup"), msg.GetName())
+		}
+	}
+
+	// the root of the controller is the cgroup of the process only if the path is "/"
+	fakeProc(t, proc, 300, "observer", "observer", "0::/\n")
+	resource, err := readProcessResource(300)
+	require.Nil(t, err)
+	msgs := resource.messages("host", time.Now())
+	requireField(t, findMessage(msgs, "process_cgroup", message.Gauge), "memory_usage_bytes", 2048)
+	requireCounter(t, msgs, "process_cgroup_cpu_usage_seconds_total", 7)
+}
+
+func TestProcessInput_collectResources(t *testing.T) {
+	pidFile, err := ioutil.TempFile("", "pid")
+	require.Nil(t, err)
+	defer os.Remove(pidFile.Name())
+	pidFile.WriteString(strconv.Itoa(os.Getpid()))
+	pidFile.Close()
+
+	var configMap map[string]interface{}
+	require.Nil(t, yaml.Unmarshal([]byte(`
+processNames: []
+resources:
+  - pidFile: `+pidFile.Name()+`
+`), &configMap))
+	processInput := &ProcessInput{}
+	require.Nil(t, processInput.Init(context.Background(), configMap))
+	metrics, err := processInput.CollectMsgs(context.Background())
+	require.Nil(t, err)
+	counter := findMessage(metrics, "process_cpu_seconds_total", message.Counter)
+	require.NotNil(t, counter)
+	_, found := counter.GetField("counter")
+	require.True(t, found)
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package prometheus
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrometheus_BasicAuth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		username, password, ok := request.BasicAuth()
+		if !ok || username != "user" || password != "pass" {
+			writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		writer.Write([]byte("# TYPE test_metric gauge\ntest_metric 1\n"))
+	}))
+	defer server.Close()
+
+	p := newTestPrometheus(t, map[string]interface{}{
+		"disableHealthMetrics": true,
+		"basicAuth":            map[string]interface{}{"username": "user", "password": "pass"},
+	})
+	msgs, err := p.scrape(context.Background(), &Target{URL: server.URL})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(msgs))
+
+	p = newTestPrometheus(t, map[string]interface{}{"disableHealthMetrics": true})
+	_, err = p.scrape(context.Background(), &Target{URL: server.URL})
+	require.NotNil(t, err)
+}
+
+func TestPrometheus_BearerTokenFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Header.Get("Authorization") != "Bearer token1" {
+			writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		writer.Write([]byte("# TYPE test_metric gauge\ntest_metric 1\n"))
+	}))
+	defer server.Close()
+
+	tokenFile, err := ioutil.TempFile("", "token")
+	require.Nil(t, err)
+	defer os.Remove(tokenFile.Name())
+	_, err = tokenFile.WriteString("token1\n")
+	require.Nil(t, err)
+	tokenFile.Close()
+
+	p := newTestPrometheus(t, map[string]interface{}{
+		"bearerTokenFile": tokenFile.Name(),
+		"tls":             map[string]interface{}{"insecureSkipVerify": true},
+	})
+	msgs, err := p.scrape(context.Background(), &Target{URL: server.URL})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(msgs))
+}
+
+func TestPrometheus_InvalidClientConfig(t *testing.T) {
+	p := &Prometheus{}
+	err := p.Init(context.Background(), map[string]interface{}{
+		"basicAuth":   map[string]interface{}{"username": "user"},
+		"bearerToken": "token",
+	})
+	require.NotNil(t, err)
+
+	err = p.Init(context.Background(), map[string]interface{}{
+		"tls": map[string]interface{}{"caFile": "/not/exists"},
+	})
+	require.NotNil(t, err)
+}
@@ -0,0 +1,278 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+
+	"github.com/oceanbase/obagent/lib/system"
+)
+
+const (
+	defaultScheme          = "http"
+	defaultMetricsPath     = "/metrics"
+	defaultRefreshInterval = 30 * time.Second
+
+	// labels with this prefix are only used to build the target url, not attached as tags
+	reservedLabelPrefix = "__"
+	schemeLabel         = "__scheme__"
+	metricsPathLabel    = "__metrics_path__"
+	scrapeTimeoutLabel  = "__scrape_timeout__"
+	addressLabel        = "__address__"
+	instanceLabel       = "instance"
+)
+
+// FileSDConfig discovers targets from files in the format of prometheus file_sd_configs:
+// a JSON or YAML list of target groups like {"targets": ["host:port"], "labels": {"k": "v"}}.
+// Files are checked every RefreshInterval and reloaded when changed.
+type FileSDConfig struct {
+	// Files glob patterns of target files
+	Files           []string      `yaml:"files"`
+	RefreshInterval time.Duration `yaml:"refreshInterval"`
+}
+
+// ProcessSDConfig discovers targets from listening ports of local processes with the given name.
+type ProcessSDConfig struct {
+	// Name process name, e.g. obproxy
+	Name string `yaml:"name"`
+	// Ports only these ports are scraped when set, otherwise all the listening ports of the process
+	Ports       []int             `yaml:"ports"`
+	Scheme      string            `yaml:"scheme"`
+	MetricsPath string            `yaml:"metricsPath"`
+	Labels      map[string]string `yaml:"labels"`
+	// Timeout scrape timeout of the discovered targets, default httpTimeout of the input
+	Timeout         time.Duration `yaml:"timeout"`
+	RefreshInterval time.Duration `yaml:"refreshInterval"`
+}
+
+// Target a scrape target with labels attached as tags to all the metrics collected from it
+type Target struct {
+	URL     string
+	Address string
+	Labels  map[string]string
+	// Timeout overrides httpTimeout of the input when not zero
+	Timeout time.Duration
+}
+
+type discoverer interface {
+	// discover returns all the current targets
+	discover(ctx context.Context) ([]*Target, error)
+	refreshInterval() time.Duration
+}
+
+type targetGroup struct {
+	Targets []string          `yaml:"targets"`
+	Labels  map[string]string `yaml:"labels"`
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+	targets []*Target
+}
+
+type fileDiscoverer struct {
+	config *FileSDConfig
+	files  map[string]*fileState
+}
+
+func newFileDiscoverer(config *FileSDConfig) *fileDiscoverer {
+	if config.RefreshInterval <= 0 {
+		config.RefreshInterval = defaultRefreshInterval
+	}
+	return &fileDiscoverer{
+		config: config,
+		files:  make(map[string]*fileState),
+	}
+}
+
+func (d *fileDiscoverer) refreshInterval() time.Duration {
+	return d.config.RefreshInterval
+}
+
+func (d *fileDiscoverer) discover(ctx context.Context) ([]*Target, error) {
+	paths := make([]string, 0)
+	for _, pattern := range d.config.Files {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid file sd pattern %s", pattern)
+		}
+		paths = append(paths, matches...)
+	}
+	sort.Strings(paths)
+
+	files := make(map[string]*fileState, len(paths))
+	var targets []*Target
+	for _, path := range paths {
+		if _, ok := files[path]; ok {
+			continue
+		}
+		state, err := d.load(path)
+		if err != nil {
+			log.WithContext(ctx).WithError(err).Warnf("prometheus file sd load %s failed", path)
+			// keep the targets of last successful load, the file may be in the middle of writing
+			state = d.files[path]
+			if state == nil {
+				continue
+			}
+		}
+		files[path] = state
+		targets = append(targets, state.targets...)
+	}
+	d.files = files
+	return targets, nil
+}
+
+// load reads the file only if it is changed since last load
+func (d *fileDiscoverer) load(path string) (*fileState, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "stat file")
+	}
+	if state, ok := d.files[path]; ok && state.modTime.Equal(info.ModTime()) && state.size == info.Size() {
+		return state, nil
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read file")
+	}
+	var groups []*targetGroup
+	// yaml is a superset of json
+	err = yaml.Unmarshal(content, &groups)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode target groups")
+	}
+	targets := make([]*Target, 0)
+	for _, group := range groups {
+		if group == nil {
+			continue
+		}
+		var timeout time.Duration
+		if timeoutStr, ok := group.Labels[scrapeTimeoutLabel]; ok {
+			timeout, err = time.ParseDuration(timeoutStr)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid %s %s", scrapeTimeoutLabel, timeoutStr)
+			}
+		}
+		for _, address := range group.Targets {
+			target := newTarget(address, group.Labels[schemeLabel], group.Labels[metricsPathLabel], group.Labels)
+			target.Timeout = timeout
+			targets = append(targets, target)
+		}
+	}
+	return &fileState{
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		targets: targets,
+	}, nil
+}
+
+type processDiscoverer struct {
+	config  *ProcessSDConfig
+	process system.Process
+}
+
+func newProcessDiscoverer(config *ProcessSDConfig) *processDiscoverer {
+	if config.RefreshInterval <= 0 {
+		config.RefreshInterval = defaultRefreshInterval
+	}
+	return &processDiscoverer{
+		config:  config,
+		process: system.ProcessImpl{},
+	}
+}
+
+func (d *processDiscoverer) refreshInterval() time.Duration {
+	return d.config.RefreshInterval
+}
+
+func (d *processDiscoverer) discover(ctx context.Context) ([]*Target, error) {
+	processInfos, err := d.process.FindProcessInfoByName(d.config.Name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "find process %s", d.config.Name)
+	}
+	allowed := make(map[int]bool, len(d.config.Ports))
+	for _, port := range d.config.Ports {
+		allowed[port] = true
+	}
+	seen := make(map[int]bool)
+	targets := make([]*Target, 0)
+	for _, processInfo := range processInfos {
+		for _, port := range processInfo.Ports {
+			if (len(allowed) > 0 && !allowed[port]) || seen[port] {
+				continue
+			}
+			seen[port] = true
+			address := fmt.Sprintf("127.0.0.1:%d", port)
+			target := newTarget(address, d.config.Scheme, d.config.MetricsPath, d.config.Labels)
+			target.Timeout = d.config.Timeout
+			targets = append(targets, target)
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].URL < targets[j].URL
+	})
+	return targets, nil
+}
+
+// newTarget builds target url from address, an address already with scheme is used as the url.
+// Labels prefixed with __ are dropped, the instance label defaults to the address.
+func newTarget(address string, scheme string, metricsPath string, labels map[string]string) *Target {
+	if scheme == "" {
+		scheme = defaultScheme
+	}
+	if metricsPath == "" {
+		metricsPath = defaultMetricsPath
+	}
+	if !strings.HasPrefix(metricsPath, "/") {
+		metricsPath = "/" + metricsPath
+	}
+	url := address
+	if strings.Contains(address, "://") {
+		address = hostOf(address)
+	} else {
+		url = scheme + "://" + address + metricsPath
+	}
+	targetLabels := map[string]string{instanceLabel: address}
+	for k, v := range labels {
+		if strings.HasPrefix(k, reservedLabelPrefix) {
+			continue
+		}
+		targetLabels[k] = v
+	}
+	return &Target{
+		URL:     url,
+		Address: address,
+		Labels:  targetLabels,
+	}
+}
+
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Host
+}
@@ -0,0 +1,140 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package prometheus
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oceanbase/obagent/lib/system"
+	"github.com/oceanbase/obagent/monitor/message"
+)
+
+type fakeProcess struct {
+	system.ProcessImpl
+	processes []*system.ProcessInfo
+}
+
+func (f fakeProcess) FindProcessInfoByName(name string) ([]*system.ProcessInfo, error) {
+	return f.processes, nil
+}
+
+func TestFileDiscoverer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "prometheus_sd")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	jsonFile := filepath.Join(dir, "a.json")
+	require.Nil(t, ioutil.WriteFile(jsonFile, []byte(`[
+  {"targets": ["127.0.0.1:2884"], "labels": {"app": "obproxy", "__metrics_path__": "/metrics/obproxy"}}
+]`), 0644))
+	yamlFile := filepath.Join(dir, "b.yaml")
+	require.Nil(t, ioutil.WriteFile(yamlFile, []byte(`
+- targets: [ "127.0.0.1:9100", "http://127.0.0.1:9101/custom" ]
+  labels:
+    __scheme__: https
+`), 0644))
+
+	d := newFileDiscoverer(&FileSDConfig{Files: []string{filepath.Join(dir, "*.json"), filepath.Join(dir, "*.yaml")}})
+	targets, err := d.discover(context.Background())
+	require.Nil(t, err)
+	require.Equal(t, 3, len(targets))
+	require.Equal(t, "http://127.0.0.1:2884/metrics/obproxy", targets[0].URL)
+	require.Equal(t, map[string]string{"app": "obproxy", "instance": "127.0.0.1:2884"}, targets[0].Labels)
+	require.Equal(t, "https://127.0.0.1:9100/metrics", targets[1].URL)
+	require.Equal(t, "http://127.0.0.1:9101/custom", targets[2].URL)
+
+	// broken file keeps the last targets
+	require.Nil(t, ioutil.WriteFile(jsonFile, []byte(`[{"targets": `), 0644))
+	require.Nil(t, os.Chtimes(jsonFile, time.Now(), time.Now().Add(time.Second)))
+	targets, err = d.discover(context.Background())
+	require.Nil(t, err)
+	require.Equal(t, 3, len(targets))
+
+	// removed file removes its targets
+	require.Nil(t, os.Remove(yamlFile))
+	targets, err = d.discover(context.Background())
+	require.Nil(t, err)
+	require.Equal(t, 1, len(targets))
+}
+
+func TestProcessDiscoverer(t *testing.T) {
+	d := newProcessDiscoverer(&ProcessSDConfig{
+		Name:   "obproxy",
+		Ports:  []int{2884, 2886},
+		Labels: map[string]string{"app": "obproxy"},
+	})
+	d.process = fakeProcess{processes: []*system.ProcessInfo{
+		{Pid: 1, Name: "obproxy", Ports: []int{2883, 2884}},
+		{Pid: 2, Name: "obproxy", Ports: []int{2885, 2886}},
+	}}
+	targets, err := d.discover(context.Background())
+	require.Nil(t, err)
+	require.Equal(t, 2, len(targets))
+	require.Equal(t, "http://127.0.0.1:2884/metrics", targets[0].URL)
+	require.Equal(t, "http://127.0.0.1:2886/metrics", targets[1].URL)
+	require.Equal(t, map[string]string{"app": "obproxy", "instance": "127.0.0.1:2886"}, targets[1].Labels)
+}
+
+func TestPrometheus_CollectDiscovered(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Write([]byte("# TYPE test_metric gauge\ntest_metric{app=\"x\"} 1\n"))
+	}))
+	defer server.Close()
+	address := strings.TrimPrefix(server.URL, "http://")
+
+	dir, err := ioutil.TempDir("", "prometheus_sd")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	targetFile := filepath.Join(dir, "targets.yaml")
+
+	p := &Prometheus{}
+	err = p.Init(context.Background(), map[string]interface{}{
+		"fileSD": []map[string]interface{}{{
+			"files":           []string{targetFile},
+			"refreshInterval": "10ms",
+		}},
+		"disableHealthMetrics": true,
+	})
+	require.Nil(t, err)
+	require.Nil(t, p.Start(make(chan []*message.Message, 1)))
+	defer p.Stop()
+
+	msgs, err := p.CollectMsgs(context.Background())
+	require.Nil(t, err)
+	require.Equal(t, 0, len(msgs))
+
+	require.Nil(t, ioutil.WriteFile(targetFile, []byte("- targets: ['"+address+"']\n  labels: {app: obproxy, cluster: c1}\n"), 0644))
+	require.Eventually(t, func() bool {
+		return len(p.targets()) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	msgs, err = p.CollectMsgs(context.Background())
+	require.Nil(t, err)
+	require.Equal(t, 1, len(msgs))
+	app, _ := msgs[0].GetTag("app")
+	require.Equal(t, "obproxy", app)
+	cluster, _ := msgs[0].GetTag("cluster")
+	require.Equal(t, "c1", cluster)
+	instance, _ := msgs[0].GetTag("instance")
+	require.Equal(t, address, instance)
+}
@@ -14,6 +14,7 @@ package prometheus
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"sync"
 	"time"
@@ -30,12 +31,40 @@ import (
 const sampleConfig = `
 addresses:['http://127.0.0.1:9090/metrics/node', 'http://127.0.0.1:9091/metrics/node']
 httpTimeout: 10s
+honorLabels: false
+basicAuth:
+  username: user
+  password: pass
+tls:
+  caFile: /home/admin/obagent/conf/ca.pem
+  insecureSkipVerify: false
+relabelConfigs:
+  - sourceLabels: [app]
+    regex: obproxy
+    action: keep
+fileSD:
+  - files: ['/home/admin/obagent/conf/targets/*.json']
+    refreshInterval: 30s
+processSD:
+  - name: obproxy
+    ports: [2884]
+    metricsPath: /metrics
+    timeout: 5s
+    labels:
+      app: obproxy
 `
 
 const description = `
 collect from http server via prometheus protocol
 `
 
+const (
+	upMetric             = "up"
+	scrapeDurationMetric = "scrape_duration_seconds"
+	scrapeSamplesMetric  = "scrape_samples_scraped"
+	exportedLabelPrefix  = "exported_"
+)
+
 var defaultTimeout = 10 * time.Second
 var defaultCollectInterval = 15 * time.Second
 
@@ -43,6 +72,34 @@ type Config struct {
 	Addresses       []string      `yaml:"addresses"`
 	HttpTimeout     time.Duration `yaml:"httpTimeout"`
 	CollectInterval time.Duration `yaml:"collect_interval"`
+	// FileSD and ProcessSD discover targets dynamically besides the static addresses
+	FileSD    []*FileSDConfig    `yaml:"fileSD"`
+	ProcessSD []*ProcessSDConfig `yaml:"processSD"`
+	// HonorLabels keeps the scraped labels when conflicting with target labels,
+	// otherwise the scraped ones are renamed to exported_<label>
+	HonorLabels bool `yaml:"honorLabels"`
+	// RelabelConfigs rewrite or filter target labels before scraping
+	RelabelConfigs  []*RelabelConfig `yaml:"relabelConfigs"`
+	BasicAuth       *BasicAuthConfig `yaml:"basicAuth"`
+	BearerToken     string           `yaml:"bearerToken"`
+	BearerTokenFile string           `yaml:"bearerTokenFile"`
+	TLS             *TLSConfig       `yaml:"tls"`
+	// DisableHealthMetrics stops emitting up, scrape_duration_seconds and scrape_samples_scraped of each target
+	DisableHealthMetrics bool `yaml:"disableHealthMetrics"`
+}
+
+const maskedSecret = "xxx"
+
+// String the bearer token and basic auth password are masked for logging
+func (c *Config) String() string {
+	masked := *c
+	if masked.BearerToken != "" {
+		masked.BearerToken = maskedSecret
+	}
+	if masked.BasicAuth != nil {
+		masked.BasicAuth = &BasicAuthConfig{Username: c.BasicAuth.Username, Password: maskedSecret}
+	}
+	return fmt.Sprintf("%+v, basicAuth: %+v", masked, masked.BasicAuth)
 }
 
 type Prometheus struct {
@@ -51,6 +108,11 @@ type Prometheus struct {
 	config     *Config
 	httpClient *http.Client
 
+	discoverers []discoverer
+	// discovered targets of each discoverer
+	discovered  [][]*Target
+	targetsLock sync.RWMutex
+
 	ctx  context.Context
 	done chan struct{}
 }
@@ -67,17 +129,40 @@ func (p *Prometheus) Init(ctx context.Context, config map[string]interface{}) er
 		return errors.Wrap(err, "prometheus input decode config")
 	}
 	log.WithContext(ctx).Infof("prometheus input config : %v", p.config)
-	p.httpClient = &http.Client{}
+	p.httpClient, err = p.newHttpClient()
+	if err != nil {
+		return errors.Wrap(err, "prometheus input create http client")
+	}
 	if p.config.HttpTimeout == 0 {
-		p.httpClient.Timeout = defaultTimeout
-	} else {
-		p.httpClient.Timeout = p.config.HttpTimeout
+		p.config.HttpTimeout = defaultTimeout
+	}
+	for _, relabelConfig := range p.config.RelabelConfigs {
+		err = relabelConfig.init()
+		if err != nil {
+			return errors.Wrap(err, "prometheus input init relabel config")
+		}
 	}
 	p.ctx = ctx
 	p.done = make(chan struct{})
 	if p.config.CollectInterval == 0 {
 		p.config.CollectInterval = defaultCollectInterval
 	}
+	for _, fileSDConfig := range p.config.FileSD {
+		if len(fileSDConfig.Files) == 0 {
+			return errors.New("prometheus input files of fileSD is empty")
+		}
+		p.discoverers = append(p.discoverers, newFileDiscoverer(fileSDConfig))
+	}
+	for _, processSDConfig := range p.config.ProcessSD {
+		if processSDConfig.Name == "" {
+			return errors.New("prometheus input name of processSD is empty")
+		}
+		p.discoverers = append(p.discoverers, newProcessDiscoverer(processSDConfig))
+	}
+	p.discovered = make([][]*Target, len(p.discoverers))
+	for i := range p.discoverers {
+		p.refresh(ctx, i)
+	}
 
 	return nil
 }
@@ -92,10 +177,76 @@ func (p *Prometheus) Description() string {
 
 func (p *Prometheus) Start(out chan<- []*message.Message) error {
 	log.WithContext(p.ctx).Info("start prometheusInput")
+	for i := range p.discoverers {
+		go p.watch(p.ctx, i)
+	}
 	go p.update(p.ctx, out)
 	return nil
 }
 
+// watch refreshes targets of the discoverer periodically, so targets are added or removed without restart
+func (p *Prometheus) watch(ctx context.Context, i int) {
+	ticker := time.NewTicker(p.discoverers[i].refreshInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.refresh(ctx, i)
+		case <-p.done:
+			return
+		}
+	}
+}
+
+func (p *Prometheus) refresh(ctx context.Context, i int) {
+	targets, err := p.discoverers[i].discover(ctx)
+	if err != nil {
+		// keep the targets discovered last time
+		log.WithContext(ctx).WithError(err).Warn("prometheus input discover targets failed")
+		return
+	}
+	p.targetsLock.Lock()
+	p.discovered[i] = targets
+	p.targetsLock.Unlock()
+}
+
+// targets returns static addresses and all the discovered targets after relabel,
+// duplicated urls are scraped only once
+func (p *Prometheus) targets() []*Target {
+	all := make([]*Target, 0, len(p.config.Addresses))
+	for _, address := range p.config.Addresses {
+		all = append(all, &Target{URL: address, Address: hostOf(address)})
+	}
+	p.targetsLock.RLock()
+	for _, targets := range p.discovered {
+		all = append(all, targets...)
+	}
+	p.targetsLock.RUnlock()
+
+	ret := make([]*Target, 0, len(all))
+	seen := make(map[string]bool)
+	for _, target := range all {
+		if seen[target.URL] {
+			continue
+		}
+		seen[target.URL] = true
+		if len(p.config.RelabelConfigs) > 0 {
+			labels := make(map[string]string, len(target.Labels)+1)
+			for k, v := range target.Labels {
+				labels[k] = v
+			}
+			labels[addressLabel] = target.Address
+			labels, keep := relabel(p.config.RelabelConfigs, labels)
+			if !keep {
+				continue
+			}
+			target = &Target{URL: target.URL, Address: target.Address, Labels: labels, Timeout: target.Timeout}
+		}
+		ret = append(ret, target)
+	}
+	return ret
+}
+
 func (p *Prometheus) update(ctx context.Context, out chan<- []*message.Message) {
 	ticker := time.NewTicker(p.config.CollectInterval)
 	defer ticker.Stop()
@@ -128,45 +279,104 @@ func (p *Prometheus) CollectMsgs(ctx context.Context) ([]*message.Message, error
 	var metricsTotal []*message.Message
 	var wg sync.WaitGroup
 	var mutex sync.Mutex
-	for _, address := range p.config.Addresses {
+	for _, target := range p.targets() {
 		wg.Add(1)
-		go collect(ctx, p.httpClient, address, &metricsTotal, &wg, &mutex)
+		go func(target *Target) {
+			defer wg.Done()
+			metrics := p.collect(ctx, target)
+			mutex.Lock()
+			metricsTotal = append(metricsTotal, metrics...)
+			mutex.Unlock()
+		}(target)
 	}
 	wg.Wait()
 
 	return metricsTotal, nil
 }
 
-func collect(ctx context.Context, client *http.Client, url string, metricsTotal *[]*message.Message, waitGroup *sync.WaitGroup, mutex *sync.Mutex) {
-	defer waitGroup.Done()
+// collect scrapes the target, and appends health metrics of the scrape unless disabled
+func (p *Prometheus) collect(ctx context.Context, target *Target) []*message.Message {
+	start := time.Now()
+	metrics, err := p.scrape(ctx, target)
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Warnf("prometheus input scrape %s failed", target.URL)
+	}
+	if p.config.DisableHealthMetrics {
+		return metrics
+	}
+	up := 1.0
+	if err != nil {
+		up = 0
+	}
+	return append(metrics,
+		p.newHealthMetric(target, upMetric, start, up),
+		p.newHealthMetric(target, scrapeDurationMetric, start, time.Since(start).Seconds()),
+		p.newHealthMetric(target, scrapeSamplesMetric, start, float64(len(metrics))))
+}
 
-	entry := log.WithContext(context.WithValue(ctx, agentlog.StartTimeKey, time.Now())).WithField("prometheus url", url)
-	resp, err := client.Get(url)
+func (p *Prometheus) newHealthMetric(target *Target, name string, t time.Time, value float64) *message.Message {
+	msg := message.NewMessage(name, message.Gauge, t).AddField("value", value)
+	for k, v := range target.Labels {
+		msg.AddTag(k, v)
+	}
+	if _, ok := target.Labels[instanceLabel]; !ok {
+		msg.AddTag(instanceLabel, target.Address)
+	}
+	return msg
+}
+
+func (p *Prometheus) scrape(ctx context.Context, target *Target) ([]*message.Message, error) {
+	timeout := p.config.HttpTimeout
+	if target.Timeout > 0 {
+		timeout = target.Timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	entry := log.WithContext(context.WithValue(ctx, agentlog.StartTimeKey, time.Now())).WithField("prometheus url", target.URL)
+	req, err := p.newRequest(ctx, target.URL)
+	if err != nil {
+		return nil, errors.Wrap(err, "create request")
+	}
+	resp, err := p.httpClient.Do(req)
 	entry.Debug("get message end")
 	if err != nil {
-		log.WithContext(ctx).WithError(err).Warn("http client collect failed")
-		return
+		return nil, errors.Wrap(err, "http client collect failed")
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		log.WithContext(ctx).Warnf("http get resp failed status code is %d", resp.StatusCode)
-		return
+		return nil, errors.Errorf("http get resp failed status code is %d", resp.StatusCode)
 	}
 
 	var parser expfmt.TextParser
 	metricFamilies, err := parser.TextToMetricFamilies(resp.Body)
 	if err != nil {
-		log.WithContext(ctx).WithError(err).Warn("read text format failed")
-		return
+		return nil, errors.Wrap(err, "read text format failed")
 	}
 
 	var metrics []*message.Message
 	for _, metricFamily := range metricFamilies {
 		msgs := message.ParseFromMetricFamily(metricFamily)
+		for _, msg := range msgs {
+			p.attachTargetLabels(msg, target)
+		}
 		metrics = append(metrics, msgs...)
 	}
-	mutex.Lock()
-	*metricsTotal = append(*metricsTotal, metrics...)
-	mutex.Unlock()
+	return metrics, nil
+}
+
+// attachTargetLabels sets target labels as tags, conflicting scraped labels are kept when honorLabels,
+// otherwise renamed to exported_<label>, the same as prometheus honor_labels
+func (p *Prometheus) attachTargetLabels(msg *message.Message, target *Target) {
+	for k, v := range target.Labels {
+		scraped, exists := msg.GetTag(k)
+		if exists {
+			if p.config.HonorLabels {
+				continue
+			}
+			msg.SetTag(exportedLabelPrefix+k, scraped)
+		}
+		msg.SetTag(k, v)
+	}
 }
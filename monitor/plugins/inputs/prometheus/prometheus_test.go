@@ -15,11 +15,16 @@ package prometheus
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/oceanbase/obagent/monitor/message"
 )
 
 func TestPrometheus_Collect(t *testing.T) {
@@ -533,3 +538,104 @@ promhttp_metric_handler_requests_total{code="200"} 2
 promhttp_metric_handler_requests_total{code="500"} 0
 promhttp_metric_handler_requests_total{code="503"} 0
 `
+
+func newTestPrometheus(t *testing.T, config map[string]interface{}) *Prometheus {
+	p := &Prometheus{}
+	require.Nil(t, p.Init(context.Background(), config))
+	return p
+}
+
+func findMessage(msgs []*message.Message, name string, url string) *message.Message {
+	for _, msg := range msgs {
+		instance, _ := msg.GetTag("instance")
+		if msg.GetName() == name && strings.Contains(url, instance) {
+			return msg
+		}
+	}
+	return nil
+}
+
+func TestPrometheus_HealthMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Write([]byte("# TYPE test_metric gauge\ntest_metric{app=\"x\"} 1\ntest_metric{app=\"y\"} 2\n"))
+	}))
+	defer server.Close()
+	slowServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		writer.Write([]byte("# TYPE test_metric gauge\ntest_metric 1\n"))
+	}))
+	defer slowServer.Close()
+
+	p := newTestPrometheus(t, map[string]interface{}{
+		"addresses":   []string{server.URL + "/metrics", slowServer.URL + "/metrics"},
+		"httpTimeout": "50ms",
+	})
+	msgs, err := p.CollectMsgs(context.Background())
+	require.Nil(t, err)
+	require.Equal(t, 2+3+3, len(msgs))
+
+	up := findMessage(msgs, "up", server.URL)
+	require.NotNil(t, up)
+	value, _ := up.GetField("value")
+	require.Equal(t, 1.0, value)
+	samples := findMessage(msgs, "scrape_samples_scraped", server.URL)
+	value, _ = samples.GetField("value")
+	require.Equal(t, 2.0, value)
+	require.NotNil(t, findMessage(msgs, "scrape_duration_seconds", server.URL))
+
+	up = findMessage(msgs, "up", slowServer.URL)
+	value, _ = up.GetField("value")
+	require.Equal(t, 0.0, value)
+}
+
+func TestPrometheus_TargetTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		writer.Write([]byte("# TYPE test_metric gauge\ntest_metric 1\n"))
+	}))
+	defer server.Close()
+
+	p := newTestPrometheus(t, map[string]interface{}{"httpTimeout": "10ms"})
+	msgs := p.collect(context.Background(), &Target{URL: server.URL, Address: hostOf(server.URL), Timeout: time.Second})
+	up := findMessage(msgs, "up", server.URL)
+	value, _ := up.GetField("value")
+	require.Equal(t, 1.0, value)
+}
+
+func TestPrometheus_HonorLabels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Write([]byte("# TYPE test_metric gauge\ntest_metric{app=\"x\"} 1\n"))
+	}))
+	defer server.Close()
+	target := &Target{URL: server.URL, Labels: map[string]string{"app": "obproxy", "cluster": "c1"}}
+
+	p := newTestPrometheus(t, map[string]interface{}{"disableHealthMetrics": true})
+	msgs := p.collect(context.Background(), target)
+	require.Equal(t, 1, len(msgs))
+	app, _ := msgs[0].GetTag("app")
+	require.Equal(t, "obproxy", app)
+	exported, _ := msgs[0].GetTag("exported_app")
+	require.Equal(t, "x", exported)
+
+	p = newTestPrometheus(t, map[string]interface{}{"disableHealthMetrics": true, "honorLabels": true})
+	msgs = p.collect(context.Background(), target)
+	app, _ = msgs[0].GetTag("app")
+	require.Equal(t, "x", app)
+	_, found := msgs[0].GetTag("exported_app")
+	require.False(t, found)
+	cluster, _ := msgs[0].GetTag("cluster")
+	require.Equal(t, "c1", cluster)
+}
+
+func TestConfig_String(t *testing.T) {
+	config := &Config{
+		Addresses:   []string{"http://127.0.0.1:9101/metrics"},
+		BearerToken: "secret-token",
+		BasicAuth:   &BasicAuthConfig{Username: "user", Password: "secret-pass"},
+	}
+	str := fmt.Sprintf("%v", config)
+	require.NotContains(t, str, "secret")
+	require.Contains(t, str, "user")
+	require.Equal(t, "secret-pass", config.BasicAuth.Password)
+	require.Equal(t, "secret-token", config.BearerToken)
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package prometheus
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type RelabelAction string
+
+const (
+	RelabelReplace   RelabelAction = "replace"
+	RelabelKeep      RelabelAction = "keep"
+	RelabelDrop      RelabelAction = "drop"
+	RelabelLabelDrop RelabelAction = "labeldrop"
+	RelabelLabelKeep RelabelAction = "labelkeep"
+)
+
+const (
+	defaultRelabelSeparator   = ";"
+	defaultRelabelRegex       = "(.*)"
+	defaultRelabelReplacement = "$1"
+)
+
+// RelabelConfig rewrites target labels before scraping, the same semantics as prometheus relabel_configs:
+// replace sets TargetLabel to Replacement expanded with the match of joined SourceLabels,
+// keep and drop filter targets, labelkeep and labeldrop filter label names.
+type RelabelConfig struct {
+	SourceLabels []string      `yaml:"sourceLabels"`
+	Separator    string        `yaml:"separator"`
+	Regex        string        `yaml:"regex"`
+	TargetLabel  string        `yaml:"targetLabel"`
+	Replacement  *string       `yaml:"replacement"`
+	Action       RelabelAction `yaml:"action"`
+
+	regex *regexp.Regexp
+}
+
+func (r *RelabelConfig) init() error {
+	if r.Action == "" {
+		r.Action = RelabelReplace
+	}
+	if r.Separator == "" {
+		r.Separator = defaultRelabelSeparator
+	}
+	if r.Regex == "" {
+		r.Regex = defaultRelabelRegex
+	}
+	if r.Replacement == nil {
+		replacement := defaultRelabelReplacement
+		r.Replacement = &replacement
+	}
+	switch r.Action {
+	case RelabelReplace:
+		if r.TargetLabel == "" {
+			return errors.New("targetLabel of replace relabel is empty")
+		}
+	case RelabelKeep, RelabelDrop, RelabelLabelDrop, RelabelLabelKeep:
+	default:
+		return errors.Errorf("unknown relabel action %s", r.Action)
+	}
+	var err error
+	r.regex, err = regexp.Compile("^(?:" + r.Regex + ")$")
+	if err != nil {
+		return errors.Wrapf(err, "invalid relabel regex %s", r.Regex)
+	}
+	return nil
+}
+
+// relabel applies the configs in order to a copy of labels, returns false if the target is dropped.
+// Labels prefixed with __ are removed after relabel, they can be used as temporary labels.
+func relabel(configs []*RelabelConfig, labels map[string]string) (map[string]string, bool) {
+	ret := make(map[string]string, len(labels))
+	for k, v := range labels {
+		ret[k] = v
+	}
+	for _, config := range configs {
+		values := make([]string, len(config.SourceLabels))
+		for i, name := range config.SourceLabels {
+			values[i] = ret[name]
+		}
+		value := strings.Join(values, config.Separator)
+		switch config.Action {
+		case RelabelKeep:
+			if !config.regex.MatchString(value) {
+				return nil, false
+			}
+		case RelabelDrop:
+			if config.regex.MatchString(value) {
+				return nil, false
+			}
+		case RelabelLabelDrop:
+			for name := range ret {
+				if config.regex.MatchString(name) {
+					delete(ret, name)
+				}
+			}
+		case RelabelLabelKeep:
+			for name := range ret {
+				if !config.regex.MatchString(name) {
+					delete(ret, name)
+				}
+			}
+		default:
+			indexes := config.regex.FindStringSubmatchIndex(value)
+			if indexes == nil {
+				continue
+			}
+			result := string(config.regex.ExpandString(nil, *config.Replacement, value, indexes))
+			if result == "" {
+				delete(ret, config.TargetLabel)
+			} else {
+				ret[config.TargetLabel] = result
+			}
+		}
+	}
+	for name := range ret {
+		if strings.HasPrefix(name, reservedLabelPrefix) {
+			delete(ret, name)
+		}
+	}
+	return ret, true
+}
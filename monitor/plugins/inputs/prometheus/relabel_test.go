@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package prometheus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func newRelabelConfigs(t *testing.T, configStr string) []*RelabelConfig {
+	var configs []*RelabelConfig
+	require.Nil(t, yaml.Unmarshal([]byte(configStr), &configs))
+	for _, config := range configs {
+		require.Nil(t, config.init())
+	}
+	return configs
+}
+
+func TestRelabel(t *testing.T) {
+	configs := newRelabelConfigs(t, `
+- sourceLabels: [app]
+  regex: obproxy|observer
+  action: keep
+- sourceLabels: [__address__]
+  regex: '(.*):(\d+)'
+  targetLabel: port
+  replacement: $2
+- sourceLabels: [app, port]
+  separator: '-'
+  targetLabel: job
+- regex: tmp_.*
+  action: labeldrop
+`)
+	labels, keep := relabel(configs, map[string]string{"app": "obproxy", "tmp_a": "1", "__address__": "127.0.0.1:2884"})
+	require.True(t, keep)
+	require.Equal(t, map[string]string{"app": "obproxy", "port": "2884", "job": "obproxy-2884"}, labels)
+
+	_, keep = relabel(configs, map[string]string{"app": "node"})
+	require.False(t, keep)
+
+	configs = newRelabelConfigs(t, `
+- sourceLabels: [env]
+  regex: test
+  action: drop
+- regex: app|env
+  action: labelkeep
+`)
+	_, keep = relabel(configs, map[string]string{"env": "test"})
+	require.False(t, keep)
+	labels, keep = relabel(configs, map[string]string{"env": "prod", "app": "x", "other": "y"})
+	require.True(t, keep)
+	require.Equal(t, map[string]string{"env": "prod", "app": "x"}, labels)
+}
+
+func TestRelabelConfig_invalid(t *testing.T) {
+	require.NotNil(t, (&RelabelConfig{}).init())
+	require.NotNil(t, (&RelabelConfig{Action: "unknown"}).init())
+	require.NotNil(t, (&RelabelConfig{Action: RelabelKeep, Regex: "("}).init())
+}
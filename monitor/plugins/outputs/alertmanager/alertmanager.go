@@ -185,7 +185,15 @@ func (a *AlertmanagerOutput) convertMetricToAlarm(metric *message.Message) map[s
 	labels := metric.Tags()
 	labels = append(labels, message.TagEntry{"alertname", metric.GetName()})
 	//labels["alertname"] = metric.GetName()
-	annotations := metric.Fields()
+	annotations := make([]message.FieldEntry, 0, len(metric.Fields()))
+	for _, field := range metric.Fields() {
+		// resolved alerts carry the resolve time in endsAt
+		if field.Name == "endsAt" {
+			alarmItem["endsAt"] = field.Value
+			continue
+		}
+		annotations = append(annotations, field)
+	}
 
 	alarmItem["labels"] = labels
 	alarmItem["annotations"] = annotations
@@ -0,0 +1,503 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package pushhttp
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/oceanbase/obagent/errors"
+	"github.com/oceanbase/obagent/lib/path"
+	"github.com/oceanbase/obagent/stat"
+)
+
+const (
+	DefaultSpoolMaxBytes       = 256 * 1024 * 1024
+	DefaultSpoolMaxAge         = time.Hour * 6
+	DefaultSpoolSegmentBytes   = 8 * 1024 * 1024
+	DefaultSpoolReplayInterval = time.Second * 5
+
+	spoolSegmentSuffix = ".seg"
+	spoolCursorFile    = "cursor.json"
+	// write time (8 bytes) + payload length (4 bytes) + payload crc32 (4 bytes)
+	spoolRecordHeaderSize = 16
+)
+
+var spoolDirNameRegex = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+
+// SpoolConfig the disk spool keeps the push payloads which failed to send or were evicted
+// from a full task queue, and replays them in order when the target is reachable again.
+// New payloads are appended to the spool while it is not empty, so they are not sent before the older ones.
+type SpoolConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Dir where segment files are stored, default to <runDir>/http_output_spool/<target>
+	Dir            string        `yaml:"dir"`
+	MaxBytes       int64         `yaml:"maxBytes"`
+	MaxAge         time.Duration `yaml:"maxAge"`
+	SegmentBytes   int64         `yaml:"segmentBytes"`
+	ReplayInterval time.Duration `yaml:"replayInterval"`
+}
+
+func (c *SpoolConfig) fillDefault(senderConfig HttpSenderConfig) {
+	if c.Dir == "" {
+		name := strings.Trim(spoolDirNameRegex.ReplaceAllString(senderConfig.TargetAddress+senderConfig.APIUrl, "_"), "_")
+		c.Dir = filepath.Join(path.RunDir(), "http_output_spool", name)
+	}
+	if c.MaxBytes <= 0 {
+		c.MaxBytes = DefaultSpoolMaxBytes
+	}
+	if c.MaxAge <= 0 {
+		c.MaxAge = DefaultSpoolMaxAge
+	}
+	if c.SegmentBytes <= 0 {
+		c.SegmentBytes = DefaultSpoolSegmentBytes
+	}
+	if c.ReplayInterval <= 0 {
+		c.ReplayInterval = DefaultSpoolReplayInterval
+	}
+}
+
+type spoolSegment struct {
+	seq       int64
+	size      int64
+	records   int64
+	lastWrite time.Time
+}
+
+type spoolCursor struct {
+	Segment int64 `json:"segment"`
+	Offset  int64 `json:"offset"`
+}
+
+// diskSpool is an append-only queue made of segment files.
+// Records are appended to the last segment, and consumed from the cursor at the first segment.
+// Fully consumed segments are removed, and the oldest segments are dropped when size or age exceeds the limit.
+type diskSpool struct {
+	config  SpoolConfig
+	apiPath string
+
+	mutex    sync.Mutex
+	segments []*spoolSegment
+	writer   *os.File
+	reader   *os.File
+	cursor   spoolCursor
+	// records and bytes not consumed yet
+	records int64
+	bytes   int64
+}
+
+func openDiskSpool(config SpoolConfig, apiPath string) (*diskSpool, error) {
+	err := os.MkdirAll(config.Dir, 0755)
+	if err != nil {
+		return nil, errors.Wrap(err, "create spool dir")
+	}
+	s := &diskSpool{
+		config:  config,
+		apiPath: apiPath,
+	}
+	err = s.load()
+	if err != nil {
+		return nil, err
+	}
+	s.updateStat(time.Time{})
+	log.Infof("http output spool %s opened, records %d, bytes %d", config.Dir, s.records, s.bytes)
+	return s, nil
+}
+
+func (s *diskSpool) load() error {
+	matches, err := filepath.Glob(filepath.Join(s.config.Dir, "*"+spoolSegmentSuffix))
+	if err != nil {
+		return err
+	}
+	for _, match := range matches {
+		seq, err := strconv.ParseInt(strings.TrimSuffix(filepath.Base(match), spoolSegmentSuffix), 10, 64)
+		if err != nil {
+			log.Warnf("ignore unknown spool file %s", match)
+			continue
+		}
+		segment, err := s.scanSegment(seq)
+		if err != nil {
+			return err
+		}
+		s.segments = append(s.segments, segment)
+	}
+	sort.Slice(s.segments, func(i, j int) bool {
+		return s.segments[i].seq < s.segments[j].seq
+	})
+
+	s.loadCursor()
+	for len(s.segments) > 0 && s.segments[0].seq < s.cursor.Segment {
+		s.removeSegment(s.segments[0])
+		s.segments = s.segments[1:]
+	}
+	if len(s.segments) == 0 || s.segments[0].seq != s.cursor.Segment || s.cursor.Offset > s.segments[0].size {
+		s.cursor.Offset = 0
+	}
+	if len(s.segments) > 0 {
+		s.cursor.Segment = s.segments[0].seq
+		consumed, err := s.countRecords(s.segments[0].seq, s.cursor.Offset)
+		if err != nil {
+			s.dropMisalignedHead(err)
+		} else {
+			s.segments[0].records -= consumed
+		}
+	}
+	for _, segment := range s.segments {
+		s.records += segment.records
+		s.bytes += segment.size
+	}
+	s.bytes -= s.cursor.Offset
+	return nil
+}
+
+// dropMisalignedHead discards the head segment when the cursor is not at a record boundary,
+// e.g. the segment was truncated, the records consumed can not be told from the others.
+func (s *diskSpool) dropMisalignedHead(err error) {
+	head := s.segments[0]
+	log.WithError(err).Warnf("http output spool cursor offset %d of segment %d is invalid, discard %d records", s.cursor.Offset, head.seq, head.records)
+	stat.HttpOutputSpoolCorruptCount.With(prometheus.Labels{stat.HttpApiPath: s.apiPath}).Add(float64(head.records))
+	s.removeSegment(head)
+	s.segments = s.segments[1:]
+	s.cursor = spoolCursor{Segment: head.seq + 1}
+	if len(s.segments) > 0 {
+		s.cursor.Segment = s.segments[0].seq
+	}
+	err = s.storeCursor()
+	if err != nil {
+		log.WithError(err).Warn("store spool cursor failed")
+	}
+}
+
+func (s *diskSpool) loadCursor() {
+	content, err := os.ReadFile(filepath.Join(s.config.Dir, spoolCursorFile))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.WithError(err).Warn("read spool cursor failed, replay from the beginning")
+		}
+		return
+	}
+	err = json.Unmarshal(content, &s.cursor)
+	if err != nil {
+		log.WithError(err).Warn("decode spool cursor failed, replay from the beginning")
+		s.cursor = spoolCursor{}
+	}
+}
+
+func (s *diskSpool) storeCursor() error {
+	content, err := json.Marshal(s.cursor)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(s.config.Dir, spoolCursorFile), content, 0644)
+}
+
+// scanSegment reads all record headers of a segment, a broken tail left by a crash is truncated.
+func (s *diskSpool) scanSegment(seq int64) (*spoolSegment, error) {
+	f, err := os.OpenFile(s.segmentPath(seq), os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	segment := &spoolSegment{seq: seq}
+	for {
+		writeTime, data, err := readSpoolRecord(f, segment.size)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.WithError(err).Warnf("spool segment %s is broken at offset %d, truncate it", f.Name(), segment.size)
+			err = f.Truncate(segment.size)
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+		segment.size += int64(spoolRecordHeaderSize + len(data))
+		segment.records++
+		segment.lastWrite = writeTime
+	}
+	return segment, nil
+}
+
+func (s *diskSpool) countRecords(seq int64, until int64) (int64, error) {
+	f, err := os.Open(s.segmentPath(seq))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	var count, offset int64
+	for offset < until {
+		_, data, err := readSpoolRecord(f, offset)
+		if err != nil {
+			return 0, err
+		}
+		offset += int64(spoolRecordHeaderSize + len(data))
+		count++
+	}
+	if offset != until {
+		return 0, errors.Errorf("offset %d is not at a record boundary", until)
+	}
+	return count, nil
+}
+
+func (s *diskSpool) segmentPath(seq int64) string {
+	return filepath.Join(s.config.Dir, fmt.Sprintf("%020d%s", seq, spoolSegmentSuffix))
+}
+
+// Append writes a payload to the tail of the spool.
+func (s *diskSpool) Append(data []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.writer == nil || s.lastSegment().size >= s.config.SegmentBytes {
+		err := s.rotate()
+		if err != nil {
+			return err
+		}
+	}
+	now := time.Now()
+	buf := make([]byte, spoolRecordHeaderSize+len(data))
+	binary.BigEndian.PutUint64(buf[0:8], uint64(now.UnixNano()))
+	binary.BigEndian.PutUint32(buf[8:12], uint32(len(data)))
+	binary.BigEndian.PutUint32(buf[12:16], crc32.ChecksumIEEE(data))
+	copy(buf[spoolRecordHeaderSize:], data)
+	_, err := s.writer.Write(buf)
+	if err != nil {
+		return errors.Wrap(err, "write spool segment")
+	}
+
+	segment := s.lastSegment()
+	segment.size += int64(len(buf))
+	segment.records++
+	segment.lastWrite = now
+	s.records++
+	s.bytes += int64(len(buf))
+
+	s.dropExceeded()
+	s.updateStat(time.Time{})
+	return nil
+}
+
+func (s *diskSpool) lastSegment() *spoolSegment {
+	if len(s.segments) == 0 {
+		return nil
+	}
+	return s.segments[len(s.segments)-1]
+}
+
+func (s *diskSpool) rotate() error {
+	if s.writer != nil {
+		s.writer.Close()
+		s.writer = nil
+	}
+	seq := s.cursor.Segment
+	if last := s.lastSegment(); last != nil {
+		seq = last.seq + 1
+	}
+	f, err := os.OpenFile(s.segmentPath(seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.Wrap(err, "create spool segment")
+	}
+	s.writer = f
+	s.segments = append(s.segments, &spoolSegment{seq: seq})
+	if len(s.segments) == 1 {
+		s.cursor = spoolCursor{Segment: seq}
+	}
+	return nil
+}
+
+// dropExceeded drops the oldest segments until the spool fits in MaxBytes and MaxAge.
+// The segment being written is kept unless it is expired as a whole.
+func (s *diskSpool) dropExceeded() {
+	expireBefore := time.Now().Add(-s.config.MaxAge)
+	for len(s.segments) > 0 {
+		head := s.segments[0]
+		oversize := s.bytes > s.config.MaxBytes && len(s.segments) > 1
+		expired := head.records > 0 && head.lastWrite.Before(expireBefore)
+		if !oversize && !expired {
+			return
+		}
+		log.Warnf("http output spool exceeds limit, discard segment %d with %d records", head.seq, head.records)
+		stat.HttpOutputSpoolDiscardCount.With(prometheus.Labels{stat.HttpApiPath: s.apiPath}).Add(float64(head.records))
+		s.records -= head.records
+		s.bytes -= head.size - s.cursor.Offset
+		s.dropHead()
+	}
+}
+
+func (s *diskSpool) dropHead() {
+	head := s.segments[0]
+	if s.reader != nil {
+		s.reader.Close()
+		s.reader = nil
+	}
+	if len(s.segments) == 1 && s.writer != nil {
+		s.writer.Close()
+		s.writer = nil
+	}
+	s.removeSegment(head)
+	s.segments = s.segments[1:]
+	if len(s.segments) > 0 {
+		s.cursor = spoolCursor{Segment: s.segments[0].seq}
+	} else {
+		s.cursor = spoolCursor{Segment: head.seq + 1}
+	}
+	err := s.storeCursor()
+	if err != nil {
+		log.WithError(err).Warn("store spool cursor failed")
+	}
+}
+
+func (s *diskSpool) removeSegment(segment *spoolSegment) {
+	err := os.Remove(s.segmentPath(segment.seq))
+	if err != nil && !os.IsNotExist(err) {
+		log.WithError(err).Warnf("remove spool segment %d failed", segment.seq)
+	}
+}
+
+// Peek returns the oldest record not consumed and its position, nil if the spool is empty.
+// A corrupt record can not be skipped alone, the rest of its segment is discarded.
+func (s *diskSpool) Peek() ([]byte, spoolCursor, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.dropExceeded()
+	for {
+		for len(s.segments) > 0 {
+			head := s.segments[0]
+			if s.cursor.Offset < head.size {
+				break
+			}
+			if len(s.segments) == 1 {
+				s.updateStat(time.Time{})
+				return nil, s.cursor, nil
+			}
+			s.dropHead()
+		}
+		if len(s.segments) == 0 {
+			s.updateStat(time.Time{})
+			return nil, s.cursor, nil
+		}
+		if s.reader == nil {
+			f, err := os.Open(s.segmentPath(s.cursor.Segment))
+			if err != nil {
+				return nil, s.cursor, err
+			}
+			s.reader = f
+		}
+		writeTime, data, err := readSpoolRecord(s.reader, s.cursor.Offset)
+		if err == nil {
+			s.updateStat(writeTime)
+			return data, s.cursor, nil
+		}
+		s.dropCorruptHead(err)
+	}
+}
+
+func (s *diskSpool) dropCorruptHead(err error) {
+	head := s.segments[0]
+	log.WithError(err).Warnf("http output spool segment %d is corrupt at offset %d, discard %d records", head.seq, s.cursor.Offset, head.records)
+	stat.HttpOutputSpoolCorruptCount.With(prometheus.Labels{stat.HttpApiPath: s.apiPath}).Add(float64(head.records))
+	s.records -= head.records
+	s.bytes -= head.size - s.cursor.Offset
+	s.dropHead()
+}
+
+// Commit marks the record returned by Peek at pos as consumed.
+// It is ignored if the record was dropped after Peek, e.g. the spool exceeded its limit.
+func (s *diskSpool) Commit(pos spoolCursor, data []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.segments) == 0 || s.cursor != pos {
+		return nil
+	}
+	size := int64(spoolRecordHeaderSize + len(data))
+	s.cursor.Offset += size
+	s.segments[0].records--
+	s.records--
+	s.bytes -= size
+	s.updateStat(time.Time{})
+	return s.storeCursor()
+}
+
+// Len returns the number of records not consumed yet.
+func (s *diskSpool) Len() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.records
+}
+
+func (s *diskSpool) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.writer != nil {
+		s.writer.Close()
+		s.writer = nil
+	}
+	if s.reader != nil {
+		s.reader.Close()
+		s.reader = nil
+	}
+	return s.storeCursor()
+}
+
+func (s *diskSpool) updateStat(headWriteTime time.Time) {
+	labels := prometheus.Labels{stat.HttpApiPath: s.apiPath}
+	stat.HttpOutputSpoolRecords.With(labels).Set(float64(s.records))
+	stat.HttpOutputSpoolBytes.With(labels).Set(float64(s.bytes))
+	if s.records == 0 {
+		stat.HttpOutputSpoolReplayLagSeconds.With(labels).Set(0)
+	} else if !headWriteTime.IsZero() {
+		stat.HttpOutputSpoolReplayLagSeconds.With(labels).Set(time.Since(headWriteTime).Seconds())
+	}
+}
+
+func readSpoolRecord(r io.ReaderAt, offset int64) (time.Time, []byte, error) {
+	header := make([]byte, spoolRecordHeaderSize)
+	n, err := r.ReadAt(header, offset)
+	if n == 0 && err == io.EOF {
+		return time.Time{}, nil, io.EOF
+	}
+	if n < spoolRecordHeaderSize {
+		return time.Time{}, nil, errors.Errorf("incomplete record header, %d bytes read", n)
+	}
+	writeTime := time.Unix(0, int64(binary.BigEndian.Uint64(header[0:8])))
+	data := make([]byte, binary.BigEndian.Uint32(header[8:12]))
+	n, err = r.ReadAt(data, offset+spoolRecordHeaderSize)
+	if n < len(data) {
+		if err == nil || err == io.EOF {
+			err = errors.Errorf("incomplete record payload, %d of %d bytes read", n, len(data))
+		}
+		return time.Time{}, nil, err
+	}
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(header[12:16]) {
+		return time.Time{}, nil, errors.New("record checksum mismatch")
+	}
+	return writeTime, data, nil
+}
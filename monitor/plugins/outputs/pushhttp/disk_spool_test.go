@@ -0,0 +1,369 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package pushhttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/oceanbase/obagent/monitor/message"
+	"github.com/oceanbase/obagent/monitor/utils"
+	"github.com/oceanbase/obagent/stat"
+)
+
+func newTestSpool(t *testing.T, dir string, maxBytes int64, segmentBytes int64) *diskSpool {
+	config := SpoolConfig{
+		Enabled:      true,
+		Dir:          dir,
+		MaxBytes:     maxBytes,
+		SegmentBytes: segmentBytes,
+	}
+	config.fillDefault(HttpSenderConfig{})
+	spool, err := openDiskSpool(config, "/test")
+	assert.Nil(t, err)
+	return spool
+}
+
+func TestDiskSpool_AppendAndReplay(t *testing.T) {
+	dir := t.TempDir()
+	spool := newTestSpool(t, dir, 1024*1024, 64)
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, spool.Append([]byte(fmt.Sprintf("payload-%d", i))))
+	}
+	assert.Equal(t, int64(10), spool.records)
+	assert.True(t, len(spool.segments) > 1)
+
+	for i := 0; i < 4; i++ {
+		data, pos, err := spool.Peek()
+		assert.Nil(t, err)
+		assert.Equal(t, fmt.Sprintf("payload-%d", i), string(data))
+		assert.Nil(t, spool.Commit(pos, data))
+	}
+	assert.Nil(t, spool.Close())
+
+	// reopen to simulate restart
+	spool = newTestSpool(t, dir, 1024*1024, 64)
+	assert.Equal(t, int64(6), spool.records)
+	for i := 4; i < 10; i++ {
+		data, pos, err := spool.Peek()
+		assert.Nil(t, err)
+		assert.Equal(t, fmt.Sprintf("payload-%d", i), string(data))
+		assert.Nil(t, spool.Commit(pos, data))
+	}
+	data, _, err := spool.Peek()
+	assert.Nil(t, err)
+	assert.Nil(t, data)
+	assert.Equal(t, int64(0), spool.records)
+	assert.Equal(t, int64(0), spool.bytes)
+	assert.Nil(t, spool.Close())
+}
+
+func TestDiskSpool_DropOldestWhenExceedMaxBytes(t *testing.T) {
+	spool := newTestSpool(t, t.TempDir(), 200, 50)
+	defer spool.Close()
+	for i := 0; i < 20; i++ {
+		assert.Nil(t, spool.Append([]byte(fmt.Sprintf("payload-%02d", i))))
+	}
+	assert.True(t, spool.bytes <= 200+50)
+
+	data, _, err := spool.Peek()
+	assert.Nil(t, err)
+	assert.NotEqual(t, "payload-00", string(data))
+}
+
+func TestDiskSpool_IgnoreStaleCommit(t *testing.T) {
+	spool := newTestSpool(t, t.TempDir(), 200, 50)
+	defer spool.Close()
+	assert.Nil(t, spool.Append([]byte("payload-00")))
+	data, pos, err := spool.Peek()
+	assert.Nil(t, err)
+	assert.Equal(t, "payload-00", string(data))
+
+	// the head segment is dropped between Peek and Commit
+	for i := 1; i < 20; i++ {
+		assert.Nil(t, spool.Append([]byte(fmt.Sprintf("payload-%02d", i))))
+	}
+	cursor := spool.cursor
+	records := spool.records
+	assert.Nil(t, spool.Commit(pos, data))
+	assert.Equal(t, cursor, spool.cursor)
+	assert.Equal(t, records, spool.records)
+
+	data, pos, err = spool.Peek()
+	assert.Nil(t, err)
+	assert.Nil(t, spool.Commit(pos, data))
+	assert.Equal(t, records-1, spool.records)
+}
+
+func TestDiskSpool_SkipCorruptSegment(t *testing.T) {
+	dir := t.TempDir()
+	spool := newTestSpool(t, dir, 1024*1024, 40)
+	defer spool.Close()
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, spool.Append([]byte(fmt.Sprintf("payload-%d", i))))
+	}
+	assert.Equal(t, 2, len(spool.segments))
+
+	// flip a payload byte of the first record
+	segmentPath := filepath.Join(dir, fmt.Sprintf("%020d%s", 0, spoolSegmentSuffix))
+	f, err := os.OpenFile(segmentPath, os.O_WRONLY, 0644)
+	assert.Nil(t, err)
+	_, err = f.WriteAt([]byte("X"), spoolRecordHeaderSize)
+	assert.Nil(t, err)
+	f.Close()
+
+	data, pos, err := spool.Peek()
+	assert.Nil(t, err)
+	assert.Equal(t, "payload-2", string(data))
+	assert.Nil(t, spool.Commit(pos, data))
+	assert.Equal(t, int64(1), spool.records)
+	assert.Equal(t, float64(2), testutil.ToFloat64(stat.HttpOutputSpoolCorruptCount.With(prometheus.Labels{stat.HttpApiPath: "/test"})))
+}
+
+func TestDiskSpool_LoadMisalignedCursor(t *testing.T) {
+	dir := t.TempDir()
+	spool := newTestSpool(t, dir, 1024*1024, 40)
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, spool.Append([]byte(fmt.Sprintf("payload-%d", i))))
+	}
+	assert.Equal(t, 2, len(spool.segments))
+	spool.cursor.Offset = 3
+	assert.Nil(t, spool.Close())
+
+	spool, err := openDiskSpool(spool.config, "/misaligned")
+	assert.Nil(t, err)
+	defer spool.Close()
+	assert.Equal(t, int64(2), spool.records)
+	data, _, err := spool.Peek()
+	assert.Nil(t, err)
+	assert.Equal(t, "payload-2", string(data))
+	assert.Equal(t, float64(2), testutil.ToFloat64(stat.HttpOutputSpoolCorruptCount.With(prometheus.Labels{stat.HttpApiPath: "/misaligned"})))
+}
+
+func TestDiskSpool_TruncateBrokenTail(t *testing.T) {
+	dir := t.TempDir()
+	spool := newTestSpool(t, dir, 1024*1024, 1024)
+	assert.Nil(t, spool.Append([]byte("payload-0")))
+	assert.Nil(t, spool.Append([]byte("payload-1")))
+	assert.Nil(t, spool.Close())
+
+	segmentPath := filepath.Join(dir, fmt.Sprintf("%020d%s", 0, spoolSegmentSuffix))
+	f, err := os.OpenFile(segmentPath, os.O_WRONLY|os.O_APPEND, 0644)
+	assert.Nil(t, err)
+	_, err = f.Write([]byte{0, 1, 2})
+	assert.Nil(t, err)
+	f.Close()
+
+	spool = newTestSpool(t, dir, 1024*1024, 1024)
+	defer spool.Close()
+	assert.Equal(t, int64(2), spool.records)
+}
+
+func TestWriteWithSpool(t *testing.T) {
+	pushhttpOutput := HttpOutput{}
+	config := fmt.Sprintf(`
+    protocol: prometheus
+    exportTimestamp: true
+    timestampPrecision: millisecond
+    batchSize: 1
+    taskQueueSize: 64
+    pushTaskCount: 1
+    retryTaskCount: 4
+    retryTimes: 1
+    spool:
+      enabled: true
+      dir: %s
+      replayInterval: 100ms`, t.TempDir())
+	configMap, _ := utils.DecodeYaml(config)
+	err := pushhttpOutput.Init(context.Background(), configMap)
+	assert.Nil(t, err)
+
+	sender := &recordSender{fail: true}
+	pushhttpOutput.Sender = sender
+
+	metrics := newTestMetrics()
+	pushhttpOutput.Write(context.Background(), metrics)
+	time.Sleep(time.Millisecond * 500)
+	assert.Equal(t, int64(len(metrics)), pushhttpOutput.spool.Len())
+
+	sender.setFail(false)
+	time.Sleep(time.Millisecond * 500)
+	assert.Equal(t, int64(0), pushhttpOutput.spool.Len())
+
+	pushhttpOutput.Close()
+}
+
+// recordSender records the payloads sent in order
+type recordSender struct {
+	mutex sync.Mutex
+	sent  []string
+	fail  bool
+}
+
+func (r *recordSender) Close() {}
+
+func (r *recordSender) Send(ctx context.Context, data []byte) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.sent = append(r.sent, string(data))
+	if r.fail {
+		return errors.New("fail")
+	}
+	if strings.Contains(string(data), "poison") {
+		return &responseCodeError{address: "test", statusCode: http.StatusBadRequest}
+	}
+	return nil
+}
+
+func (r *recordSender) setFail(fail bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.fail = fail
+}
+
+func (r *recordSender) sentMetrics() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var ret []string
+	for _, data := range r.sent {
+		ret = append(ret, metricNameRegex.FindString(data))
+	}
+	return ret
+}
+
+var metricNameRegex = regexp.MustCompile(`seq_\d+`)
+
+func newSeqEvent(seq int) *MetricPushEvent {
+	metric := message.NewMessage(fmt.Sprintf("seq_%d", seq), message.Gauge, time.Now()).AddField("value", 1.0)
+	return &MetricPushEvent{Name: "batch", Metrics: []*message.Message{metric}, WriteTime: time.Now()}
+}
+
+func TestPushWithSpoolInOrder(t *testing.T) {
+	pushhttpOutput := HttpOutput{}
+	config := fmt.Sprintf(`
+    protocol: prometheus
+    pushTaskCount: 0
+    spool:
+      enabled: true
+      dir: %s
+      replayInterval: 1h`, t.TempDir())
+	configMap, _ := utils.DecodeYaml(config)
+	err := pushhttpOutput.Init(context.Background(), configMap)
+	assert.Nil(t, err)
+	defer pushhttpOutput.Close()
+	sender := &recordSender{fail: true}
+	pushhttpOutput.Sender = sender
+	ctx := context.Background()
+
+	// outage, payloads after the failed one wait in spool
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, pushhttpOutput.push(ctx, newSeqEvent(i)))
+	}
+	assert.Equal(t, int64(3), pushhttpOutput.spool.Len())
+
+	// recovered, new payloads still wait for the spooled ones
+	sender.setFail(false)
+	for i := 3; i < 5; i++ {
+		assert.Nil(t, pushhttpOutput.push(ctx, newSeqEvent(i)))
+	}
+	assert.Equal(t, int64(5), pushhttpOutput.spool.Len())
+	assert.Equal(t, []string{"seq_0"}, sender.sentMetrics())
+
+	pushhttpOutput.replaySpool()
+	assert.Equal(t, int64(0), pushhttpOutput.spool.Len())
+	assert.Nil(t, pushhttpOutput.push(ctx, newSeqEvent(5)))
+	assert.Equal(t, []string{"seq_0", "seq_0", "seq_1", "seq_2", "seq_3", "seq_4", "seq_5"}, sender.sentMetrics())
+}
+
+func TestSpoolDiscardRejected(t *testing.T) {
+	pushhttpOutput := HttpOutput{}
+	config := fmt.Sprintf(`
+    protocol: prometheus
+    pushTaskCount: 0
+    http:
+      apiUrl: /rejected
+    spool:
+      enabled: true
+      dir: %s
+      replayInterval: 1h`, t.TempDir())
+	configMap, _ := utils.DecodeYaml(config)
+	err := pushhttpOutput.Init(context.Background(), configMap)
+	assert.Nil(t, err)
+	defer pushhttpOutput.Close()
+	sender := &recordSender{}
+	pushhttpOutput.Sender = sender
+	discarded := func() float64 {
+		return testutil.ToFloat64(stat.HttpOutputTaskDiscardCount.With(prometheus.Labels{stat.HttpApiPath: "/rejected"}))
+	}
+
+	poison := &MetricPushEvent{Name: "batch", Metrics: []*message.Message{
+		message.NewMessage("poison", message.Gauge, time.Now()).AddField("value", 1.0),
+	}}
+	assert.NotNil(t, pushhttpOutput.push(context.Background(), poison))
+	assert.Equal(t, int64(0), pushhttpOutput.spool.Len())
+	assert.Equal(t, float64(1), discarded())
+
+	// rejected when replayed, e.g. spooled before the target changed
+	data, err := pushhttpOutput.encode(poison)
+	assert.Nil(t, err)
+	assert.Nil(t, pushhttpOutput.spool.Append(data))
+	data, err = pushhttpOutput.encode(newSeqEvent(0))
+	assert.Nil(t, err)
+	assert.Nil(t, pushhttpOutput.spool.Append(data))
+	pushhttpOutput.replaySpool()
+	assert.Equal(t, int64(0), pushhttpOutput.spool.Len())
+	assert.Equal(t, float64(2), discarded())
+	assert.Equal(t, "seq_0", sender.sentMetrics()[2])
+}
+
+func TestStopSpoolQueuedTasks(t *testing.T) {
+	pushhttpOutput := HttpOutput{}
+	dir := t.TempDir()
+	config := fmt.Sprintf(`
+    protocol: prometheus
+    batchSize: 1
+    taskQueueSize: 64
+    pushTaskCount: 0
+    retryTaskCount: 4
+    retryTimes: 1
+    spool:
+      enabled: true
+      dir: %s
+      replayInterval: 1h`, dir)
+	configMap, _ := utils.DecodeYaml(config)
+	err := pushhttpOutput.Init(context.Background(), configMap)
+	assert.Nil(t, err)
+	pushhttpOutput.Sender = &printer{fail: true}
+
+	metrics := newTestMetrics()
+	pushhttpOutput.Write(context.Background(), metrics)
+	assert.Equal(t, len(metrics), len(pushhttpOutput.metricEventQueue))
+	pushhttpOutput.Stop()
+
+	spool := newTestSpool(t, dir, 1024*1024, 1024)
+	defer spool.Close()
+	assert.Equal(t, int64(len(metrics)), spool.records)
+}
@@ -52,6 +52,8 @@ type HttpSenderConfig struct {
 	AcceptedResponseCodes []int         `yaml:"acceptedResponseCodes"`
 	retryTaskCount        int           `yaml:"-"`
 	retryTimes            int           `yaml:"-"`
+	// drop the data when target responds 4xx (except 429), as remote write protocol required
+	dropOnClientError bool `yaml:"-"`
 	// use default value if not set
 	MaxIdleConns          int           `yaml:"maxIdleConns"`
 	MaxConnsPerHost       int           `yaml:"maxConnsPerHost"`
@@ -91,6 +93,17 @@ type retryTask struct {
 	data       []byte
 }
 
+// responseCodeError the target responds with a code not in AcceptedResponseCodes
+type responseCodeError struct {
+	address    string
+	statusCode int
+	body       []byte
+}
+
+func (e *responseCodeError) Error() string {
+	return fmt.Sprintf("%s error code: %d, body: %s", e.address, e.statusCode, e.body)
+}
+
 func (t retryTask) canBeDiscard(duration time.Duration) bool {
 	return t.retryTimes > 0 && t.createTime.Add(duration).Before(time.Now())
 }
@@ -155,6 +168,11 @@ func (s *HttpSender) Send(ctx context.Context, data []byte) error {
 	}).Inc()
 
 	err := s.send(ctx, bytes.NewReader(data))
+	if err != nil && !s.isRecoverable(err) {
+		log.WithContext(ctx).Warnf("push metrics failed and data is dropped, err:%+v", err)
+		stat.HttpOutputTaskDiscardCount.With(prometheus.Labels{stat.HttpApiPath: s.APIUrl}).Inc()
+		return nil
+	}
 	if err != nil {
 		log.WithContext(ctx).Errorf("push metrics failed, err:%+v", err)
 		if s.retryTimes > 0 {
@@ -166,10 +184,11 @@ func (s *HttpSender) Send(ctx context.Context, data []byte) error {
 				createTime: time.Now(),
 			}:
 			}
-
+			// the task is taken over by the retry tasks
+			return nil
 		}
 	}
-	return nil
+	return err
 }
 
 func (s *HttpSender) send(ctx context.Context, reader io.Reader) error {
@@ -209,11 +228,26 @@ func (s *HttpSender) send(ctx context.Context, reader io.Reader) error {
 	if !s.acceptedResponseCodes[resp.StatusCode] {
 		var b bytes.Buffer
 		io.Copy(&b, resp.Body)
-		return errors.Errorf("%s error code: %d, body: %s", s.address(), resp.StatusCode, b.Bytes())
+		return &responseCodeError{address: s.address(), statusCode: resp.StatusCode, body: b.Bytes()}
 	}
 	return nil
 }
 
+// isRecoverable whether a failed request is worth retrying.
+// When dropOnClientError is set, only 5xx, 429 and network errors are retried.
+func (s *HttpSender) isRecoverable(err error) bool {
+	return !s.dropOnClientError || !isClientError(err)
+}
+
+// isClientError the target rejects the request with a code other than 5xx and 429, sending it again does not help
+func isClientError(err error) bool {
+	codeErr, ok := err.(*responseCodeError)
+	if !ok {
+		return false
+	}
+	return codeErr.statusCode < 500 && codeErr.statusCode != http.StatusTooManyRequests
+}
+
 func (s *HttpSender) address() string {
 	addr := s.TargetAddress
 	if !strings.HasPrefix(s.TargetAddress, "http") {
@@ -272,7 +306,7 @@ func (s *HttpSender) startRetryTask() {
 			if err != nil {
 				log.WithContext(ctx).Warnf("retry to push metrics failed, retry times: %d, err: %s", task.retryTimes, err)
 			}
-			if err != nil && task.retryTimes < s.retryTimes && len(s.retryTasks) < s.retryTaskCount {
+			if err != nil && s.isRecoverable(err) && task.retryTimes < s.retryTimes && len(s.retryTasks) < s.retryTaskCount {
 				select {
 				case <-s.stopped:
 				case s.retryTasks <- task:
@@ -57,6 +57,13 @@ http:
   maxIdleConns: 64
   maxConnsPerHost: 64
   maxIdleConnsPerHost: 64
+spool:
+  enabled: false
+  dir: 
+  maxBytes: 268435456
+  maxAge: 6h
+  segmentBytes: 8388608
+  replayInterval: 5s
 `
 
 const description = `
@@ -73,6 +80,7 @@ type PushHttpOutputConfig struct {
 	PushTaskCount      int                       `yaml:"pushTaskCount"`
 	RetryTaskCount     int                       `yaml:"retryTaskCount"`
 	RetryTimes         int                       `yaml:"retryTimes"`
+	Spool              SpoolConfig               `yaml:"spool"`
 	Sender
 }
 
@@ -90,6 +98,7 @@ type HttpOutput struct {
 	eventWaitGroup          sync.WaitGroup
 	needStop                bool
 	stopped                 chan bool
+	spool                   *diskSpool
 	Sender
 }
 
@@ -115,7 +124,16 @@ func (o *HttpOutput) Init(ctx context.Context, config map[string]interface{}) er
 
 	info := fmt.Sprintf("init PushHttpOutput with config: %+v", o.Config)
 	log.WithContext(ctx).Infof(mask.Mask(info))
-	if o.Config.Protocol != common.Prometheus && o.Config.Protocol != common.PromeProto {
+	switch o.Config.Protocol {
+	case common.Prometheus, common.PromeProto:
+	case common.RemoteWrite:
+		o.Config.HttpSenderConfig.ContentType = remoteWriteContentType
+		o.Config.HttpSenderConfig.Headers = append(o.Config.HttpSenderConfig.Headers, remoteWriteHeaders...)
+		if len(o.Config.HttpSenderConfig.AcceptedResponseCodes) == 0 {
+			o.Config.HttpSenderConfig.AcceptedResponseCodes = remoteWriteAcceptedResponseCodes
+		}
+		o.Config.HttpSenderConfig.dropOnClientError = true
+	default:
 		return errors.Errorf("protocol %s is not supported.", o.Config.Protocol)
 	}
 	o.needStop = true
@@ -128,12 +146,25 @@ func (o *HttpOutput) Init(ctx context.Context, config map[string]interface{}) er
 	}
 	o.Config.HttpSenderConfig.retryTaskCount = o.Config.RetryTaskCount
 	o.Config.HttpSenderConfig.retryTimes = o.Config.RetryTimes
+	if o.Config.Spool.Enabled {
+		o.Config.Spool.fillDefault(o.Config.HttpSenderConfig)
+		o.spool, err = openDiskSpool(o.Config.Spool, o.Config.HttpSenderConfig.APIUrl)
+		if err != nil {
+			return errors.Wrap(err, "PushHttpOutput open spool")
+		}
+		// failed payloads are kept in spool, in-memory retry would push them twice
+		o.Config.HttpSenderConfig.retryTimes = 0
+	}
 	o.Sender = NewHttpSender(o.Config.HttpSenderConfig)
 
 	for i := 0; i < o.Config.PushTaskCount; i++ {
 		o.eventWaitGroup.Add(1)
 		go o.doPush()
 	}
+	if o.spool != nil {
+		o.eventWaitGroup.Add(1)
+		go o.doReplay()
+	}
 
 	return nil
 }
@@ -150,7 +181,9 @@ func (o *HttpOutput) Close() error {
 	close(o.stopped)
 	o.Sender.Close()
 	o.eventWaitGroup.Wait()
+	o.spoolQueuedTasks()
 	close(o.metricEventQueue)
+	o.closeSpool()
 	return nil
 }
 
@@ -181,12 +214,64 @@ func (o *HttpOutput) Stop() {
 	}
 	o.eventWaitGroup.Wait()
 	if o.metricEventQueue != nil {
+		o.spoolQueuedTasks()
 		close(o.metricEventQueue)
 	}
+	o.closeSpool()
+}
+
+// spoolQueuedTasks keeps the tasks not pushed yet in spool, so they are replayed after restart
+func (o *HttpOutput) spoolQueuedTasks() {
+	if o.spool == nil {
+		return
+	}
+	ctx := trace.ContextWithRandomTraceId()
+	for {
+		select {
+		case task := <-o.metricEventQueue:
+			o.spoolOldTask(ctx, task)
+		default:
+			return
+		}
+	}
+}
+
+func (o *HttpOutput) closeSpool() {
+	if o.spool == nil {
+		return
+	}
+	err := o.spool.Close()
+	if err != nil {
+		log.WithError(err).Warn("close http output spool failed")
+	}
 }
 
-// prometheus protocol
 func (o *HttpOutput) push(ctx context.Context, pushEvent *MetricPushEvent) error {
+	data, err := o.encode(pushEvent)
+	if err != nil {
+		return err
+	}
+	if o.spool != nil && o.spool.Len() > 0 {
+		// the target must receive payloads in order, new ones are sent by replay after the spooled ones
+		return o.spool.Append(data)
+	}
+	err = o.Sender.Send(ctx, data)
+	if err == nil || o.spool == nil {
+		return err
+	}
+	if isClientError(err) {
+		// a rejected payload would block the spool head forever
+		stat.HttpOutputTaskDiscardCount.With(prometheus.Labels{stat.HttpApiPath: o.Config.HttpSenderConfig.APIUrl}).Inc()
+		return err
+	}
+	log.WithContext(ctx).Infof("push metrics %s failed, write to spool", pushEvent.Name)
+	return o.spool.Append(data)
+}
+
+func (o *HttpOutput) encode(pushEvent *MetricPushEvent) ([]byte, error) {
+	if o.Config.Protocol == common.RemoteWrite {
+		return encodeRemoteWrite(pushEvent.Metrics), nil
+	}
 	collector := message.NewCollector(o.prometheusCollectConfig)
 	collector.Fam = message.CreateMetricFamily(pushEvent.Metrics)
 	registry := prometheus.NewRegistry()
@@ -194,14 +279,14 @@ func (o *HttpOutput) push(ctx context.Context, pushEvent *MetricPushEvent) error
 
 	mfs, err := registry.Gather()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	buf := &bytes.Buffer{}
 	enc := expfmt.NewEncoder(buf, o.getEncoderProto())
 	for _, mf := range mfs {
 		enc.Encode(mf)
 	}
-	return o.Sender.Send(ctx, buf.Bytes())
+	return buf.Bytes(), nil
 }
 
 func (o *HttpOutput) getEncoderProto() expfmt.Format {
@@ -240,6 +325,55 @@ func (o *HttpOutput) doPush() {
 	}
 }
 
+// doReplay sends the spooled payloads in order, and stops at the first failure until next round.
+// Payloads rejected by the target are discarded, otherwise they block the ones behind.
+func (o *HttpOutput) doReplay() {
+	defer o.eventWaitGroup.Done()
+	ticker := time.NewTicker(o.Config.Spool.ReplayInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-o.stopped:
+			log.Info("stop http spool replay")
+			return
+		case <-ticker.C:
+			o.replaySpool()
+		}
+	}
+}
+
+func (o *HttpOutput) replaySpool() {
+	for {
+		select {
+		case <-o.stopped:
+			return
+		default:
+		}
+		data, pos, err := o.spool.Peek()
+		if err != nil {
+			log.WithError(err).Error("read http output spool failed")
+			return
+		}
+		if data == nil {
+			return
+		}
+		ctx := trace.ContextWithRandomTraceId()
+		err = o.Sender.Send(ctx, data)
+		if err != nil && !isClientError(err) {
+			log.WithContext(ctx).Debugf("replay spooled metrics failed, err: %s", err)
+			return
+		}
+		if err != nil {
+			log.WithContext(ctx).Warnf("spooled metrics rejected and discarded, err: %s", err)
+			stat.HttpOutputTaskDiscardCount.With(prometheus.Labels{stat.HttpApiPath: o.Config.HttpSenderConfig.APIUrl}).Inc()
+		}
+		err = o.spool.Commit(pos, data)
+		if err != nil {
+			log.WithContext(ctx).WithError(err).Warn("commit http output spool failed")
+		}
+	}
+}
+
 func (o *HttpOutput) Write(ctx context.Context, metrics []*message.Message) error {
 	select {
 	case _, isOpen := <-o.stopped:
@@ -292,9 +426,24 @@ func (o *HttpOutput) replaceOldTask(ctx context.Context, metrics []*message.Mess
 	select {
 	case <-o.stopped:
 		return
-	case <-o.metricEventQueue:
-		stat.HttpOutputTaskDiscardCount.With(prometheus.Labels{stat.HttpApiPath: o.Config.HttpSenderConfig.APIUrl}).Inc()
+	case oldTask := <-o.metricEventQueue:
+		o.spoolOldTask(ctx, oldTask)
 		o.metricEventQueue <- task
 	case o.metricEventQueue <- task:
 	}
 }
+
+// spoolOldTask writes the task replaced from a full queue into spool, or discards it if spool is disabled.
+func (o *HttpOutput) spoolOldTask(ctx context.Context, task *MetricPushEvent) {
+	if o.spool != nil {
+		data, err := o.encode(task)
+		if err == nil {
+			err = o.spool.Append(data)
+		}
+		if err == nil {
+			return
+		}
+		log.WithContext(ctx).WithError(err).Warn("write replaced task to spool failed")
+	}
+	stat.HttpOutputTaskDiscardCount.With(prometheus.Labels{stat.HttpApiPath: o.Config.HttpSenderConfig.APIUrl}).Inc()
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package pushhttp
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/oceanbase/obagent/monitor/message"
+)
+
+const (
+	remoteWriteContentType = "application/x-protobuf"
+	remoteWriteVersion     = "0.1.0"
+)
+
+// remoteWriteHeaders headers required by prometheus remote write protocol
+var remoteWriteHeaders = []string{
+	"Content-Encoding:snappy",
+	"X-Prometheus-Remote-Write-Version:" + remoteWriteVersion,
+}
+
+var remoteWriteAcceptedResponseCodes = []int{200, 202, 204}
+
+type remoteWriteLabel struct {
+	name  string
+	value string
+}
+
+type remoteWriteSeries struct {
+	labels    []remoteWriteLabel
+	value     float64
+	timestamp int64
+}
+
+// encodeRemoteWrite converts messages to a snappy compressed prometheus.WriteRequest.
+// Summary and histogram are expanded the same way as prometheus text format does.
+func encodeRemoteWrite(metrics []*message.Message) []byte {
+	var buf []byte
+	for name, family := range message.CreateMetricFamily(metrics) {
+		for _, sample := range family.Samples {
+			for _, series := range sampleToSeries(name, family.Type, sample) {
+				buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+				buf = protowire.AppendBytes(buf, appendTimeSeries(nil, series))
+			}
+		}
+	}
+	return snappy.Encode(nil, buf)
+}
+
+func sampleToSeries(name string, metricType message.Type, sample *message.Sample) []remoteWriteSeries {
+	timestamp := sample.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	ts := timestamp.UnixNano() / int64(time.Millisecond)
+	newSeries := func(seriesName string, value float64, extraName, extraValue string) remoteWriteSeries {
+		labels := make([]remoteWriteLabel, 0, len(sample.Labels)+2)
+		labels = append(labels, remoteWriteLabel{name: "__name__", value: seriesName})
+		for k, v := range sample.Labels {
+			if v == "" {
+				continue
+			}
+			labels = append(labels, remoteWriteLabel{name: k, value: v})
+		}
+		if extraName != "" {
+			labels = append(labels, remoteWriteLabel{name: extraName, value: extraValue})
+		}
+		sort.Slice(labels, func(i, j int) bool {
+			return labels[i].name < labels[j].name
+		})
+		return remoteWriteSeries{labels: labels, value: value, timestamp: ts}
+	}
+
+	switch metricType {
+	case message.Summary:
+		ret := make([]remoteWriteSeries, 0, len(sample.SummaryValue)+2)
+		for quantile, value := range sample.SummaryValue {
+			ret = append(ret, newSeries(name, value, "quantile", formatFloat(quantile)))
+		}
+		ret = append(ret, newSeries(name+"_sum", sample.Sum, "", ""))
+		ret = append(ret, newSeries(name+"_count", float64(sample.Count), "", ""))
+		return ret
+	case message.Histogram:
+		ret := make([]remoteWriteSeries, 0, len(sample.HistogramValue)+3)
+		hasInf := false
+		for bound, count := range sample.HistogramValue {
+			if math.IsInf(bound, 1) {
+				hasInf = true
+			}
+			ret = append(ret, newSeries(name+"_bucket", float64(count), "le", formatFloat(bound)))
+		}
+		if !hasInf {
+			ret = append(ret, newSeries(name+"_bucket", float64(sample.Count), "le", "+Inf"))
+		}
+		ret = append(ret, newSeries(name+"_sum", sample.Sum, "", ""))
+		ret = append(ret, newSeries(name+"_count", float64(sample.Count), "", ""))
+		return ret
+	default:
+		return []remoteWriteSeries{newSeries(name, sample.Value, "", "")}
+	}
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// appendTimeSeries encodes prometheus.TimeSeries:
+//   message TimeSeries { repeated Label labels = 1; repeated Sample samples = 2; }
+//   message Label { string name = 1; string value = 2; }
+//   message Sample { double value = 1; int64 timestamp = 2; }
+func appendTimeSeries(buf []byte, series remoteWriteSeries) []byte {
+	for _, label := range series.labels {
+		var labelBuf []byte
+		labelBuf = protowire.AppendTag(labelBuf, 1, protowire.BytesType)
+		labelBuf = protowire.AppendString(labelBuf, label.name)
+		labelBuf = protowire.AppendTag(labelBuf, 2, protowire.BytesType)
+		labelBuf = protowire.AppendString(labelBuf, label.value)
+		buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, labelBuf)
+	}
+	var sampleBuf []byte
+	sampleBuf = protowire.AppendTag(sampleBuf, 1, protowire.Fixed64Type)
+	sampleBuf = protowire.AppendFixed64(sampleBuf, math.Float64bits(series.value))
+	sampleBuf = protowire.AppendTag(sampleBuf, 2, protowire.VarintType)
+	sampleBuf = protowire.AppendVarint(sampleBuf, uint64(series.timestamp))
+	buf = protowire.AppendTag(buf, 2, protowire.BytesType)
+	buf = protowire.AppendBytes(buf, sampleBuf)
+	return buf
+}
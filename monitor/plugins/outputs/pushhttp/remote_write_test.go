@@ -0,0 +1,133 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package pushhttp
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/oceanbase/obagent/monitor/message"
+)
+
+// decodeWriteRequest decodes a WriteRequest into series name -> labels, value
+func decodeWriteRequest(t *testing.T, data []byte) map[string][]map[string]string {
+	raw, err := snappy.Decode(nil, data)
+	assert.Nil(t, err)
+	ret := make(map[string][]map[string]string)
+	for len(raw) > 0 {
+		num, _, n := protowire.ConsumeTag(raw)
+		assert.Equal(t, protowire.Number(1), num)
+		raw = raw[n:]
+		series, n := protowire.ConsumeBytes(raw)
+		raw = raw[n:]
+
+		labels := make(map[string]string)
+		for len(series) > 0 {
+			num, _, n := protowire.ConsumeTag(series)
+			series = series[n:]
+			body, n := protowire.ConsumeBytes(series)
+			series = series[n:]
+			if num == 1 {
+				_, _, n := protowire.ConsumeTag(body)
+				name, m := protowire.ConsumeString(body[n:])
+				body = body[n+m:]
+				_, _, n = protowire.ConsumeTag(body)
+				value, _ := protowire.ConsumeString(body[n:])
+				labels[name] = value
+			} else {
+				_, _, n := protowire.ConsumeTag(body)
+				bits, _ := protowire.ConsumeFixed64(body[n:])
+				labels["__value__"] = formatFloat(math.Float64frombits(bits))
+			}
+		}
+		ret[labels["__name__"]] = append(ret[labels["__name__"]], labels)
+	}
+	return ret
+}
+
+func TestEncodeRemoteWrite(t *testing.T) {
+	now := time.Now()
+	metrics := []*message.Message{
+		message.NewMessage("ob_sysstat", message.Gauge, now).
+			AddTag("svr_ip", "127.0.0.1").
+			AddField("value", 10.0).
+			AddField("delta", int64(2)),
+		message.NewMessage("latency", message.Histogram, now).
+			AddTag("svr_ip", "127.0.0.1").
+			AddField("0.1", uint64(3)).
+			AddField("1", uint64(5)).
+			AddField("sum", 2.5).
+			AddField("count", uint64(6)),
+	}
+	series := decodeWriteRequest(t, encodeRemoteWrite(metrics))
+
+	assert.Equal(t, "10", series["ob_sysstat"][0]["__value__"])
+	assert.Equal(t, "127.0.0.1", series["ob_sysstat"][0]["svr_ip"])
+	assert.Equal(t, "2", series["ob_sysstat_delta"][0]["__value__"])
+	assert.Equal(t, 3, len(series["latency_bucket"]))
+	assert.Equal(t, "2.5", series["latency_sum"][0]["__value__"])
+	assert.Equal(t, "6", series["latency_count"][0]["__value__"])
+	for _, bucket := range series["latency_bucket"] {
+		if bucket["le"] == "+Inf" {
+			assert.Equal(t, "6", bucket["__value__"])
+		}
+	}
+}
+
+func TestRemoteWriteRetrySemantics(t *testing.T) {
+	var code int32 = http.StatusBadRequest
+	var received int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&received, 1)
+		assert.Equal(t, "snappy", r.Header.Get("Content-Encoding"))
+		assert.Equal(t, remoteWriteContentType, r.Header.Get("Content-Type"))
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(int(atomic.LoadInt32(&code)))
+	}))
+	defer server.Close()
+
+	sender := NewHttpSender(HttpSenderConfig{
+		TargetAddress:         server.URL,
+		APIUrl:                "/api/v1/write",
+		HttpMethod:            http.MethodPost,
+		Timeout:               time.Second,
+		ContentType:           remoteWriteContentType,
+		Headers:               remoteWriteHeaders,
+		AcceptedResponseCodes: remoteWriteAcceptedResponseCodes,
+		dropOnClientError:     true,
+	})
+	defer sender.Close()
+
+	data := encodeRemoteWrite(newTestMetrics())
+	assert.Nil(t, sender.Send(context.Background(), data))
+
+	atomic.StoreInt32(&code, http.StatusTooManyRequests)
+	assert.NotNil(t, sender.Send(context.Background(), data))
+
+	atomic.StoreInt32(&code, http.StatusServiceUnavailable)
+	assert.NotNil(t, sender.Send(context.Background(), data))
+
+	atomic.StoreInt32(&code, http.StatusNoContent)
+	assert.Nil(t, sender.Send(context.Background(), data))
+	assert.Equal(t, int32(4), atomic.LoadInt32(&received))
+}
@@ -14,8 +14,11 @@ package aggregate
 
 import (
 	"context"
+	"math"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v3"
@@ -31,15 +34,39 @@ rules:
     tags: [ t1, t2 ]
   - metric: m2
     tags: [ t1, t2 ]
+    func: percentile
+    percentile: 0.99
+    fields: [ f1 ]
+    window: 1m
 `
 
 const description = `
 aggregate metrics
 `
 
+type AggregateFunc string
+
+const (
+	Sum        AggregateFunc = "sum"
+	Avg        AggregateFunc = "avg"
+	Min        AggregateFunc = "min"
+	Max        AggregateFunc = "max"
+	Count      AggregateFunc = "count"
+	Percentile AggregateFunc = "percentile"
+)
+
 type Rule struct {
 	MetricName string   `yaml:"metric"`
 	Tags       []string `yaml:"tags"`
+	// Func aggregate function: sum, avg, min, max, count or percentile, default sum
+	Func AggregateFunc `yaml:"func"`
+	// Percentile in (0, 1], used by percentile function
+	Percentile float64 `yaml:"percentile"`
+	// Fields fields to aggregate, other fields are dropped. empty means all fields
+	Fields []string `yaml:"fields"`
+	// Window aggregate samples of several collection cycles in the time window,
+	// result is emitted when window ends. zero means aggregate in each batch
+	Window time.Duration `yaml:"window"`
 }
 
 type AggregatorConfig struct {
@@ -50,6 +77,11 @@ type AggregatorConfig struct {
 type Aggregator struct {
 	Config *AggregatorConfig
 	rules  map[string]*rule
+
+	// windows groupKey -> aggregation across batches, for rules with window
+	windows map[string]*aggregation
+	lock    sync.Mutex
+	now     func() time.Time
 }
 
 func (a *Aggregator) SampleConfig() string {
@@ -75,43 +107,100 @@ func (a *Aggregator) Init(ctx context.Context, config map[string]interface{}) er
 
 	a.Config = &aggregatorConfig
 	a.rules = make(map[string]*rule)
+	a.windows = make(map[string]*aggregation)
+	a.now = time.Now
 	for _, ruleConfig := range a.Config.Rules {
-		a.rules[ruleConfig.MetricName] = ruleFromConfig(ruleConfig)
+		aRule, err := ruleFromConfig(ruleConfig)
+		if err != nil {
+			return errors.Wrapf(err, "aggregateProcessor rule of metric %s", ruleConfig.MetricName)
+		}
+		a.rules[ruleConfig.MetricName] = aRule
 	}
 	log.WithContext(ctx).Infof("init aggregateProcessor with config: %+v", a.Config)
 	return nil
 }
 
 func (a *Aggregator) Start(in <-chan []*message.Message, out chan<- []*message.Message) error {
-	for msgs := range in {
-		newMsgs, err := a.Process(context.Background(), msgs...)
-		if err != nil {
-			log.Errorf("aggregator process messages failed, err %s", err)
+	var tick <-chan time.Time
+	if interval := a.minWindow(); interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case msgs, ok := <-in:
+			if !ok {
+				return nil
+			}
+			newMsgs, err := a.Process(context.Background(), msgs...)
+			if err != nil {
+				log.Errorf("aggregator process messages failed, err %s", err)
+			}
+			out <- newMsgs
+		case <-tick:
+			a.lock.Lock()
+			newMsgs := a.flushWindows(a.now())
+			a.lock.Unlock()
+			if len(newMsgs) > 0 {
+				out <- newMsgs
+			}
 		}
-		out <- newMsgs
 	}
-	return nil
 }
 
 func (a *Aggregator) Stop() {}
 
+func (a *Aggregator) minWindow() time.Duration {
+	var ret time.Duration
+	for _, r := range a.rules {
+		if r.window > 0 && (ret == 0 || r.window < ret) {
+			ret = r.window
+		}
+	}
+	return ret
+}
+
 type rule struct {
-	key  string // message + group tags
-	tags map[string]int
-	f    func(a, b interface{}) interface{}
+	key        string // message + group tags
+	tags       map[string]int
+	fields     map[string]bool
+	f          AggregateFunc
+	percentile float64
+	window     time.Duration
 }
 
-func ruleFromConfig(config *Rule) *rule {
+func ruleFromConfig(config *Rule) (*rule, error) {
 	sort.Strings(config.Tags)
 	m := make(map[string]int)
 	for i, k := range config.Tags {
 		m[k] = i
 	}
-	return &rule{
-		key:  config.MetricName + "\x00" + strings.Join(config.Tags, "\x00"),
-		tags: m,
-		f:    sum,
+	r := &rule{
+		key:        config.MetricName + "\x00" + strings.Join(config.Tags, "\x00"),
+		tags:       m,
+		f:          config.Func,
+		percentile: config.Percentile,
+		window:     config.Window,
+	}
+	switch r.f {
+	case "":
+		r.f = Sum
+	case Sum, Avg, Min, Max, Count:
+	case Percentile:
+		if r.percentile <= 0 || r.percentile > 1 {
+			return nil, errors.Errorf("invalid percentile %v", r.percentile)
+		}
+	default:
+		return nil, errors.Errorf("unknown aggregate func %s", r.f)
 	}
+	if len(config.Fields) > 0 {
+		r.fields = make(map[string]bool, len(config.Fields))
+		for _, field := range config.Fields {
+			r.fields[field] = true
+		}
+	}
+	return r, nil
 }
 
 func (r *rule) groupKey(m *message.Message) (string, bool) {
@@ -131,7 +220,7 @@ func (r *rule) groupKey(m *message.Message) (string, bool) {
 	return strings.Join(vs, "\x00"), true
 }
 
-func (r *rule) first(m *message.Message) *message.Message {
+func (r *rule) first(m *message.Message) *aggregation {
 	tags := make([]message.TagEntry, 0, len(r.tags))
 	for _, e := range m.Tags() {
 		_, ex := r.tags[e.Name]
@@ -140,21 +229,118 @@ func (r *rule) first(m *message.Message) *message.Message {
 		}
 		tags = append(tags, e)
 	}
-	fields := make([]message.FieldEntry, len(m.Fields()))
-	copy(fields, m.Fields())
-	return message.NewMessageWithTagsFields(m.GetName(), m.GetMetricType(), m.GetTime(), tags, fields)
+	return &aggregation{
+		rule:    r,
+		name:    m.GetName(),
+		msgType: m.GetMetricType(),
+		time:    m.GetTime(),
+		tags:    tags,
+		fields:  make(map[string]*accumulator),
+	}
+}
+
+// aggregation aggregates fields of messages in the same group
+type aggregation struct {
+	rule      *rule
+	name      string
+	msgType   message.Type
+	time      time.Time
+	tags      []message.TagEntry
+	order     []string
+	fields    map[string]*accumulator
+	windowEnd time.Time
 }
 
-func sum(a, b interface{}) interface{} {
-	fa, _ := utils.ConvertToFloat64(a)
-	fb, _ := utils.ConvertToFloat64(b)
-	return fa + fb
+type accumulator struct {
+	first   interface{}
+	numeric bool
+	sum     float64
+	min     float64
+	max     float64
+	count   int
+	values  []float64
+}
+
+func (g *aggregation) add(m *message.Message) {
+	for _, field := range m.Fields() {
+		if g.rule.fields != nil && !g.rule.fields[field.Name] {
+			continue
+		}
+		acc, ok := g.fields[field.Name]
+		if !ok {
+			acc = &accumulator{first: field.Value, numeric: true, min: math.Inf(1), max: math.Inf(-1)}
+			g.fields[field.Name] = acc
+			g.order = append(g.order, field.Name)
+		}
+		v, ok := utils.ConvertToFloat64(field.Value)
+		if !ok {
+			acc.numeric = false
+			continue
+		}
+		acc.sum += v
+		acc.count++
+		acc.min = math.Min(acc.min, v)
+		acc.max = math.Max(acc.max, v)
+		if g.rule.f == Percentile {
+			acc.values = append(acc.values, v)
+		}
+	}
+}
+
+func (g *aggregation) result() *message.Message {
+	fields := make([]message.FieldEntry, 0, len(g.order))
+	for _, name := range g.order {
+		acc := g.fields[name]
+		if !acc.numeric || acc.count == 0 {
+			// keep the first value of fields can not be aggregated
+			fields = append(fields, message.FieldEntry{Name: name, Value: acc.first})
+			continue
+		}
+		fields = append(fields, message.FieldEntry{Name: name, Value: acc.value(g.rule.f, g.rule.percentile)})
+	}
+	t := g.time
+	if !g.windowEnd.IsZero() {
+		t = g.windowEnd
+	}
+	return message.NewMessageWithTagsFields(g.name, g.msgType, t, g.tags, fields)
+}
+
+func (acc *accumulator) value(f AggregateFunc, percentile float64) float64 {
+	switch f {
+	case Avg:
+		return acc.sum / float64(acc.count)
+	case Min:
+		return acc.min
+	case Max:
+		return acc.max
+	case Count:
+		return float64(acc.count)
+	case Percentile:
+		return percentileOf(acc.values, percentile)
+	default:
+		return acc.sum
+	}
+}
+
+// percentileOf computes percentile by linear interpolation between closest ranks
+func percentileOf(values []float64, p float64) float64 {
+	sort.Float64s(values)
+	pos := p * float64(len(values)-1)
+	lower := int(math.Floor(pos))
+	upper := int(math.Ceil(pos))
+	if lower == upper {
+		return values[lower]
+	}
+	return values[lower] + (values[upper]-values[lower])*(pos-float64(lower))
 }
 
 func (a *Aggregator) Process(ctx context.Context, metrics ...*message.Message) ([]*message.Message, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
 	uniqueMetrics := message.UniqueMetrics(metrics) // todo: 去掉这里的 UniqueMetrics，把去重挪到对应 input
 	ret := make([]*message.Message, 0, len(uniqueMetrics))
-	aggrMap := make(map[string]*message.Message) // groupKey -> message
+	aggrMap := make(map[string]*aggregation) // groupKey -> aggregation
+	aggrKeys := make([]string, 0)
 	for _, metricEntry := range uniqueMetrics {
 		metricName := metricEntry.GetName()
 		aRule, ok := a.rules[metricName]
@@ -171,20 +357,54 @@ func (a *Aggregator) Process(ctx context.Context, metrics ...*message.Message) (
 		if !ok {
 			continue
 		}
-		msg, ok := aggrMap[groupKey]
+		if aRule.window > 0 {
+			a.addToWindow(groupKey, aRule, metricEntry)
+			continue
+		}
+		aggr, ok := aggrMap[groupKey]
 		if !ok {
-			msg = aRule.first(metricEntry)
-			aggrMap[groupKey] = msg
-		} else {
-			for _, field := range metricEntry.Fields() {
-				prev, _ := msg.GetField(field.Name)
-				msg.SetField(field.Name, aRule.f(prev, field.Value))
-			}
+			aggr = aRule.first(metricEntry)
+			aggrMap[groupKey] = aggr
+			aggrKeys = append(aggrKeys, groupKey)
 		}
+		aggr.add(metricEntry)
 	}
-	for _, v := range aggrMap {
-		ret = append(ret, v)
+	for _, k := range aggrKeys {
+		ret = append(ret, aggrMap[k].result())
 	}
+	ret = append(ret, a.flushWindows(a.now())...)
 	log.WithContext(ctx).Debugf("after process, metrics length: %d", len(ret))
 	return ret, nil
 }
+
+// addToWindow adds the message to aggregation of the window it belongs to, windows are aligned to multiple of window size
+func (a *Aggregator) addToWindow(groupKey string, aRule *rule, m *message.Message) {
+	windowStart := m.GetTime().Truncate(aRule.window)
+	key := groupKey + "\x00" + windowStart.String()
+	aggr, ok := a.windows[key]
+	if !ok {
+		aggr = aRule.first(m)
+		aggr.windowEnd = windowStart.Add(aRule.window)
+		a.windows[key] = aggr
+	}
+	aggr.add(m)
+}
+
+// flushWindows emits the aggregations of ended windows, in the order of window end time
+func (a *Aggregator) flushWindows(now time.Time) []*message.Message {
+	ended := make([]string, 0)
+	for key, aggr := range a.windows {
+		if !aggr.windowEnd.After(now) {
+			ended = append(ended, key)
+		}
+	}
+	sort.Slice(ended, func(i, j int) bool {
+		return a.windows[ended[i]].windowEnd.Before(a.windows[ended[j]].windowEnd)
+	})
+	ret := make([]*message.Message, 0, len(ended))
+	for _, key := range ended {
+		ret = append(ret, a.windows[key].result())
+		delete(a.windows, key)
+	}
+	return ret
+}
@@ -111,3 +111,101 @@ func TestNotMatch(t *testing.T) {
 	require.True(t, ok)
 	require.Equal(t, 1.0, f)
 }
+
+func newAggregator(t *testing.T, configStr string) *Aggregator {
+	var aggregatorConfigMap map[string]interface{}
+	require.Nil(t, yaml.Unmarshal([]byte(configStr), &aggregatorConfigMap))
+	aggregator := &Aggregator{}
+	require.Nil(t, aggregator.Init(context.Background(), aggregatorConfigMap))
+	return aggregator
+}
+
+func newDiskMetric(now time.Time, device string, value float64) *message.Message {
+	return message.NewMessage("disk_io", message.Gauge, now).
+		AddTag("host", "h1").
+		AddTag("device", device).
+		AddField("read", value).
+		AddField("write", value*2)
+}
+
+func TestAggregateFuncs(t *testing.T) {
+	now := time.Now()
+	metrics := func() []*message.Message {
+		return []*message.Message{
+			newDiskMetric(now, "sda", 1),
+			newDiskMetric(now, "sdb", 2),
+			newDiskMetric(now, "sdc", 3),
+			newDiskMetric(now, "sdd", 4),
+		}
+	}
+	tests := []struct {
+		f      string
+		expect float64
+	}{
+		{"sum", 10},
+		{"avg", 2.5},
+		{"min", 1},
+		{"max", 4},
+		{"count", 4},
+		{"percentile", 3.7},
+	}
+	for _, tt := range tests {
+		aggregator := newAggregator(t, `
+        rules:
+          - metric: disk_io
+            tags: [ host ]
+            fields: [ read ]
+            percentile: 0.9
+            func: `+tt.f)
+		out, _ := aggregator.Process(context.Background(), metrics()...)
+		require.Equal(t, 1, len(out), tt.f)
+		v, _ := out[0].GetField("read")
+		require.InDelta(t, tt.expect, v, 1e-9, tt.f)
+		_, exists := out[0].GetField("write")
+		require.False(t, exists)
+		_, exists = out[0].GetTag("device")
+		require.False(t, exists)
+	}
+}
+
+func TestAggregateInvalidFunc(t *testing.T) {
+	var aggregatorConfigMap map[string]interface{}
+	_ = yaml.Unmarshal([]byte(`
+        rules:
+          - metric: disk_io
+            func: median
+    `), &aggregatorConfigMap)
+	aggregator := &Aggregator{}
+	require.NotNil(t, aggregator.Init(context.Background(), aggregatorConfigMap))
+}
+
+func TestAggregateWindow(t *testing.T) {
+	aggregator := newAggregator(t, `
+        rules:
+          - metric: disk_io
+            tags: [ host ]
+            func: avg
+            window: 1m
+    `)
+	windowStart := time.Now().Truncate(time.Minute)
+	now := windowStart
+	aggregator.now = func() time.Time {
+		return now
+	}
+	out, _ := aggregator.Process(context.Background(), newDiskMetric(now, "sda", 1), newDiskMetric(now, "sdb", 3))
+	require.Equal(t, 0, len(out))
+
+	now = windowStart.Add(30 * time.Second)
+	out, _ = aggregator.Process(context.Background(), newDiskMetric(now, "sda", 5), newDiskMetric(now, "sdb", 7))
+	require.Equal(t, 0, len(out))
+
+	now = windowStart.Add(time.Minute)
+	out, _ = aggregator.Process(context.Background(), newDiskMetric(now, "sda", 100))
+	require.Equal(t, 1, len(out))
+	require.Equal(t, windowStart.Add(time.Minute), out[0].GetTime())
+	read, _ := out[0].GetField("read")
+	require.Equal(t, 4.0, read)
+	write, _ := out[0].GetField("write")
+	require.Equal(t, 8.0, write)
+	require.Equal(t, 1, len(aggregator.windows))
+}
@@ -0,0 +1,341 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package alert
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+
+	"github.com/oceanbase/obagent/errors"
+	"github.com/oceanbase/obagent/monitor/message"
+	"github.com/oceanbase/obagent/monitor/utils"
+)
+
+const sampleConfig = `
+keepMetrics: false
+resolveTimeout: 5m
+ruleFiles:
+  - /home/admin/obagent/conf/prometheus_config/rules/ob_rules.yaml
+rules:
+  - alert: ob_sysstat_active_session_high
+    expr: ob_sysstat{stat_id="10000", svr_ip=~"10\\..*"} > 1000
+    field: value
+    for: 1m
+    labels:
+      severity: warning
+    annotations:
+      summary: "{{ $labels.svr_ip }} active session over threshold"
+      description: "{{ $labels.svr_ip }} active session is {{ $value }}"
+`
+
+const description = `
+evaluate threshold alert rules on metrics, emit firing and resolved alerts for alertmanager output
+`
+
+const (
+	defaultField          = "value"
+	defaultResolveTimeout = 5 * time.Minute
+	// EndsAtField field of resolved alert, the time when the alert is resolved
+	EndsAtField = "endsAt"
+)
+
+type alertState string
+
+const (
+	statePending  alertState = "pending"
+	stateFiring   alertState = "firing"
+	stateResolved alertState = "resolved"
+)
+
+type RuleConfig struct {
+	Alert       string            `yaml:"alert"`
+	Expr        string            `yaml:"expr"`
+	Field       string            `yaml:"field"`
+	For         time.Duration     `yaml:"for"`
+	Labels      map[string]string `yaml:"labels"`
+	Annotations map[string]string `yaml:"annotations"`
+}
+
+// RuleGroupsConfig rule file, in the same format as prometheus rule files
+type RuleGroupsConfig struct {
+	Groups []struct {
+		Name  string        `yaml:"name"`
+		Rules []*RuleConfig `yaml:"rules"`
+	} `yaml:"groups"`
+}
+
+type AlertRuleConfig struct {
+	Rules []*RuleConfig `yaml:"rules"`
+	// RuleFiles prometheus style rule files, rules with expressions not supported are skipped
+	RuleFiles []string `yaml:"ruleFiles"`
+	// ResolveTimeout an active alert is resolved when its series is not seen for this duration
+	ResolveTimeout time.Duration `yaml:"resolveTimeout"`
+	// KeepMetrics whether to output the input metrics together with the alerts
+	KeepMetrics bool `yaml:"keepMetrics"`
+}
+
+type activeAlert struct {
+	state    alertState
+	tags     []message.TagEntry
+	value    float64
+	activeAt time.Time
+	lastSeen time.Time
+}
+
+type rule struct {
+	config      *RuleConfig
+	expr        *ruleExpr
+	annotations map[string]*template.Template
+	active      map[string]*activeAlert
+}
+
+type templateData struct {
+	Labels map[string]string
+	Value  float64
+}
+
+// AlertRuleProcessor evaluates alert rules on each batch of metrics.
+// States of alerts are kept across batches: an alert is pending when the condition is first met,
+// becomes firing after the condition keeps true for the duration of 'for', and resolved when the
+// condition becomes false or its series disappears. Firing and resolved alerts are emitted as messages
+// named by the alert, with series tags and rule labels as tags, and annotations as fields.
+type AlertRuleProcessor struct {
+	Config *AlertRuleConfig
+
+	rules []*rule
+	lock  sync.Mutex
+	now   func() time.Time
+}
+
+func (a *AlertRuleProcessor) SampleConfig() string {
+	return sampleConfig
+}
+
+func (a *AlertRuleProcessor) Description() string {
+	return description
+}
+
+func (a *AlertRuleProcessor) Init(ctx context.Context, config map[string]interface{}) error {
+	var pluginConfig AlertRuleConfig
+	configBytes, err := yaml.Marshal(config)
+	if err != nil {
+		return errors.Wrap(err, "alertRuleProcessor encode config")
+	}
+	err = yaml.Unmarshal(configBytes, &pluginConfig)
+	if err != nil {
+		return errors.Wrap(err, "alertRuleProcessor decode config")
+	}
+	if pluginConfig.ResolveTimeout <= 0 {
+		pluginConfig.ResolveTimeout = defaultResolveTimeout
+	}
+	a.Config = &pluginConfig
+	a.now = time.Now
+
+	for _, ruleConfig := range pluginConfig.Rules {
+		r, err := newRule(ruleConfig)
+		if err != nil {
+			return errors.Wrapf(err, "alertRuleProcessor init rule %s", ruleConfig.Alert)
+		}
+		a.rules = append(a.rules, r)
+	}
+	for _, file := range pluginConfig.RuleFiles {
+		rules, err := loadRuleFile(ctx, file)
+		if err != nil {
+			return err
+		}
+		a.rules = append(a.rules, rules...)
+	}
+	log.WithContext(ctx).Infof("init alertRuleProcessor with %d rules, config: %+v", len(a.rules), a.Config)
+	return nil
+}
+
+func loadRuleFile(ctx context.Context, file string) ([]*rule, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "alertRuleProcessor read rule file %s", file)
+	}
+	var groups RuleGroupsConfig
+	err = yaml.Unmarshal(content, &groups)
+	if err != nil {
+		return nil, errors.Wrapf(err, "alertRuleProcessor decode rule file %s", file)
+	}
+	var rules []*rule
+	for _, group := range groups.Groups {
+		for _, ruleConfig := range group.Rules {
+			r, err := newRule(ruleConfig)
+			if err != nil {
+				log.WithContext(ctx).WithError(err).Warnf("skip rule %s of file %s", ruleConfig.Alert, file)
+				continue
+			}
+			rules = append(rules, r)
+		}
+	}
+	return rules, nil
+}
+
+func newRule(config *RuleConfig) (*rule, error) {
+	if config.Alert == "" {
+		return nil, errors.New("alert name is empty")
+	}
+	if config.Field == "" {
+		config.Field = defaultField
+	}
+	expr, err := parseRuleExpr(config.Expr)
+	if err != nil {
+		return nil, err
+	}
+	r := &rule{
+		config:      config,
+		expr:        expr,
+		annotations: make(map[string]*template.Template, len(config.Annotations)),
+		active:      make(map[string]*activeAlert),
+	}
+	for name, text := range config.Annotations {
+		text = strings.ReplaceAll(text, "$labels", ".Labels")
+		text = strings.ReplaceAll(text, "$value", ".Value")
+		tmpl, err := template.New(name).Option("missingkey=zero").Parse(text)
+		if err != nil {
+			return nil, errors.Wrapf(err, "bad annotation %s", name)
+		}
+		r.annotations[name] = tmpl
+	}
+	return r, nil
+}
+
+func (a *AlertRuleProcessor) Start(in <-chan []*message.Message, out chan<- []*message.Message) error {
+	for msgs := range in {
+		newMsgs, err := a.Process(context.Background(), msgs...)
+		if err != nil {
+			log.Errorf("alertRuleProcessor process messages failed, err: %s", err)
+		}
+		if len(newMsgs) > 0 {
+			out <- newMsgs
+		}
+	}
+	return nil
+}
+
+func (a *AlertRuleProcessor) Stop() {}
+
+func (a *AlertRuleProcessor) Process(ctx context.Context, metrics ...*message.Message) ([]*message.Message, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	now := a.now()
+	ret := make([]*message.Message, 0)
+	if a.Config.KeepMetrics {
+		ret = append(ret, metrics...)
+	}
+	for _, r := range a.rules {
+		ret = r.eval(ctx, metrics, now, a.Config.ResolveTimeout, ret)
+	}
+	return ret, nil
+}
+
+func (r *rule) eval(ctx context.Context, metrics []*message.Message, now time.Time, resolveTimeout time.Duration, ret []*message.Message) []*message.Message {
+	seen := make(map[string]bool)
+	for _, metric := range metrics {
+		if !r.expr.matchSeries(metric) {
+			continue
+		}
+		v, found := metric.GetField(r.config.Field)
+		if !found {
+			continue
+		}
+		value, ok := utils.ConvertToFloat64(v)
+		if !ok {
+			log.WithContext(ctx).Warnf("alert %s can not convert value %v of field %s to float64", r.config.Alert, v, r.config.Field)
+			continue
+		}
+		key := metric.Identifier()
+		seen[key] = true
+		alert, exists := r.active[key]
+		if !r.expr.op.compare(value, r.expr.threshold) {
+			if exists {
+				if alert.state == stateFiring {
+					ret = append(ret, r.alertMessage(alert, stateResolved, now))
+				}
+				delete(r.active, key)
+			}
+			continue
+		}
+		if !exists {
+			alert = &activeAlert{
+				state:    statePending,
+				tags:     append([]message.TagEntry{}, metric.Tags()...),
+				activeAt: now,
+			}
+			r.active[key] = alert
+		}
+		alert.value = value
+		alert.lastSeen = now
+		if alert.state == statePending && now.Sub(alert.activeAt) >= r.config.For {
+			alert.state = stateFiring
+		}
+		if alert.state == stateFiring {
+			ret = append(ret, r.alertMessage(alert, stateFiring, now))
+		}
+	}
+	for key, alert := range r.active {
+		if seen[key] || now.Sub(alert.lastSeen) <= resolveTimeout {
+			continue
+		}
+		if alert.state == stateFiring {
+			ret = append(ret, r.alertMessage(alert, stateResolved, now))
+		}
+		delete(r.active, key)
+	}
+	return ret
+}
+
+// alertMessage builds the message in the form converted by alertmanager output
+func (r *rule) alertMessage(alert *activeAlert, state alertState, now time.Time) *message.Message {
+	msg := message.NewMessage(r.config.Alert, message.Untyped, alert.activeAt)
+	labels := make(map[string]string, len(alert.tags)+len(r.config.Labels))
+	for _, tag := range alert.tags {
+		labels[tag.Name] = tag.Value
+	}
+	for name, value := range r.config.Labels {
+		labels[name] = value
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		msg.AddTag(name, labels[name])
+	}
+
+	data := templateData{Labels: labels, Value: alert.value}
+	for name, tmpl := range r.annotations {
+		sb := strings.Builder{}
+		err := tmpl.Execute(&sb, data)
+		if err != nil {
+			log.Warnf("alert %s render annotation %s failed: %s", r.config.Alert, name, err)
+			continue
+		}
+		msg.AddField(name, sb.String())
+	}
+	if state == stateResolved {
+		msg.AddField(EndsAtField, now)
+	}
+	return msg
+}
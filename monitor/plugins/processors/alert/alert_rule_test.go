@@ -0,0 +1,143 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package alert
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"github.com/oceanbase/obagent/monitor/message"
+)
+
+func newSessionMetric(svrIp string, value float64) *message.Message {
+	return message.NewMessage("ob_active_session", message.Gauge, time.Now()).
+		AddTag("svr_ip", svrIp).
+		AddField("value", value)
+}
+
+func TestAlertRuleProcessor_stateTransition(t *testing.T) {
+	now := time.Now()
+	configStr := `
+rules:
+  - alert: session_high
+    expr: ob_active_session{svr_ip="127.0.0.1"} > 100
+    for: 1m
+    labels:
+      severity: warning
+    annotations:
+      summary: "{{ $labels.svr_ip }} active session is {{ $value }}"
+`
+	var configMap map[string]interface{}
+	require.Nil(t, yaml.Unmarshal([]byte(configStr), &configMap))
+	processor := &AlertRuleProcessor{}
+	require.Nil(t, processor.Init(context.Background(), configMap))
+	processor.now = func() time.Time {
+		return now
+	}
+
+	// pending
+	out, err := processor.Process(context.Background(), newSessionMetric("127.0.0.1", 200), newSessionMetric("127.0.0.2", 200))
+	require.Nil(t, err)
+	require.Equal(t, 0, len(out))
+
+	// firing after 'for'
+	activeAt := now
+	now = now.Add(time.Minute)
+	out, _ = processor.Process(context.Background(), newSessionMetric("127.0.0.1", 300))
+	require.Equal(t, 1, len(out))
+	require.Equal(t, "session_high", out[0].GetName())
+	require.Equal(t, activeAt, out[0].GetTime())
+	severity, _ := out[0].GetTag("severity")
+	require.Equal(t, "warning", severity)
+	summary, _ := out[0].GetField("summary")
+	require.Equal(t, "127.0.0.1 active session is 300", summary)
+	_, hasEndsAt := out[0].GetField(EndsAtField)
+	require.False(t, hasEndsAt)
+
+	// resolved
+	now = now.Add(time.Minute)
+	out, _ = processor.Process(context.Background(), newSessionMetric("127.0.0.1", 10))
+	require.Equal(t, 1, len(out))
+	endsAt, hasEndsAt := out[0].GetField(EndsAtField)
+	require.True(t, hasEndsAt)
+	require.Equal(t, now, endsAt)
+
+	// pending reset when the condition is not met
+	now = now.Add(time.Minute)
+	out, _ = processor.Process(context.Background(), newSessionMetric("127.0.0.1", 200))
+	require.Equal(t, 0, len(out))
+}
+
+func TestAlertRuleProcessor_resolveStaleSeries(t *testing.T) {
+	now := time.Now()
+	configStr := `
+keepMetrics: true
+resolveTimeout: 2m
+rules:
+  - alert: session_high
+    expr: ob_active_session > 100
+`
+	var configMap map[string]interface{}
+	require.Nil(t, yaml.Unmarshal([]byte(configStr), &configMap))
+	processor := &AlertRuleProcessor{}
+	require.Nil(t, processor.Init(context.Background(), configMap))
+	processor.now = func() time.Time {
+		return now
+	}
+	out, _ := processor.Process(context.Background(), newSessionMetric("127.0.0.1", 200))
+	// metric and the firing alert
+	require.Equal(t, 2, len(out))
+
+	now = now.Add(time.Minute)
+	other := message.NewMessage("other", message.Gauge, now).AddField("value", 1.0)
+	out, _ = processor.Process(context.Background(), other)
+	require.Equal(t, 1, len(out))
+
+	now = now.Add(2 * time.Minute)
+	out, _ = processor.Process(context.Background(), other)
+	require.Equal(t, 2, len(out))
+	_, hasEndsAt := out[1].GetField(EndsAtField)
+	require.True(t, hasEndsAt)
+}
+
+func TestAlertRuleProcessor_ruleFiles(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "rules.yaml")
+	require.Nil(t, os.WriteFile(file, []byte(`
+groups:
+  - name: ob-alert
+    rules:
+      - alert: ob_host_connection_percent_over_threshold
+        expr: 100 * ob_active_session_num / 262144 > 80
+        for: 1m
+      - alert: session_high
+        expr: ob_active_session > 100
+`), 0644))
+	now := time.Now()
+	configStr := "ruleFiles: [" + file + "]"
+	var configMap map[string]interface{}
+	require.Nil(t, yaml.Unmarshal([]byte(configStr), &configMap))
+	processor := &AlertRuleProcessor{}
+	require.Nil(t, processor.Init(context.Background(), configMap))
+	processor.now = func() time.Time {
+		return now
+	}
+	require.Equal(t, 1, len(processor.rules))
+	out, _ := processor.Process(context.Background(), newSessionMetric("127.0.0.1", 200))
+	require.Equal(t, 1, len(out))
+}
@@ -0,0 +1,218 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package alert
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/oceanbase/obagent/errors"
+	"github.com/oceanbase/obagent/monitor/message"
+)
+
+type matchType string
+
+const (
+	matchEqual     matchType = "="
+	matchNotEqual  matchType = "!="
+	matchRegexp    matchType = "=~"
+	matchNotRegexp matchType = "!~"
+)
+
+type tagMatcher struct {
+	name      string
+	matchType matchType
+	value     string
+	re        *regexp.Regexp
+}
+
+func newTagMatcher(name string, t matchType, value string) (*tagMatcher, error) {
+	m := &tagMatcher{name: name, matchType: t, value: value}
+	if t == matchRegexp || t == matchNotRegexp {
+		re, err := regexp.Compile("^(?:" + value + ")$")
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid regexp of tag %s", name)
+		}
+		m.re = re
+	}
+	return m, nil
+}
+
+// match a tag not exists is treated as an empty value, the same as prometheus
+func (m *tagMatcher) match(msg *message.Message) bool {
+	v, _ := msg.GetTag(m.name)
+	switch m.matchType {
+	case matchEqual:
+		return v == m.value
+	case matchNotEqual:
+		return v != m.value
+	case matchRegexp:
+		return m.re.MatchString(v)
+	case matchNotRegexp:
+		return !m.re.MatchString(v)
+	}
+	return false
+}
+
+var metricNameRegexp = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+type compareOp string
+
+var compareOps = []compareOp{">=", "<=", "==", "!=", ">", "<"}
+
+func (op compareOp) compare(a, b float64) bool {
+	switch op {
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case "==":
+		return a == b
+	case "!=":
+		return a != b
+	}
+	return false
+}
+
+// ruleExpr a PromQL-lite expression: metric{tag="v",tag!="v",tag=~"re",tag!~"re"} op threshold
+type ruleExpr struct {
+	metric    string
+	matchers  []*tagMatcher
+	op        compareOp
+	threshold float64
+}
+
+func (e *ruleExpr) matchSeries(msg *message.Message) bool {
+	if msg.GetName() != e.metric {
+		return false
+	}
+	for _, m := range e.matchers {
+		if !m.match(msg) {
+			return false
+		}
+	}
+	return true
+}
+
+func parseRuleExpr(expr string) (*ruleExpr, error) {
+	expr = strings.TrimSpace(expr)
+	ret := &ruleExpr{}
+	rest := expr
+	nameEnd := strings.IndexAny(rest, "{ ><=!")
+	if nameEnd < 0 {
+		return nil, errors.Errorf("invalid expr %s: comparison not found", expr)
+	}
+	ret.metric = rest[:nameEnd]
+	if !metricNameRegexp.MatchString(ret.metric) {
+		return nil, errors.Errorf("invalid expr %s: bad metric name", expr)
+	}
+	rest = strings.TrimSpace(rest[nameEnd:])
+	if strings.HasPrefix(rest, "{") {
+		matchers, n, err := parseMatchers(rest)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid expr %s", expr)
+		}
+		ret.matchers = matchers
+		rest = strings.TrimSpace(rest[n:])
+	}
+	for _, op := range compareOps {
+		if strings.HasPrefix(rest, string(op)) {
+			ret.op = op
+			rest = strings.TrimSpace(rest[len(op):])
+			break
+		}
+	}
+	if ret.op == "" {
+		return nil, errors.Errorf("invalid expr %s: comparison not found", expr)
+	}
+	threshold, err := strconv.ParseFloat(rest, 64)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid expr %s: bad threshold", expr)
+	}
+	ret.threshold = threshold
+	return ret, nil
+}
+
+// parseMatchers parses {...} at the beginning of s, returns the matchers and the length consumed
+func parseMatchers(s string) ([]*tagMatcher, int, error) {
+	var matchers []*tagMatcher
+	i := 1
+	skipSpace := func() {
+		for i < len(s) && s[i] == ' ' {
+			i++
+		}
+	}
+	for {
+		skipSpace()
+		if i >= len(s) {
+			return nil, 0, errors.New("unclosed tag matchers")
+		}
+		if s[i] == '}' {
+			return matchers, i + 1, nil
+		}
+		start := i
+		for i < len(s) && (s[i] == '_' || s[i] == '.' || s[i] == '-' ||
+			(s[i] >= 'a' && s[i] <= 'z') || (s[i] >= 'A' && s[i] <= 'Z') || (s[i] >= '0' && s[i] <= '9')) {
+			i++
+		}
+		name := s[start:i]
+		if name == "" {
+			return nil, 0, errors.Errorf("bad tag name at %d", start)
+		}
+		skipSpace()
+		var t matchType
+		for _, candidate := range []matchType{matchRegexp, matchNotRegexp, matchNotEqual, matchEqual} {
+			if strings.HasPrefix(s[i:], string(candidate)) {
+				t = candidate
+				break
+			}
+		}
+		if t == "" {
+			return nil, 0, errors.Errorf("bad match operator of tag %s", name)
+		}
+		i += len(t)
+		skipSpace()
+		if i >= len(s) || s[i] != '"' {
+			return nil, 0, errors.Errorf("value of tag %s should be quoted", name)
+		}
+		end := i + 1
+		for end < len(s) && s[end] != '"' {
+			if s[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(s) {
+			return nil, 0, errors.Errorf("unclosed value of tag %s", name)
+		}
+		value, err := strconv.Unquote(s[i : end+1])
+		if err != nil {
+			return nil, 0, errors.Wrapf(err, "bad value of tag %s", name)
+		}
+		i = end + 1
+		m, err := newTagMatcher(name, t, value)
+		if err != nil {
+			return nil, 0, err
+		}
+		matchers = append(matchers, m)
+		skipSpace()
+		if i < len(s) && s[i] == ',' {
+			i++
+		}
+	}
+}
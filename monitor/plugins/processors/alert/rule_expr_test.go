@@ -0,0 +1,57 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package alert
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oceanbase/obagent/monitor/message"
+)
+
+func TestParseRuleExpr(t *testing.T) {
+	expr, err := parseRuleExpr(`ob_sysstat{stat_id="10000", svr_ip=~"10\\..*",tenant!="sys", zone!~"z1|z2"} >= 1.5`)
+	require.Nil(t, err)
+	require.Equal(t, "ob_sysstat", expr.metric)
+	require.Equal(t, 4, len(expr.matchers))
+	require.Equal(t, compareOp(">="), expr.op)
+	require.Equal(t, 1.5, expr.threshold)
+
+	msg := message.NewMessage("ob_sysstat", message.Gauge, time.Now()).
+		AddTag("stat_id", "10000").AddTag("svr_ip", "10.0.0.1").AddTag("tenant", "t1").AddTag("zone", "z3")
+	require.True(t, expr.matchSeries(msg))
+	msg.SetTag("zone", "z1")
+	require.False(t, expr.matchSeries(msg))
+
+	expr, err = parseRuleExpr("node_load1 > 10")
+	require.Nil(t, err)
+	require.Equal(t, "node_load1", expr.metric)
+	require.Equal(t, 0, len(expr.matchers))
+	require.True(t, expr.op.compare(11, expr.threshold))
+}
+
+func TestParseRuleExpr_unsupported(t *testing.T) {
+	exprs := []string{
+		"100 * ob_active_session_num / 262144 > 80",
+		"rate(node_network_receive_bytes_total[60s]) > 100000000",
+		`ob_sysstat{stat_id="1"`,
+		"ob_sysstat",
+		"ob_sysstat > abc",
+	}
+	for _, expr := range exprs {
+		_, err := parseRuleExpr(expr)
+		require.NotNil(t, err, expr)
+	}
+}
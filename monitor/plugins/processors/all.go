@@ -19,8 +19,12 @@ import (
 	"github.com/oceanbase/obagent/config/monagent"
 	"github.com/oceanbase/obagent/monitor/plugins"
 	"github.com/oceanbase/obagent/monitor/plugins/processors/aggregate"
+	"github.com/oceanbase/obagent/monitor/plugins/processors/alert"
 	"github.com/oceanbase/obagent/monitor/plugins/processors/attr"
+	"github.com/oceanbase/obagent/monitor/plugins/processors/expression"
 	"github.com/oceanbase/obagent/monitor/plugins/processors/jointable"
+	"github.com/oceanbase/obagent/monitor/plugins/processors/logmetric"
+	"github.com/oceanbase/obagent/monitor/plugins/processors/rate"
 	"github.com/oceanbase/obagent/monitor/plugins/processors/retag"
 	"github.com/oceanbase/obagent/monitor/plugins/processors/slsmetric"
 	"github.com/oceanbase/obagent/monitor/plugins/processors/transformer"
@@ -76,6 +80,42 @@ func init() {
 		}
 		return logTransformer, nil
 	})
+	plugins.GetProcessorManager().Register("alertRuleProcessor", func(conf *monagent.PluginConfig) (plugins.Processor, error) {
+		processor := &alert.AlertRuleProcessor{}
+		err := processor.Init(context.Background(), conf.PluginInnerConfig)
+		if err != nil {
+			log.WithError(err).Error("init alertRuleProcessor failed")
+			return nil, err
+		}
+		return processor, nil
+	})
+	plugins.GetProcessorManager().Register("rateProcessor", func(conf *monagent.PluginConfig) (plugins.Processor, error) {
+		processor := &rate.RateProcessor{}
+		err := processor.Init(context.Background(), conf.PluginInnerConfig)
+		if err != nil {
+			log.WithError(err).Error("init rateProcessor failed")
+			return nil, err
+		}
+		return processor, nil
+	})
+	plugins.GetProcessorManager().Register("expressionProcessor", func(conf *monagent.PluginConfig) (plugins.Processor, error) {
+		processor := &expression.ExpressionProcessor{}
+		err := processor.Init(context.Background(), conf.PluginInnerConfig)
+		if err != nil {
+			log.WithError(err).Error("init expressionProcessor failed")
+			return nil, err
+		}
+		return processor, nil
+	})
+	plugins.GetProcessorManager().Register("logMetricProcessor", func(conf *monagent.PluginConfig) (plugins.Processor, error) {
+		processor := &logmetric.LogMetricProcessor{}
+		err := processor.Init(context.Background(), conf.PluginInnerConfig)
+		if err != nil {
+			log.WithError(err).Error("init logMetricProcessor failed")
+			return nil, err
+		}
+		return processor, nil
+	})
 	plugins.GetProcessorManager().Register("slsmetric", func(conf *monagent.PluginConfig) (plugins.Processor, error) {
 		slsMetricProcessor := slsmetric.NewSlsMetricProcessor()
 		return slsMetricProcessor, nil
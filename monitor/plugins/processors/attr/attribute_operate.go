@@ -64,6 +64,13 @@ func (r *AttrProcessor) Init(ctx context.Context, config map[string]interface{})
 		return errors.Wrap(err, "retagProcessor decode config")
 	}
 
+	for i := range attrConfig.Operations {
+		err = attrConfig.Operations[i].Condition.init()
+		if err != nil {
+			return errors.Wrapf(err, "attrProcessor init condition of operation %s", attrConfig.Operations[i].Oper)
+		}
+	}
+
 	r.Config = attrConfig
 
 	log.WithContext(ctx).Infof("init retagProcessor with config: %+v", r.Config)
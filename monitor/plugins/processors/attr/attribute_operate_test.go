@@ -56,3 +56,45 @@ operations:
 	outmsg := <-out
 	assert.Equal(t, 4, len(outmsg[0].Tags()))
 }
+
+func TestAttrMatchers(t *testing.T) {
+	configStr := `
+operations:
+  - oper: removeMetric
+    condition:
+      metricMatcher:
+        regex: ob_(sysstat|waitevent)
+      tagMatchers:
+        - name: tenant_id
+          min: 1001
+          max: 1999
+      fieldMatchers:
+        - name: value
+          min: 10
+`
+	var configMap map[string]interface{}
+	_ = yaml.Unmarshal([]byte(configStr), &configMap)
+
+	processor := &AttrProcessor{}
+	assert.Nil(t, processor.Init(context.Background(), configMap))
+
+	newMsg := func(name string, tenantId string, value float64) *message.Message {
+		return message.NewMessage(name, message.Gauge, time.Now()).
+			AddTag("tenant_id", tenantId).
+			AddField("value", value)
+	}
+	msgs, _ := processor.Process(context.Background(),
+		newMsg("ob_sysstat", "1001", 10),
+		newMsg("ob_waitevent", "1999", 100),
+		newMsg("ob_sysstat", "1", 100),
+		newMsg("ob_sysstat", "1500", 1),
+		newMsg("ob_cache", "1500", 100),
+	)
+	remained := 0
+	for _, msg := range msgs {
+		if len(msg.Fields()) > 0 {
+			remained++
+		}
+	}
+	assert.Equal(t, 3, remained)
+}
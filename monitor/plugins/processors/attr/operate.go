@@ -14,6 +14,7 @@ package attr
 
 import (
 	"github.com/oceanbase/obagent/monitor/message"
+	"github.com/oceanbase/obagent/monitor/utils"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -40,6 +41,14 @@ type Condition struct {
 	Metric string
 	Fields map[string]float64
 	Tags   map[string]string
+	// MetricMatcher, TagMatchers and FieldMatchers match by regex, prefix, not-equal, set or numeric range
+	MetricMatcher *utils.ValueMatcher   `yaml:"metricMatcher"`
+	TagMatchers   []*utils.ValueMatcher `yaml:"tagMatchers"`
+	FieldMatchers []*utils.ValueMatcher `yaml:"fieldMatchers"`
+}
+
+func (c *Condition) init() error {
+	return utils.InitMatchers(c.MetricMatcher, c.TagMatchers, c.FieldMatchers)
 }
 
 func (c *Condition) isMatched(metric *message.Message) bool {
@@ -47,6 +56,9 @@ func (c *Condition) isMatched(metric *message.Message) bool {
 	if !metricMatched {
 		return false
 	}
+	if c.MetricMatcher != nil && !c.MetricMatcher.Match(metric.GetName()) {
+		return false
+	}
 	fieldsMatched := true
 	for name, value := range c.Fields {
 		fieldVal, ex := metric.GetField(name)
@@ -69,6 +81,18 @@ func (c *Condition) isMatched(metric *message.Message) bool {
 	if !tagsMatched {
 		return false
 	}
+	for _, matcher := range c.TagMatchers {
+		tagVal, ex := metric.GetTag(matcher.Name)
+		if !ex || !matcher.Match(tagVal) {
+			return false
+		}
+	}
+	for _, matcher := range c.FieldMatchers {
+		fieldVal, ex := metric.GetField(matcher.Name)
+		if !ex || !matcher.MatchValue(fieldVal) {
+			return false
+		}
+	}
 
 	return true
 }
@@ -0,0 +1,224 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package expression
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/oceanbase/obagent/errors"
+)
+
+var (
+	errMissingVariable = errors.New("variable missing")
+	errDivideByZero    = errors.New("divide by zero")
+)
+
+// expr arithmetic expression over variables and constants
+type expr interface {
+	eval(env func(name string) (float64, bool)) (float64, error)
+}
+
+type constExpr float64
+
+func (c constExpr) eval(env func(name string) (float64, bool)) (float64, error) {
+	return float64(c), nil
+}
+
+type varExpr string
+
+func (v varExpr) eval(env func(name string) (float64, bool)) (float64, error) {
+	value, ok := env(string(v))
+	if !ok {
+		return 0, errors.Wrapf(errMissingVariable, "%s", string(v))
+	}
+	return value, nil
+}
+
+type negExpr struct {
+	e expr
+}
+
+func (n negExpr) eval(env func(name string) (float64, bool)) (float64, error) {
+	v, err := n.e.eval(env)
+	return -v, err
+}
+
+type binaryExpr struct {
+	op          byte
+	left, right expr
+}
+
+func (b binaryExpr) eval(env func(name string) (float64, bool)) (float64, error) {
+	l, err := b.left.eval(env)
+	if err != nil {
+		return 0, err
+	}
+	r, err := b.right.eval(env)
+	if err != nil {
+		return 0, err
+	}
+	switch b.op {
+	case '+':
+		return l + r, nil
+	case '-':
+		return l - r, nil
+	case '*':
+		return l * r, nil
+	default:
+		if r == 0 {
+			return 0, errDivideByZero
+		}
+		return l / r, nil
+	}
+}
+
+// exprParser recursive descent parser of:
+//
+//	expr   = term { ('+' | '-') term }
+//	term   = unary { ('*' | '/') unary }
+//	unary  = '-' unary | factor
+//	factor = number | variable | '`' any '`' | '(' expr ')'
+//
+// variables are field names, or <alias>.<field> to reference fields of the joined metric.
+type exprParser struct {
+	s   string
+	pos int
+}
+
+func parseExpr(s string) (expr, error) {
+	p := &exprParser{s: s}
+	e, err := p.parseExpr()
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse expr %s", s)
+	}
+	p.skipSpace()
+	if p.pos < len(p.s) {
+		return nil, errors.Errorf("parse expr %s: unexpected %q at %d", s, p.s[p.pos], p.pos)
+	}
+	return e, nil
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *exprParser) peek() byte {
+	p.skipSpace()
+	if p.pos >= len(p.s) {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+func (p *exprParser) parseExpr() (expr, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if op != '+' && op != '-' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseTerm() (expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if op != '*' && op != '/' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseUnary() (expr, error) {
+	if p.peek() == '-' {
+		p.pos++
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return negExpr{e: e}, nil
+	}
+	return p.parseFactor()
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '.' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func (p *exprParser) parseFactor() (expr, error) {
+	c := p.peek()
+	switch {
+	case c == 0:
+		return nil, errors.New("unexpected end")
+	case c == '(':
+		p.pos++
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, errors.Errorf("missing ) at %d", p.pos)
+		}
+		p.pos++
+		return e, nil
+	case c == '`':
+		end := strings.IndexByte(p.s[p.pos+1:], '`')
+		if end < 0 {
+			return nil, errors.Errorf("unclosed ` at %d", p.pos)
+		}
+		name := p.s[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+		return varExpr(name), nil
+	case (c >= '0' && c <= '9') || c == '.':
+		start := p.pos
+		for p.pos < len(p.s) && ((p.s[p.pos] >= '0' && p.s[p.pos] <= '9') || p.s[p.pos] == '.' || p.s[p.pos] == 'e' || p.s[p.pos] == 'E' ||
+			((p.s[p.pos] == '+' || p.s[p.pos] == '-') && (p.s[p.pos-1] == 'e' || p.s[p.pos-1] == 'E'))) {
+			p.pos++
+		}
+		v, err := strconv.ParseFloat(p.s[start:p.pos], 64)
+		if err != nil {
+			return nil, errors.Errorf("bad number %s", p.s[start:p.pos])
+		}
+		return constExpr(v), nil
+	case isIdentChar(c):
+		start := p.pos
+		for p.pos < len(p.s) && isIdentChar(p.s[p.pos]) {
+			p.pos++
+		}
+		return varExpr(p.s[start:p.pos]), nil
+	default:
+		return nil, errors.Errorf("unexpected %q at %d", c, p.pos)
+	}
+}
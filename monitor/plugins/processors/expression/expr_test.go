@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package expression
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExpr(t *testing.T) {
+	vars := map[string]float64{
+		"hit":         3,
+		"miss":        1,
+		"avail.value": 25,
+		"value":       100,
+		"0.99":        7,
+	}
+	env := func(name string) (float64, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}
+	tests := []struct {
+		expr   string
+		expect float64
+	}{
+		{"hit / (hit + miss)", 0.75},
+		{"100 * (1 - avail.value / value)", 75},
+		{"-hit + 2 * -miss", -5},
+		{"1e2 - `0.99`", 93},
+		{"hit - miss - 1", 1},
+		{"value / 4 / 5", 5},
+	}
+	for _, tt := range tests {
+		e, err := parseExpr(tt.expr)
+		require.Nil(t, err, tt.expr)
+		v, err := e.eval(env)
+		require.Nil(t, err, tt.expr)
+		require.InDelta(t, tt.expect, v, 1e-9, tt.expr)
+	}
+
+	e, _ := parseExpr("hit / (miss - 1)")
+	_, err := e.eval(env)
+	require.NotNil(t, err)
+	e, _ = parseExpr("hit / not_exist")
+	_, err = e.eval(env)
+	require.NotNil(t, err)
+}
+
+func TestParseExpr_invalid(t *testing.T) {
+	for _, expr := range []string{"", "hit +", "(hit", "hit miss", "hit % 2", "`hit"} {
+		_, err := parseExpr(expr)
+		require.NotNil(t, err, expr)
+	}
+}
@@ -0,0 +1,222 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package expression
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+
+	"github.com/oceanbase/obagent/errors"
+	"github.com/oceanbase/obagent/monitor/message"
+	"github.com/oceanbase/obagent/monitor/utils"
+)
+
+const sampleConfig = `
+rules:
+  - metric: ob_cache
+    field: hit_ratio
+    expr: hit / (hit + miss)
+    defaultValue: 0
+  - metric: node_filesystem_size_bytes
+    targetMetric: node_filesystem_used_percent
+    field: value
+    expr: 100 * (1 - avail.value / value)
+    join:
+      metric: node_filesystem_avail_bytes
+      alias: avail
+      tags: [ device, mountpoint ]
+`
+
+const description = `
+compute fields with arithmetic expressions over fields of the same message, or of two messages sharing tags
+`
+
+const defaultField = "value"
+
+type JoinConfig struct {
+	// Metric name of the metric to join with
+	Metric string `yaml:"metric"`
+	// Alias prefix to reference fields of the joined metric in expression, default the metric name
+	Alias string `yaml:"alias"`
+	// Tags the tags must be equal to join, empty means all tags must be equal
+	Tags []string `yaml:"tags"`
+}
+
+type Rule struct {
+	// Metric name of the source metric
+	Metric string `yaml:"metric"`
+	// Field name of result field, default value
+	Field string `yaml:"field"`
+	// TargetMetric when set, the result is emitted as a new gauge with the tags of source metric,
+	// otherwise the result field is set to the source metric
+	TargetMetric string `yaml:"targetMetric"`
+	// Expr arithmetic expression with + - * / and parentheses over fields and constants
+	Expr string `yaml:"expr"`
+	// DefaultValue used when a field is missing or divided by zero, the result is skipped if not set
+	DefaultValue *float64    `yaml:"defaultValue"`
+	Join         *JoinConfig `yaml:"join"`
+}
+
+type ExpressionConfig struct {
+	Rules []*Rule `yaml:"rules"`
+}
+
+type rule struct {
+	config *Rule
+	expr   expr
+}
+
+// ExpressionProcessor evaluates rules in order, a rule can use the fields computed by former rules.
+type ExpressionProcessor struct {
+	Config *ExpressionConfig
+	rules  []*rule
+}
+
+func (e *ExpressionProcessor) SampleConfig() string {
+	return sampleConfig
+}
+
+func (e *ExpressionProcessor) Description() string {
+	return description
+}
+
+func (e *ExpressionProcessor) Init(ctx context.Context, config map[string]interface{}) error {
+	var expressionConfig ExpressionConfig
+	configBytes, err := yaml.Marshal(config)
+	if err != nil {
+		return errors.Wrap(err, "expressionProcessor encode config")
+	}
+	err = yaml.Unmarshal(configBytes, &expressionConfig)
+	if err != nil {
+		return errors.Wrap(err, "expressionProcessor decode config")
+	}
+	e.rules = make([]*rule, 0, len(expressionConfig.Rules))
+	for _, ruleConfig := range expressionConfig.Rules {
+		if ruleConfig.Metric == "" {
+			return errors.New("expressionProcessor metric of rule is empty")
+		}
+		if ruleConfig.Field == "" {
+			ruleConfig.Field = defaultField
+		}
+		if ruleConfig.Join != nil {
+			if ruleConfig.Join.Metric == "" {
+				return errors.Errorf("expressionProcessor join metric of rule %s is empty", ruleConfig.Metric)
+			}
+			if ruleConfig.Join.Alias == "" {
+				ruleConfig.Join.Alias = ruleConfig.Join.Metric
+			}
+			sort.Strings(ruleConfig.Join.Tags)
+		}
+		parsed, err := parseExpr(ruleConfig.Expr)
+		if err != nil {
+			return errors.Wrapf(err, "expressionProcessor rule of metric %s", ruleConfig.Metric)
+		}
+		e.rules = append(e.rules, &rule{config: ruleConfig, expr: parsed})
+	}
+	e.Config = &expressionConfig
+	log.WithContext(ctx).Infof("init expressionProcessor with config: %+v", e.Config)
+	return nil
+}
+
+func (e *ExpressionProcessor) Start(in <-chan []*message.Message, out chan<- []*message.Message) error {
+	for msgs := range in {
+		newMsgs, err := e.Process(context.Background(), msgs...)
+		if err != nil {
+			log.Errorf("expressionProcessor process messages failed, err: %s", err)
+		}
+		out <- newMsgs
+	}
+	return nil
+}
+
+func (e *ExpressionProcessor) Stop() {}
+
+func (e *ExpressionProcessor) Process(ctx context.Context, metrics ...*message.Message) ([]*message.Message, error) {
+	ret := make([]*message.Message, 0, len(metrics))
+	ret = append(ret, metrics...)
+	byName := make(map[string][]*message.Message)
+	for _, metric := range metrics {
+		byName[metric.GetName()] = append(byName[metric.GetName()], metric)
+	}
+	for _, r := range e.rules {
+		var joined map[string]*message.Message
+		if r.config.Join != nil {
+			joined = make(map[string]*message.Message)
+			for _, metric := range byName[r.config.Join.Metric] {
+				joined[r.joinKey(metric)] = metric
+			}
+		}
+		for _, metric := range byName[r.config.Metric] {
+			var other *message.Message
+			if joined != nil {
+				other = joined[r.joinKey(metric)]
+				if other == nil {
+					continue
+				}
+			}
+			value, ok := r.eval(ctx, metric, other)
+			if !ok {
+				continue
+			}
+			if r.config.TargetMetric == "" {
+				metric.SetField(r.config.Field, value)
+				continue
+			}
+			newMetric := message.NewMessageWithTagsFields(r.config.TargetMetric, message.Gauge, metric.GetTime(),
+				append([]message.TagEntry{}, metric.Tags()...), []message.FieldEntry{{Name: r.config.Field, Value: value}})
+			ret = append(ret, newMetric)
+			byName[newMetric.GetName()] = append(byName[newMetric.GetName()], newMetric)
+		}
+	}
+	return ret, nil
+}
+
+func (r *rule) joinKey(metric *message.Message) string {
+	if len(r.config.Join.Tags) == 0 {
+		id := metric.Identifier()
+		return id[len(metric.GetName()):]
+	}
+	values := make([]string, len(r.config.Join.Tags))
+	for i, tag := range r.config.Join.Tags {
+		values[i], _ = metric.GetTag(tag)
+	}
+	return strings.Join(values, "\x00")
+}
+
+func (r *rule) eval(ctx context.Context, metric *message.Message, other *message.Message) (float64, bool) {
+	env := func(name string) (float64, bool) {
+		source := metric
+		if other != nil && strings.HasPrefix(name, r.config.Join.Alias+".") {
+			source = other
+			name = name[len(r.config.Join.Alias)+1:]
+		}
+		v, found := source.GetField(name)
+		if !found {
+			return 0, false
+		}
+		return utils.ConvertToFloat64(v)
+	}
+	value, err := r.expr.eval(env)
+	if err != nil {
+		log.WithContext(ctx).Debugf("expressionProcessor eval %s of %s failed: %s", r.config.Expr, metric.GetName(), err)
+		if r.config.DefaultValue == nil {
+			return 0, false
+		}
+		return *r.config.DefaultValue, true
+	}
+	return value, true
+}
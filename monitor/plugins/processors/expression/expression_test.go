@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package expression
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"github.com/oceanbase/obagent/monitor/message"
+)
+
+func TestExpressionProcessor_sameMessage(t *testing.T) {
+	configStr := `
+rules:
+  - metric: ob_cache
+    field: hit_ratio
+    expr: hit / (hit + miss)
+  - metric: ob_cache
+    field: hit_percent
+    expr: hit_ratio * 100
+    defaultValue: -1
+`
+	var configMap map[string]interface{}
+	require.Nil(t, yaml.Unmarshal([]byte(configStr), &configMap))
+	processor := &ExpressionProcessor{}
+	require.Nil(t, processor.Init(context.Background(), configMap))
+	now := time.Now()
+	out, err := processor.Process(context.Background(),
+		message.NewMessage("ob_cache", message.Gauge, now).AddTag("cache_name", "user_tab").AddField("hit", 3).AddField("miss", 1),
+		message.NewMessage("ob_cache", message.Gauge, now).AddTag("cache_name", "empty").AddField("hit", 0).AddField("miss", 0),
+	)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(out))
+	ratio, _ := out[0].GetField("hit_ratio")
+	require.Equal(t, 0.75, ratio)
+	percent, _ := out[0].GetField("hit_percent")
+	require.Equal(t, 75.0, percent)
+
+	// divide by zero skips the rule without default value
+	_, found := out[1].GetField("hit_ratio")
+	require.False(t, found)
+	percent, _ = out[1].GetField("hit_percent")
+	require.Equal(t, -1.0, percent)
+}
+
+func TestExpressionProcessor_join(t *testing.T) {
+	configStr := `
+rules:
+  - metric: node_filesystem_size_bytes
+    targetMetric: node_filesystem_used_percent
+    expr: 100 * (1 - avail.value / value)
+    join:
+      metric: node_filesystem_avail_bytes
+      alias: avail
+      tags: [ mountpoint ]
+`
+	var configMap map[string]interface{}
+	require.Nil(t, yaml.Unmarshal([]byte(configStr), &configMap))
+	processor := &ExpressionProcessor{}
+	require.Nil(t, processor.Init(context.Background(), configMap))
+	now := time.Now()
+	fs := func(name string, mountpoint string, value float64) *message.Message {
+		return message.NewMessage(name, message.Gauge, now).
+			AddTag("mountpoint", mountpoint).AddTag("fstype", "ext4").
+			AddField("value", value)
+	}
+	out, _ := processor.Process(context.Background(),
+		fs("node_filesystem_size_bytes", "/", 100),
+		fs("node_filesystem_size_bytes", "/data", 200),
+		fs("node_filesystem_size_bytes", "/home", 200),
+		fs("node_filesystem_avail_bytes", "/", 25),
+		fs("node_filesystem_avail_bytes", "/data", 150),
+	)
+	require.Equal(t, 7, len(out))
+	expected := map[string]float64{"/": 75, "/data": 25}
+	for _, msg := range out[5:] {
+		require.Equal(t, "node_filesystem_used_percent", msg.GetName())
+		require.Equal(t, message.Gauge, msg.GetMetricType())
+		mountpoint, _ := msg.GetTag("mountpoint")
+		value, _ := msg.GetField("value")
+		require.Equal(t, expected[mountpoint], value)
+	}
+}
@@ -20,9 +20,11 @@ import (
 
 	"github.com/oceanbase/obagent/errors"
 	"github.com/oceanbase/obagent/monitor/message"
+	"github.com/oceanbase/obagent/monitor/utils"
 )
 
 const sampleConfig = `
+mode: exclude
 conditions:
   - metric: m1
     tags:
@@ -32,19 +34,43 @@ conditions:
     tags:
       t1: v1
       t2: v2
+  - metricMatcher:
+      prefix: ob_
+    tagMatchers:
+      - name: tenant_id
+        min: 1001
+        max: 1999
+      - name: cache_name
+        regex: user_.*
+    fieldMatchers:
+      - name: value
+        notEqual: "0"
 `
 
 const description = `
-filter out metrics match condition
+filter out metrics match condition, or keep only metrics match condition in include mode
 `
 
+type FilterMode string
+
+const (
+	ExcludeMode FilterMode = "exclude"
+	IncludeMode FilterMode = "include"
+)
+
 type MetricFilterCondition struct {
 	MetricName string             `yaml:"metric"`
 	Tags       map[string]string  `yaml:"tags"`
 	Fields     map[string]float64 `yaml:"fields"`
+	// MetricMatcher matches metric name, used when metric is empty
+	MetricMatcher *utils.ValueMatcher   `yaml:"metricMatcher"`
+	TagMatchers   []*utils.ValueMatcher `yaml:"tagMatchers"`
+	FieldMatchers []*utils.ValueMatcher `yaml:"fieldMatchers"`
 }
 
 type ExcludeFilterConfig struct {
+	// Mode exclude (default) drops the metrics match any condition, include keeps only them
+	Mode       FilterMode               `yaml:"mode"`
 	Conditions []*MetricFilterCondition `yaml:"conditions"`
 }
 
@@ -73,6 +99,20 @@ func (e *ExcludeFilter) Init(ctx context.Context, config map[string]interface{})
 		return errors.Wrap(err, "excludeFilterProcessor decode config")
 	}
 
+	switch excludeFilterConfig.Mode {
+	case "":
+		excludeFilterConfig.Mode = ExcludeMode
+	case ExcludeMode, IncludeMode:
+	default:
+		return errors.Errorf("excludeFilterProcessor unknown mode %s", excludeFilterConfig.Mode)
+	}
+	for _, condition := range excludeFilterConfig.Conditions {
+		err = condition.init()
+		if err != nil {
+			return errors.Wrap(err, "excludeFilterProcessor init condition")
+		}
+	}
+
 	e.Config = &excludeFilterConfig
 
 	log.WithContext(ctx).Infof("init excludeFilterProcessor with config: %+v", e.Config)
@@ -95,38 +135,63 @@ func (e *ExcludeFilter) Stop() {}
 func (e *ExcludeFilter) Process(ctx context.Context, metrics ...*message.Message) ([]*message.Message, error) {
 	reservedMetrics := make([]*message.Message, 0, len(metrics))
 	for _, metricEntry := range metrics {
-		name := metricEntry.GetName()
 		match := false
 		for _, condition := range e.Config.Conditions {
-			if condition.MetricName == name {
+			if condition.isMatched(metricEntry) {
 				match = true
-				for tagName, tagValue := range condition.Tags {
-					v, exists := metricEntry.GetTag(tagName)
-					if !(exists && v == tagValue) {
-						match = false
-						break
-					}
-				}
-
-				// check fields matched
-				fieldsMatch := true
-				for name, value := range condition.Fields {
-					v, exists := metricEntry.GetField(name)
-					if exists && v != value {
-						fieldsMatch = false
-						break
-					}
-				}
-				match = match && (len(condition.Fields) == 0 || fieldsMatch)
-			}
-			if match {
 				break
 			}
 		}
-		if !match {
+		if match == (e.Config.Mode == IncludeMode) {
 			reservedMetrics = append(reservedMetrics, metricEntry)
 		}
 	}
 	log.WithContext(ctx).Debugf("after process, metrics length: %d", len(reservedMetrics))
 	return reservedMetrics, nil
 }
+
+func (c *MetricFilterCondition) init() error {
+	return utils.InitMatchers(c.MetricMatcher, c.TagMatchers, c.FieldMatchers)
+}
+
+func (c *MetricFilterCondition) isMatched(metricEntry *message.Message) bool {
+	name := metricEntry.GetName()
+	if c.MetricName != "" {
+		if c.MetricName != name {
+			return false
+		}
+	} else if c.MetricMatcher == nil {
+		return false
+	}
+	if c.MetricMatcher != nil && !c.MetricMatcher.Match(name) {
+		return false
+	}
+	for tagName, tagValue := range c.Tags {
+		v, exists := metricEntry.GetTag(tagName)
+		if !(exists && v == tagValue) {
+			return false
+		}
+	}
+
+	// check fields matched
+	for name, value := range c.Fields {
+		v, exists := metricEntry.GetField(name)
+		if exists && v != value {
+			return false
+		}
+	}
+
+	for _, matcher := range c.TagMatchers {
+		v, exists := metricEntry.GetTag(matcher.Name)
+		if !exists || !matcher.Match(v) {
+			return false
+		}
+	}
+	for _, matcher := range c.FieldMatchers {
+		v, exists := metricEntry.GetField(matcher.Name)
+		if !exists || !matcher.MatchValue(v) {
+			return false
+		}
+	}
+	return true
+}
@@ -140,3 +140,67 @@ func TestTagNotMatch(t *testing.T) {
 	metricsProcessed, _ := excludeFilter.Process(context.Background(), metrics...)
 	require.Equal(t, 1, len(metricsProcessed))
 }
+
+func newTenantMetrics() []*message.Message {
+	var metrics []*message.Message
+	for _, tenantId := range []string{"1", "1001", "1500", "2000"} {
+		metrics = append(metrics, message.NewMessage("ob_sysstat", message.Gauge, time.Now()).
+			AddTag("tenant_id", tenantId).
+			AddField("value", 1.0))
+	}
+	metrics = append(metrics, message.NewMessage("ob_cache_size_bytes", message.Gauge, time.Now()).
+		AddTag("cache_name", "user_tab_cache").
+		AddField("value", 100.0))
+	return metrics
+}
+
+func TestMatchers(t *testing.T) {
+	configStr := `
+        conditions:
+          - metricMatcher:
+              prefix: ob_sys
+            tagMatchers:
+              - name: tenant_id
+                min: 1001
+                max: 1999
+          - metric: ob_cache_size_bytes
+            tagMatchers:
+              - name: cache_name
+                regex: user_.*
+            fieldMatchers:
+              - name: value
+                notEqual: "0"
+    `
+	var filterConfigMap map[string]interface{}
+	_ = yaml.Unmarshal([]byte(configStr), &filterConfigMap)
+
+	excludeFilter := &ExcludeFilter{}
+	require.Nil(t, excludeFilter.Init(context.Background(), filterConfigMap))
+	metricsProcessed, _ := excludeFilter.Process(context.Background(), newTenantMetrics()...)
+	require.Equal(t, 2, len(metricsProcessed))
+	for _, metric := range metricsProcessed {
+		tenantId, _ := metric.GetTag("tenant_id")
+		require.Contains(t, []string{"1", "2000"}, tenantId)
+	}
+}
+
+func TestIncludeMode(t *testing.T) {
+	configStr := `
+        mode: include
+        conditions:
+          - metric: ob_sysstat
+            tagMatchers:
+              - name: tenant_id
+                in: [ "1", "2000" ]
+    `
+	var filterConfigMap map[string]interface{}
+	_ = yaml.Unmarshal([]byte(configStr), &filterConfigMap)
+
+	filter := &ExcludeFilter{}
+	require.Nil(t, filter.Init(context.Background(), filterConfigMap))
+	metricsProcessed, _ := filter.Process(context.Background(), newTenantMetrics()...)
+	require.Equal(t, 2, len(metricsProcessed))
+
+	filterConfigMap["mode"] = "unknown"
+	require.NotNil(t, (&ExcludeFilter{}).Init(context.Background(), filterConfigMap))
+}
@@ -16,6 +16,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/didi/gendry/scanner"
@@ -35,6 +36,10 @@ connection:
   url: user:password@tcp(127.0.0.1:2881)/oceanbase?interpolateParams=true
   maxIdle: 2
   maxOpen: 32
+tenantConnection:
+  url: user@{tenant}:password@tcp(127.0.0.1:2881)/oceanbase?interpolateParams=true
+  maxIdle: 1
+  maxOpen: 2
 joinTableConfigs:
   queryDataConfigs:
   - querySql: select 'tv1' as t1, 'tv2' as t2, 'tv3' as t3
@@ -51,7 +56,11 @@ joinTableConfigs:
 
 type JoinTablePluginConfig struct {
 	DbConnectionConfig common.DbConnectionConfig `yaml:"connection"`
-	JoinTableConfigs   []JoinTableConfig         `yaml:"joinTableConfigs"`
+	// Connections named connections, e.g. users of some tenants
+	Connections map[string]*common.DbConnectionConfig `yaml:"connections"`
+	// TenantConnection connection template of user tenants, {tenant} in url is replaced by tenant name
+	TenantConnection *common.DbConnectionConfig `yaml:"tenantConnection"`
+	JoinTableConfigs []JoinTableConfig          `yaml:"joinTableConfigs"`
 }
 
 type JoinTableConfig struct {
@@ -66,12 +75,17 @@ type QueryDataConfig struct {
 	QueryArgs    []interface{} `yaml:"queryArgs"`
 	MinOBVersion string        `yaml:"minOBVersion"`
 	MaxOBVersion string        `yaml:"maxOBVersion"`
+	// Connection name of the connection to query with, empty means the default connection
+	Connection string `yaml:"connection"`
+	// ForEachTenant query in every user tenant on the observer, ob_tenant_id and tenant_name are added to each row
+	ForEachTenant bool `yaml:"forEachTenant"`
 }
 
 type JoinTable struct {
 	Config *JoinTablePluginConfig
 	Db     *sql.DB
 	Ob     *common.Observer
+	Conns  *common.ConnectionManager
 	Cache  *common.Cache
 
 	ctx  context.Context
@@ -91,20 +105,13 @@ func (c *JoinTableConfig) init() {
 }
 
 func (j *JoinTable) initDbConnection() error {
-	db, err := sql.Open("mysql", j.Config.DbConnectionConfig.Url)
+	j.Conns = common.NewConnectionManager(&j.Config.DbConnectionConfig, j.Config.Connections, j.Config.TenantConnection)
+	err := j.Conns.Init()
 	if err != nil {
 		return errors.Wrap(err, "db init")
 	}
-	db.SetMaxOpenConns(j.Config.DbConnectionConfig.MaxOpen)
-	db.SetMaxIdleConns(j.Config.DbConnectionConfig.MaxIdle)
-	timeoutCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-	err = db.PingContext(timeoutCtx)
-	j.Db = db
-	if err != nil {
-		return errors.Wrap(err, "db ping")
-	}
-	return nil
+	j.Db, err = j.Conns.Db("")
+	return err
 }
 
 func (j *JoinTable) SampleConfig() string {
@@ -180,28 +187,53 @@ func (j *JoinTable) Stop() {
 	if j.Cache != nil {
 		j.Cache.Close()
 	}
-	if j.Db != nil {
-		j.Db.Close()
+	if j.Conns != nil {
+		j.Conns.Close()
 	}
 }
 
 func (j *JoinTable) collectDBData(ctx context.Context, cancel context.CancelFunc, joinTableConfig JoinTableConfig) ([]map[string]string, error) {
-	var querySQL string
-	queryArgs := make([]interface{}, 0, 2)
-	for _, dbDataConfig := range joinTableConfig.QueryDataConfigs {
+	var dataConfig *QueryDataConfig
+	for i, dbDataConfig := range joinTableConfig.QueryDataConfigs {
 		if versionSatisfied(dbDataConfig.MinOBVersion, dbDataConfig.MaxOBVersion, j.Ob.MetaInfo.Version) {
-			querySQL = dbDataConfig.QuerySQL
-			queryArgs = dbDataConfig.QueryArgs
+			dataConfig = &joinTableConfig.QueryDataConfigs[i]
 			break
 		}
 	}
-	if querySQL == "" {
+	if dataConfig == nil || dataConfig.QuerySQL == "" {
 		return nil, nil
 	}
+	if !dataConfig.ForEachTenant {
+		db, err := j.Conns.Db(dataConfig.Connection)
+		if err != nil {
+			return nil, err
+		}
+		return j.queryDBData(ctx, db, dataConfig.QuerySQL, dataConfig.QueryArgs)
+	}
+	tenantConns, err := j.Conns.TenantConnections(ctx, j.Ob)
+	if err != nil {
+		return nil, err
+	}
+	dbData := make([]map[string]string, 0)
+	for _, conn := range tenantConns {
+		tenantData, err := j.queryDBData(ctx, conn.Db, dataConfig.QuerySQL, dataConfig.QueryArgs)
+		if err != nil {
+			log.WithContext(ctx).Warnf("query join table data in tenant %s failed, err: %s", conn.TenantName, err)
+			continue
+		}
+		for _, data := range tenantData {
+			data["ob_tenant_id"] = strconv.FormatInt(conn.TenantId, 10)
+			data["tenant_name"] = conn.TenantName
+		}
+		dbData = append(dbData, tenantData...)
+	}
+	return dbData, nil
+}
 
+func (j *JoinTable) queryDBData(ctx context.Context, db *sql.DB, querySQL string, queryArgs []interface{}) ([]map[string]string, error) {
 	tStart := time.Now()
 	entry := log.WithContext(context.WithValue(ctx, agentlog.StartTimeKey, tStart)).WithField("query sql", querySQL)
-	results, err := j.Db.QueryContext(ctx, querySQL, queryArgs...)
+	results, err := db.QueryContext(ctx, querySQL, queryArgs...)
 	entry.Debug("execute end")
 	duration := time.Now().Sub(tStart)
 	// stat.MonitorAgentTableInputHistogram.WithLabelValues(config.Name).Observe(duration.Seconds())
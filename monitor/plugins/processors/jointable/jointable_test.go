@@ -23,6 +23,7 @@ import (
 	"github.com/dolthub/go-mysql-server/auth"
 	"github.com/dolthub/go-mysql-server/memory"
 	"github.com/dolthub/go-mysql-server/server"
+	"github.com/jmoiron/sqlx"
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/yaml.v2"
 
@@ -186,6 +187,44 @@ joinTableConfigs:
 	assert.Equal(t, "4", t4Value)
 }
 
+func TestJoinTable_ForEachTenant(t *testing.T) {
+	configStr := `
+connection:
+  url: user:pass@tcp(127.0.0.1:9878)/oceanbase?interpolateParams=true
+  maxIdle: 2
+  maxOpen: 32
+tenantConnection:
+  url: '{tenant}:pass@tcp(127.0.0.1:9878)/oceanbase?interpolateParams=true'
+  maxIdle: 1
+  maxOpen: 2
+`
+	processor := &JoinTable{}
+	defer processor.Stop()
+
+	var pluginConfig JoinTablePluginConfig
+	err := yaml.Unmarshal([]byte(configStr), &pluginConfig)
+	assert.Nil(t, err)
+	processor.Config = &pluginConfig
+	err = processor.initDbConnection()
+	assert.Nil(t, err)
+
+	_, err = processor.Db.Exec("create table __all_tenant (tenant_id bigint primary key, tenant_name varchar(128))")
+	assert.Nil(t, err)
+	defer processor.Db.Exec("drop table __all_tenant")
+	_, err = processor.Db.Exec("insert into __all_tenant values (1002, 'user')")
+	assert.Nil(t, err)
+	db, err := sqlx.Connect("mysql", pluginConfig.DbConnectionConfig.Url)
+	assert.Nil(t, err)
+	defer db.Close()
+	processor.Ob = &common.Observer{Db: db, MetaInfo: &common.ObserverMetaInfo{Version: "2.2.77", AllTenantIds: []int64{1, 1002}}}
+
+	dbData, err := processor.collectDBData(context.Background(), func() {}, JoinTableConfig{
+		QueryDataConfigs: []QueryDataConfig{{QuerySQL: "select 'tv1' as t1", ForEachTenant: true}},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []map[string]string{{"t1": "tv1", "ob_tenant_id": "1002", "tenant_name": "user"}}, dbData)
+}
+
 func TestMain(m *testing.M) {
 	s := setup()
 	code := m.Run()
@@ -0,0 +1,368 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package logmetric
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+
+	"github.com/oceanbase/obagent/errors"
+	"github.com/oceanbase/obagent/lib/log_analyzer"
+	"github.com/oceanbase/obagent/monitor/message"
+	"github.com/oceanbase/obagent/monitor/utils"
+)
+
+const sampleConfig = `
+dropLogs: false
+expireTime: 1h
+rules:
+  - name: ob_log_timeout_total
+    type: counter
+    logTypes: [ observer ]
+    pattern: 'ret=-4012'
+    tags: [ tenant ]
+  - name: ob_log_error_total
+    type: counter
+    logTypes: [ observer ]
+    levels: [ error ]
+    tags: [ module ]
+  - name: ob_slow_trans_duration_seconds
+    type: histogram
+    logTypes: [ observer ]
+    pattern: '\[slow trans\].*total_time=(?P<duration>\d+)'
+    value: duration
+    scale: 0.000001
+    buckets: [ 0.1, 0.5, 1, 5, 10, 30, 60 ]
+    tags: [ tenant ]
+`
+
+const description = `
+extract counter and histogram metrics from log messages by regular expressions
+`
+
+type RuleType string
+
+const (
+	CounterRule   RuleType = "counter"
+	HistogramRule RuleType = "histogram"
+)
+
+const defaultExpireTime = time.Hour
+
+var defaultBuckets = []float64{0.001, 0.01, 0.1, 0.5, 1, 5, 10, 60}
+
+type LogMetricRule struct {
+	// Name name of the metric produced
+	Name string `yaml:"name"`
+	// Type counter or histogram, default counter
+	Type RuleType `yaml:"type"`
+	// LogTypes log types to match, e.g. observer, election, rootservice. empty means all
+	LogTypes []string `yaml:"logTypes"`
+	// Levels log levels to match, empty means all
+	Levels []string `yaml:"levels"`
+	// Pattern regular expression to match with the field, named groups are added as tags except the value group.
+	// empty means all the logs of the types and levels are matched
+	Pattern string `yaml:"pattern"`
+	// Field field of the log to match, default content, raw is used when the log has no content
+	Field string `yaml:"field"`
+	// Tags tags of the log copied to the metric
+	Tags []string `yaml:"tags"`
+	// Value named group of the histogram value
+	Value string `yaml:"value"`
+	// Scale multiplied to the value, e.g. 0.000001 to convert microseconds to seconds, default 1
+	Scale float64 `yaml:"scale"`
+	// Buckets upper bounds of the histogram buckets
+	Buckets []float64 `yaml:"buckets"`
+
+	regexp     *regexp.Regexp
+	logTypes   map[string]bool
+	levels     map[string]bool
+	valueIndex int
+}
+
+type LogMetricConfig struct {
+	Rules []*LogMetricRule `yaml:"rules"`
+	// DropLogs drops the log messages, otherwise they are passed along with the metrics
+	DropLogs bool `yaml:"dropLogs"`
+	// ExpireTime series not matched for this duration are no longer emitted
+	ExpireTime time.Duration `yaml:"expireTime"`
+}
+
+type series struct {
+	name       string
+	metricType message.Type
+	tags       []message.TagEntry
+	count      float64
+	histogram  *message.CumulativeHistogram
+	lastUpdate time.Time
+}
+
+// LogMetricProcessor matches log messages with the rules and keeps cumulative series of the results.
+// All the live series are emitted with every batch, so the metrics stay visible to exporters between logs.
+type LogMetricProcessor struct {
+	Config *LogMetricConfig
+
+	lock   sync.Mutex
+	series map[string]*series
+	now    func() time.Time
+}
+
+func (p *LogMetricProcessor) SampleConfig() string {
+	return sampleConfig
+}
+
+func (p *LogMetricProcessor) Description() string {
+	return description
+}
+
+func (p *LogMetricProcessor) Init(ctx context.Context, config map[string]interface{}) error {
+	var logMetricConfig LogMetricConfig
+	configBytes, err := yaml.Marshal(config)
+	if err != nil {
+		return errors.Wrap(err, "logMetricProcessor encode config")
+	}
+	err = yaml.Unmarshal(configBytes, &logMetricConfig)
+	if err != nil {
+		return errors.Wrap(err, "logMetricProcessor decode config")
+	}
+	for _, rule := range logMetricConfig.Rules {
+		if err = rule.init(); err != nil {
+			return errors.Wrapf(err, "logMetricProcessor rule %s", rule.Name)
+		}
+	}
+	if logMetricConfig.ExpireTime <= 0 {
+		logMetricConfig.ExpireTime = defaultExpireTime
+	}
+	p.Config = &logMetricConfig
+	p.series = make(map[string]*series)
+	p.now = time.Now
+	log.WithContext(ctx).Infof("init logMetricProcessor with config: %+v", p.Config)
+	return nil
+}
+
+func (r *LogMetricRule) init() error {
+	if r.Name == "" {
+		return errors.New("name not set")
+	}
+	switch r.Type {
+	case "":
+		r.Type = CounterRule
+	case CounterRule, HistogramRule:
+	default:
+		return errors.Errorf("unknown type %s", r.Type)
+	}
+	if r.Field == "" {
+		r.Field = "content"
+	}
+	if r.Scale == 0 {
+		r.Scale = 1
+	}
+	r.valueIndex = -1
+	if r.Pattern != "" {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return errors.Wrap(err, "compile pattern")
+		}
+		r.regexp = re
+		if r.Value != "" {
+			for i, name := range re.SubexpNames() {
+				if name == r.Value {
+					r.valueIndex = i
+				}
+			}
+		}
+	}
+	if r.Type == HistogramRule {
+		if r.valueIndex < 0 {
+			return errors.Errorf("value group %s not found in pattern", r.Value)
+		}
+		if len(r.Buckets) == 0 {
+			r.Buckets = defaultBuckets
+		}
+		sort.Float64s(r.Buckets)
+	}
+	r.logTypes = toSet(r.LogTypes, false)
+	r.levels = toSet(r.Levels, true)
+	return nil
+}
+
+func toSet(names []string, lower bool) map[string]bool {
+	ret := make(map[string]bool, len(names))
+	for _, name := range names {
+		if lower {
+			name = strings.ToLower(name)
+		}
+		ret[name] = true
+	}
+	return ret
+}
+
+// match returns the tags of the metric and the value for histograms, ok is false when the log does not match
+func (r *LogMetricRule) match(msg *message.Message) (tags []message.TagEntry, value float64, ok bool) {
+	if len(r.logTypes) > 0 && !r.logTypes[log_analyzer.GetLogType(msg.GetName())] {
+		return nil, 0, false
+	}
+	if len(r.levels) > 0 {
+		level, _ := msg.GetTag("level")
+		if !r.levels[strings.ToLower(level)] {
+			return nil, 0, false
+		}
+	}
+	for _, name := range r.Tags {
+		if v, found := msg.GetTag(name); found && v != "" {
+			tags = append(tags, message.TagEntry{Name: name, Value: v})
+		}
+	}
+	if r.regexp == nil {
+		return tags, 0, true
+	}
+	text, found := logText(msg, r.Field)
+	if !found {
+		return nil, 0, false
+	}
+	subMatch := r.regexp.FindStringSubmatch(text)
+	if subMatch == nil {
+		return nil, 0, false
+	}
+	for i, name := range r.regexp.SubexpNames() {
+		if name == "" || i == r.valueIndex || subMatch[i] == "" {
+			continue
+		}
+		tags = append(tags, message.TagEntry{Name: name, Value: subMatch[i]})
+	}
+	if r.valueIndex >= 0 {
+		v, converted := utils.ConvertToFloat64(subMatch[r.valueIndex])
+		if !converted {
+			return nil, 0, false
+		}
+		value = v * r.Scale
+	}
+	return tags, value, true
+}
+
+func logText(msg *message.Message, field string) (string, bool) {
+	v, found := msg.GetField(field)
+	if !found && field == "content" {
+		v, found = msg.GetField("raw")
+	}
+	if !found {
+		return "", false
+	}
+	s, ok := v.(string)
+	return s, ok
+}
+
+func (p *LogMetricProcessor) Start(in <-chan []*message.Message, out chan<- []*message.Message) error {
+	for msgs := range in {
+		newMsgs, err := p.Process(context.Background(), msgs...)
+		if err != nil {
+			log.Errorf("logMetricProcessor process messages failed, err: %s", err)
+		}
+		out <- newMsgs
+	}
+	return nil
+}
+
+func (p *LogMetricProcessor) Stop() {}
+
+func (p *LogMetricProcessor) Process(ctx context.Context, metrics ...*message.Message) ([]*message.Message, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	now := p.now()
+	ret := make([]*message.Message, 0, len(metrics)+len(p.series))
+	for _, metric := range metrics {
+		if metric.GetMetricType() != message.Log {
+			ret = append(ret, metric)
+			continue
+		}
+		for _, rule := range p.Config.Rules {
+			tags, value, ok := rule.match(metric)
+			if ok {
+				p.observe(rule, tags, value, now)
+			}
+		}
+		if !p.Config.DropLogs {
+			ret = append(ret, metric)
+		}
+	}
+	return append(ret, p.emit(now)...), nil
+}
+
+func (p *LogMetricProcessor) observe(rule *LogMetricRule, tags []message.TagEntry, value float64, now time.Time) {
+	key := seriesKey(rule.Name, tags)
+	s, ok := p.series[key]
+	if !ok {
+		s = &series{name: rule.Name, metricType: message.Counter, tags: tags}
+		if rule.Type == HistogramRule {
+			s.metricType = message.Histogram
+			s.histogram = message.NewCumulativeHistogram(rule.Buckets)
+		}
+		p.series[key] = s
+	}
+	if s.histogram != nil {
+		s.histogram.Observe(value)
+	} else {
+		s.count++
+	}
+	s.lastUpdate = now
+}
+
+// emit returns all the live series and removes the expired ones
+func (p *LogMetricProcessor) emit(now time.Time) []*message.Message {
+	keys := make([]string, 0, len(p.series))
+	for key, s := range p.series {
+		if now.Sub(s.lastUpdate) > p.Config.ExpireTime {
+			delete(p.series, key)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	ret := make([]*message.Message, 0, len(keys))
+	for _, key := range keys {
+		s := p.series[key]
+		msg := message.NewMessageWithTagsFields(s.name, s.metricType, now, append([]message.TagEntry(nil), s.tags...), nil)
+		if s.histogram != nil {
+			for _, field := range s.histogram.Fields() {
+				msg.AddField(field.Name, field.Value)
+			}
+		} else {
+			msg.AddField("value", s.count)
+		}
+		ret = append(ret, msg)
+	}
+	return ret
+}
+
+func seriesKey(name string, tags []message.TagEntry) string {
+	sorted := append([]message.TagEntry(nil), tags...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	var sb strings.Builder
+	sb.WriteString(name)
+	for _, tag := range sorted {
+		sb.WriteString("\x00")
+		sb.WriteString(tag.Name)
+		sb.WriteString("=")
+		sb.WriteString(tag.Value)
+	}
+	return sb.String()
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package logmetric
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"github.com/oceanbase/obagent/lib/log_analyzer"
+	"github.com/oceanbase/obagent/monitor/message"
+)
+
+func parseObLog(t *testing.T, line string) *message.Message {
+	msg, ok := log_analyzer.NewObLogAnalyzer("observer.log").ParseLine(line)
+	require.True(t, ok)
+	return msg
+}
+
+func findMetric(msgs []*message.Message, name string, tagName string, tagValue string) *message.Message {
+	for _, msg := range msgs {
+		if msg.GetName() != name {
+			continue
+		}
+		if v, _ := msg.GetTag(tagName); v == tagValue {
+			return msg
+		}
+	}
+	return nil
+}
+
+func TestLogMetricProcessor(t *testing.T) {
+	configStr := sampleConfig
+	var configMap map[string]interface{}
+	require.Nil(t, yaml.Unmarshal([]byte(configStr), &configMap))
+	processor := &LogMetricProcessor{}
+	require.Nil(t, processor.Init(context.Background(), configMap))
+	timeout := parseObLog(t, `[2023-05-01 10:00:00.123456] WARN  [SQL] handle_timeout (ob_sql.cpp:100) [1234][T1001_L0_G0][T1001][YB42AC1E87D6-0005F9D7A8B8E3F4-0-0] [lt=5] fail to execute(ret=-4012)`)
+	errorLog := parseObLog(t, `[2023-05-01 10:00:01.123456] ERROR [STORAGE] do_write (ob_storage.cpp:200) [1235][T1002_L0_G0][T1002][YB42AC1E87D6-0005F9D7A8B8E3F5-0-0] [lt=5] write failed(ret=-4009)`)
+	slowTrans := parseObLog(t, `[2023-05-01 10:00:02.123456] WARN  [TRANS] end_trans (ob_trans.cpp:300) [1236][T1001_L0_G0][T1001][YB42AC1E87D6-0005F9D7A8B8E3F6-0-0] [lt=5] [slow trans] total_time=2500000`)
+	other := message.NewMessage("ob_sysstat", message.Gauge, time.Now()).AddField("value", 1.0)
+
+	out, err := processor.Process(context.Background(), timeout, errorLog, slowTrans, other, timeout)
+	require.Nil(t, err)
+	// 4 logs and 1 gauge are passed, 3 series produced
+	require.Equal(t, 8, len(out))
+
+	timeoutMetric := findMetric(out, "ob_log_timeout_total", "tenant", "1001")
+	require.NotNil(t, timeoutMetric)
+	require.Equal(t, message.Counter, timeoutMetric.GetMetricType())
+	v, _ := timeoutMetric.GetField("value")
+	require.Equal(t, 2.0, v)
+
+	errorMetric := findMetric(out, "ob_log_error_total", "module", "STORAGE")
+	require.NotNil(t, errorMetric)
+	v, _ = errorMetric.GetField("value")
+	require.Equal(t, 1.0, v)
+
+	slowMetric := findMetric(out, "ob_slow_trans_duration_seconds", "tenant", "1001")
+	require.NotNil(t, slowMetric)
+	require.Equal(t, message.Histogram, slowMetric.GetMetricType())
+	v, _ = slowMetric.GetField("count")
+	require.Equal(t, 1.0, v)
+	v, _ = slowMetric.GetField("sum")
+	require.InDelta(t, 2.5, v, 1e-9)
+	v, _ = slowMetric.GetField("1")
+	require.Equal(t, 0.0, v)
+	v, _ = slowMetric.GetField("5")
+	require.Equal(t, 1.0, v)
+
+	// series are cumulative and emitted without new logs
+	out, _ = processor.Process(context.Background(), timeout)
+	v, _ = findMetric(out, "ob_log_timeout_total", "tenant", "1001").GetField("value")
+	require.Equal(t, 3.0, v)
+	out, _ = processor.Process(context.Background())
+	require.Equal(t, 3, len(out))
+}
+
+func TestLogMetricProcessor_dropLogsAndExpire(t *testing.T) {
+	configStr := `
+dropLogs: true
+expireTime: 1m
+rules:
+  - name: agent_error_total
+    logTypes: [ monagent ]
+    levels: [ ERROR ]
+    pattern: 'code=(?P<code>\d+)'
+`
+	var configMap map[string]interface{}
+	require.Nil(t, yaml.Unmarshal([]byte(configStr), &configMap))
+	processor := &LogMetricProcessor{}
+	require.Nil(t, processor.Init(context.Background(), configMap))
+	now := time.Now()
+	processor.now = func() time.Time { return now }
+	errorLog := message.NewMessage("monagent.log", message.Log, now).
+		AddTag("level", "error").AddField("content", "request failed, code=500")
+	infoLog := message.NewMessage("monagent.log", message.Log, now).
+		AddTag("level", "info").AddField("content", "request failed, code=500")
+
+	out, _ := processor.Process(context.Background(), errorLog, infoLog)
+	require.Equal(t, 1, len(out))
+	require.Equal(t, "agent_error_total", out[0].GetName())
+	code, _ := out[0].GetTag("code")
+	require.Equal(t, "500", code)
+
+	now = now.Add(2 * time.Minute)
+	out, _ = processor.Process(context.Background())
+	require.Equal(t, 0, len(out))
+}
+
+func TestLogMetricRule_init(t *testing.T) {
+	require.NotNil(t, (&LogMetricRule{}).init())
+	require.NotNil(t, (&LogMetricRule{Name: "a", Type: "gauge"}).init())
+	require.NotNil(t, (&LogMetricRule{Name: "a", Pattern: "("}).init())
+	require.NotNil(t, (&LogMetricRule{Name: "a", Type: HistogramRule, Pattern: `(?P<v>\d+)`, Value: "x"}).init())
+	require.Nil(t, (&LogMetricRule{Name: "a", Type: HistogramRule, Pattern: `(?P<v>\d+)`, Value: "v"}).init())
+}
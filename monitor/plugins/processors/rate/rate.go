@@ -0,0 +1,237 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package rate
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+
+	"github.com/oceanbase/obagent/errors"
+	"github.com/oceanbase/obagent/monitor/message"
+	"github.com/oceanbase/obagent/monitor/utils"
+)
+
+const sampleConfig = `
+mode: rate
+metrics: [ ob_sysstat, ob_waitevent ]
+fields: [ value ]
+replace: false
+expireTime: 10m
+`
+
+const description = `
+compute per-second rate or delta of counter fields, by comparing with the previous sample of the same series
+`
+
+type Mode string
+
+const (
+	RateMode  Mode = "rate"
+	DeltaMode Mode = "delta"
+)
+
+const defaultExpireTime = 10 * time.Minute
+
+type RateConfig struct {
+	// Mode rate or delta, default rate
+	Mode Mode `yaml:"mode"`
+	// Metrics names of metrics to compute, empty means all
+	Metrics []string `yaml:"metrics"`
+	// Fields names of fields to compute, empty means all numeric fields
+	Fields []string `yaml:"fields"`
+	// Replace replaces the field with the result, otherwise the result is added as field <field>_<mode>
+	Replace bool `yaml:"replace"`
+	// ExpireTime previous sample of a series not seen for this duration is removed
+	ExpireTime time.Duration `yaml:"expireTime"`
+}
+
+type sample struct {
+	value    float64
+	time     time.Time
+	lastSeen time.Time
+}
+
+// RateProcessor keeps the previous sample per series (name + sorted tags) and field.
+// A value less than the previous one is treated as a counter reset, the delta is the value itself.
+// The first sample of a series has no result: it is passed without result field, or dropped in replace mode.
+type RateProcessor struct {
+	Config *RateConfig
+
+	metrics   map[string]bool
+	fields    map[string]bool
+	samples   map[string]*sample
+	lastSweep time.Time
+	lock      sync.Mutex
+	now       func() time.Time
+}
+
+func (r *RateProcessor) SampleConfig() string {
+	return sampleConfig
+}
+
+func (r *RateProcessor) Description() string {
+	return description
+}
+
+func (r *RateProcessor) Init(ctx context.Context, config map[string]interface{}) error {
+	var rateConfig RateConfig
+	configBytes, err := yaml.Marshal(config)
+	if err != nil {
+		return errors.Wrap(err, "rateProcessor encode config")
+	}
+	err = yaml.Unmarshal(configBytes, &rateConfig)
+	if err != nil {
+		return errors.Wrap(err, "rateProcessor decode config")
+	}
+	switch rateConfig.Mode {
+	case "":
+		rateConfig.Mode = RateMode
+	case RateMode, DeltaMode:
+	default:
+		return errors.Errorf("rateProcessor unknown mode %s", rateConfig.Mode)
+	}
+	if rateConfig.ExpireTime <= 0 {
+		rateConfig.ExpireTime = defaultExpireTime
+	}
+	r.Config = &rateConfig
+	r.metrics = toSet(rateConfig.Metrics)
+	r.fields = toSet(rateConfig.Fields)
+	r.samples = make(map[string]*sample)
+	r.now = time.Now
+	r.lastSweep = r.now()
+	log.WithContext(ctx).Infof("init rateProcessor with config: %+v", r.Config)
+	return nil
+}
+
+func toSet(names []string) map[string]bool {
+	ret := make(map[string]bool, len(names))
+	for _, name := range names {
+		ret[name] = true
+	}
+	return ret
+}
+
+func (r *RateProcessor) Start(in <-chan []*message.Message, out chan<- []*message.Message) error {
+	for msgs := range in {
+		newMsgs, err := r.Process(context.Background(), msgs...)
+		if err != nil {
+			log.Errorf("rateProcessor process messages failed, err: %s", err)
+		}
+		out <- newMsgs
+	}
+	return nil
+}
+
+func (r *RateProcessor) Stop() {}
+
+func (r *RateProcessor) Process(ctx context.Context, metrics ...*message.Message) ([]*message.Message, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	now := r.now()
+	ret := make([]*message.Message, 0, len(metrics))
+	for _, metric := range metrics {
+		if len(r.metrics) > 0 && !r.metrics[metric.GetName()] {
+			ret = append(ret, metric)
+			continue
+		}
+		newMetric := r.process(ctx, metric, now)
+		if newMetric != nil {
+			ret = append(ret, newMetric)
+		}
+	}
+	if now.Sub(r.lastSweep) >= r.Config.ExpireTime/2 {
+		r.sweep(now)
+	}
+	return ret, nil
+}
+
+// process computes all the fields of the metric, returns nil when nothing is left in replace mode
+func (r *RateProcessor) process(ctx context.Context, metric *message.Message, now time.Time) *message.Message {
+	id := metric.Identifier()
+	results := make([]message.FieldEntry, 0, len(metric.Fields()))
+	computed := false
+	for _, field := range metric.Fields() {
+		if len(r.fields) > 0 && !r.fields[field.Name] {
+			if r.Config.Replace {
+				results = append(results, field)
+			}
+			continue
+		}
+		value, ok := utils.ConvertToFloat64(field.Value)
+		if !ok {
+			if len(r.fields) > 0 {
+				log.WithContext(ctx).Warnf("rateProcessor can not convert field %s of %s to float64", field.Name, metric.GetName())
+			}
+			if r.Config.Replace {
+				results = append(results, field)
+			}
+			continue
+		}
+		computed = true
+		key := id + "\x00" + field.Name
+		prev, exists := r.samples[key]
+		r.samples[key] = &sample{value: value, time: metric.GetTime(), lastSeen: now}
+		if !exists {
+			continue
+		}
+		result, ok := r.compute(prev, value, metric.GetTime())
+		if !ok {
+			continue
+		}
+		if r.Config.Replace {
+			results = append(results, message.FieldEntry{Name: field.Name, Value: result})
+		} else {
+			results = append(results, message.FieldEntry{Name: field.Name + "_" + string(r.Config.Mode), Value: result})
+		}
+	}
+	if !r.Config.Replace {
+		for _, result := range results {
+			metric.AddField(result.Name, result.Value)
+		}
+		return metric
+	}
+	if computed && len(results) < len(metric.Fields()) {
+		// first sample of some fields
+		return nil
+	}
+	return message.NewMessageWithTagsFields(metric.GetName(), message.Gauge, metric.GetTime(), metric.Tags(), results)
+}
+
+func (r *RateProcessor) compute(prev *sample, value float64, t time.Time) (float64, bool) {
+	delta := value - prev.value
+	if delta < 0 {
+		// counter reset, e.g. observer restarted
+		delta = value
+	}
+	if r.Config.Mode == DeltaMode {
+		return delta, true
+	}
+	seconds := t.Sub(prev.time).Seconds()
+	if seconds <= 0 {
+		return 0, false
+	}
+	return delta / seconds, true
+}
+
+func (r *RateProcessor) sweep(now time.Time) {
+	for key, s := range r.samples {
+		if now.Sub(s.lastSeen) > r.Config.ExpireTime {
+			delete(r.samples, key)
+		}
+	}
+	r.lastSweep = now
+}
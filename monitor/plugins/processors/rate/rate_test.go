@@ -0,0 +1,115 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package rate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"github.com/oceanbase/obagent/monitor/message"
+)
+
+func newSysstat(t time.Time, svrIp string, value float64) *message.Message {
+	return message.NewMessage("ob_sysstat", message.Counter, t).
+		AddTag("svr_ip", svrIp).AddTag("stat_id", "10000").
+		AddField("value", value)
+}
+
+func TestRateProcessor_rate(t *testing.T) {
+	configStr := `
+mode: rate
+metrics: [ ob_sysstat ]
+`
+	var configMap map[string]interface{}
+	require.Nil(t, yaml.Unmarshal([]byte(configStr), &configMap))
+	processor := &RateProcessor{}
+	require.Nil(t, processor.Init(context.Background(), configMap))
+	now := time.Now()
+	other := message.NewMessage("other", message.Gauge, now).AddField("value", 1.0)
+	out, _ := processor.Process(context.Background(), newSysstat(now, "127.0.0.1", 100), other)
+	require.Equal(t, 2, len(out))
+	_, found := out[0].GetField("value_rate")
+	require.False(t, found)
+
+	now = now.Add(10 * time.Second)
+	out, _ = processor.Process(context.Background(), newSysstat(now, "127.0.0.1", 200), newSysstat(now, "127.0.0.2", 50))
+	require.Equal(t, 2, len(out))
+	rate, found := out[0].GetField("value_rate")
+	require.True(t, found)
+	require.Equal(t, 10.0, rate)
+	_, found = out[1].GetField("value_rate")
+	require.False(t, found)
+
+	// counter reset
+	now = now.Add(10 * time.Second)
+	out, _ = processor.Process(context.Background(), newSysstat(now, "127.0.0.1", 50))
+	rate, _ = out[0].GetField("value_rate")
+	require.Equal(t, 5.0, rate)
+}
+
+func TestRateProcessor_deltaReplace(t *testing.T) {
+	configStr := `
+mode: delta
+replace: true
+fields: [ value ]
+`
+	var configMap map[string]interface{}
+	require.Nil(t, yaml.Unmarshal([]byte(configStr), &configMap))
+	processor := &RateProcessor{}
+	require.Nil(t, processor.Init(context.Background(), configMap))
+	now := time.Now()
+	out, _ := processor.Process(context.Background(), newSysstat(now, "127.0.0.1", 100).AddTag("k", "v"))
+	require.Equal(t, 0, len(out))
+
+	now = now.Add(10 * time.Second)
+	// tags in different order is the same series
+	msg := message.NewMessage("ob_sysstat", message.Counter, now).
+		AddTag("k", "v").AddTag("stat_id", "10000").AddTag("svr_ip", "127.0.0.1").
+		AddField("value", 130.0).AddField("other", "x")
+	out, _ = processor.Process(context.Background(), msg)
+	require.Equal(t, 1, len(out))
+	require.Equal(t, message.Gauge, out[0].GetMetricType())
+	delta, _ := out[0].GetField("value")
+	require.Equal(t, 30.0, delta)
+	other, _ := out[0].GetField("other")
+	require.Equal(t, "x", other)
+}
+
+func TestRateProcessor_expire(t *testing.T) {
+	configStr := `
+mode: delta
+expireTime: 1m
+`
+	var configMap map[string]interface{}
+	require.Nil(t, yaml.Unmarshal([]byte(configStr), &configMap))
+	processor := &RateProcessor{}
+	require.Nil(t, processor.Init(context.Background(), configMap))
+	now := time.Now()
+	processor.now = func() time.Time {
+		return now
+	}
+	processor.Process(context.Background(), newSysstat(now, "127.0.0.1", 100))
+	require.Equal(t, 1, len(processor.samples))
+
+	now = now.Add(2 * time.Minute)
+	processor.Process(context.Background(), newSysstat(now, "127.0.0.2", 100))
+	require.Equal(t, 1, len(processor.samples))
+
+	out, _ := processor.Process(context.Background(), newSysstat(now, "127.0.0.1", 150))
+	_, found := out[0].GetField("value_delta")
+	require.False(t, found)
+}
@@ -0,0 +1,157 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package utils
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/oceanbase/obagent/errors"
+)
+
+// ValueMatcher matches a metric name, tag value or field value.
+// All the configured rules must be satisfied. Range rules require the value to be numeric.
+type ValueMatcher struct {
+	// Name tag or field name, not used when matching metric name
+	Name     string   `yaml:"name"`
+	Regex    string   `yaml:"regex"`
+	NotRegex string   `yaml:"notRegex"`
+	Prefix   string   `yaml:"prefix"`
+	NotEqual *string  `yaml:"notEqual"`
+	In       []string `yaml:"in"`
+	NotIn    []string `yaml:"notIn"`
+	// Min and Max inclusive numeric range
+	Min *float64 `yaml:"min"`
+	Max *float64 `yaml:"max"`
+
+	regex    *regexp.Regexp
+	notRegex *regexp.Regexp
+	in       map[string]bool
+	notIn    map[string]bool
+}
+
+// Init compiles the matcher, must be called before Match
+func (m *ValueMatcher) Init() error {
+	var err error
+	if m.Regex != "" {
+		m.regex, err = regexp.Compile("^(?:" + m.Regex + ")$")
+		if err != nil {
+			return errors.Wrapf(err, "invalid regex %s", m.Regex)
+		}
+	}
+	if m.NotRegex != "" {
+		m.notRegex, err = regexp.Compile("^(?:" + m.NotRegex + ")$")
+		if err != nil {
+			return errors.Wrapf(err, "invalid notRegex %s", m.NotRegex)
+		}
+	}
+	m.in = stringSet(m.In)
+	m.notIn = stringSet(m.NotIn)
+	if m.Min != nil && m.Max != nil && *m.Min > *m.Max {
+		return errors.Errorf("invalid range [%v, %v]", *m.Min, *m.Max)
+	}
+	return nil
+}
+
+// InitMatchers compiles the metric, tag and field matchers of a condition, metricMatcher may be nil
+func InitMatchers(metricMatcher *ValueMatcher, tagMatchers []*ValueMatcher, fieldMatchers []*ValueMatcher) error {
+	matchers := append([]*ValueMatcher{}, tagMatchers...)
+	matchers = append(matchers, fieldMatchers...)
+	if metricMatcher != nil {
+		matchers = append(matchers, metricMatcher)
+	}
+	for _, matcher := range matchers {
+		err := matcher.Init()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func stringSet(values []string) map[string]bool {
+	if values == nil {
+		return nil
+	}
+	ret := make(map[string]bool, len(values))
+	for _, v := range values {
+		ret[v] = true
+	}
+	return ret
+}
+
+// Match matches a tag value or metric name
+func (m *ValueMatcher) Match(value string) bool {
+	if !m.matchString(value) {
+		return false
+	}
+	if m.Min == nil && m.Max == nil {
+		return true
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return false
+	}
+	return m.matchRange(f)
+}
+
+// MatchValue matches a field value
+func (m *ValueMatcher) MatchValue(value interface{}) bool {
+	if m.regex != nil || m.notRegex != nil || m.Prefix != "" || m.NotEqual != nil || m.in != nil || m.notIn != nil {
+		s, _ := ConvertToString(value)
+		if !m.matchString(s) {
+			return false
+		}
+	}
+	if m.Min == nil && m.Max == nil {
+		return true
+	}
+	f, ok := ConvertToFloat64(value)
+	if !ok {
+		return false
+	}
+	return m.matchRange(f)
+}
+
+func (m *ValueMatcher) matchString(value string) bool {
+	if m.regex != nil && !m.regex.MatchString(value) {
+		return false
+	}
+	if m.notRegex != nil && m.notRegex.MatchString(value) {
+		return false
+	}
+	if m.Prefix != "" && !strings.HasPrefix(value, m.Prefix) {
+		return false
+	}
+	if m.NotEqual != nil && value == *m.NotEqual {
+		return false
+	}
+	if m.in != nil && !m.in[value] {
+		return false
+	}
+	if m.notIn != nil && m.notIn[value] {
+		return false
+	}
+	return true
+}
+
+func (m *ValueMatcher) matchRange(f float64) bool {
+	if m.Min != nil && f < *m.Min {
+		return false
+	}
+	if m.Max != nil && f > *m.Max {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) 2023 OceanBase
+ * OBAgent is licensed under Mulan PSL v2.
+ * You can use this software according to the terms and conditions of the Mulan PSL v2.
+ * You may obtain a copy of Mulan PSL v2 at:
+ *          http://license.coscl.org.cn/MulanPSL2
+ * THIS SOFTWARE IS PROVIDED ON AN "AS IS" BASIS, WITHOUT WARRANTIES OF ANY KIND,
+ * EITHER EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO NON-INFRINGEMENT,
+ * MERCHANTABILITY OR FIT FOR A PARTICULAR PURPOSE.
+ * See the Mulan PSL v2 for more details.
+ */
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValueMatcher(t *testing.T) {
+	min, max := 1001.0, 1999.0
+	empty := ""
+	tests := []struct {
+		name    string
+		matcher ValueMatcher
+		value   string
+		expect  bool
+	}{
+		{"regex match", ValueMatcher{Regex: "user_.*"}, "user_tab", true},
+		{"regex is anchored", ValueMatcher{Regex: "user"}, "user_tab", false},
+		{"not regex", ValueMatcher{NotRegex: "sys_.*"}, "user_tab", true},
+		{"prefix", ValueMatcher{Prefix: "ob_"}, "node_load1", false},
+		{"not equal", ValueMatcher{NotEqual: &empty}, "", false},
+		{"in", ValueMatcher{In: []string{"a", "b"}}, "b", true},
+		{"not in", ValueMatcher{NotIn: []string{"a", "b"}}, "b", false},
+		{"range", ValueMatcher{Min: &min, Max: &max}, "1500", true},
+		{"out of range", ValueMatcher{Min: &min, Max: &max}, "1", false},
+		{"range of non numeric", ValueMatcher{Min: &min}, "abc", false},
+		{"all rules", ValueMatcher{Prefix: "1", Min: &min, NotIn: []string{"1002"}}, "1002", false},
+	}
+	for _, tt := range tests {
+		assert.Nil(t, tt.matcher.Init(), tt.name)
+		assert.Equal(t, tt.expect, tt.matcher.Match(tt.value), tt.name)
+	}
+}
+
+func TestValueMatcher_MatchValue(t *testing.T) {
+	min := 10.0
+	matcher := ValueMatcher{Min: &min, In: []string{"10", "20.5"}}
+	assert.Nil(t, matcher.Init())
+	assert.True(t, matcher.MatchValue(20.5))
+	assert.True(t, matcher.MatchValue(int64(10)))
+	assert.False(t, matcher.MatchValue(15.0))
+}
+
+func TestValueMatcher_InitFailed(t *testing.T) {
+	min, max := 2.0, 1.0
+	assert.NotNil(t, (&ValueMatcher{Regex: "("}).Init())
+	assert.NotNil(t, (&ValueMatcher{Min: &min, Max: &max}).Init())
+}
+
+func TestInitMatchers(t *testing.T) {
+	metricMatcher := &ValueMatcher{Regex: "ob_.*"}
+	tagMatcher := &ValueMatcher{In: []string{"a"}}
+	assert.Nil(t, InitMatchers(metricMatcher, []*ValueMatcher{tagMatcher}, nil))
+	assert.True(t, metricMatcher.Match("ob_sql"))
+	assert.False(t, tagMatcher.Match("b"))
+	assert.Nil(t, InitMatchers(nil, nil, nil))
+	assert.NotNil(t, InitMatchers(nil, nil, []*ValueMatcher{{Regex: "("}}))
+}
@@ -18,6 +18,13 @@ const PluginExecuteStatusKey = "status"
 
 const PluginNameKey = "plugin"
 
+const PipelineNameKey = "pipeline"
+
+const (
+	SkipReasonKey = "reason"
+	DbTargetKey   = "target"
+)
+
 const (
 	MysqlOutputMetricName   = "metric_name"
 	MysqlOutputTableNameKey = "table"
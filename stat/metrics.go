@@ -42,11 +42,16 @@ func RegisterStat(ctx context.Context) {
 		prometheus.NewGoCollector(),
 		HttpRequestMillisecondsSummary,
 		MonAgentPipelineReportMetricsTotal,
+		MonAgentPipelineBufferMetrics,
+		MonAgentPipelineSinkDropTotal,
 		MonAgentPipelineExecuteTotal,
 		MonAgentPipelineExecuteSecondsTotal,
 		MonAgentPluginExecuteTotal,
 		MonAgentPluginExecuteSecondsTotal,
 		MonitorAgentTableInputHistogram,
+		MonitorAgentTableInputIntervalFactor,
+		MonitorAgentTableInputSkipTotal,
+		MonitorAgentTableInputOverloaded,
 		InputCollectMetricsTotal,
 		ProcessorProcessMetricsTotal,
 		OutputWriteMetricsTotal,
@@ -61,6 +66,11 @@ func RegisterStat(ctx context.Context) {
 		HttpOutputSendFailedCount,
 		HttpOutputSendRetryCount,
 		HttpOutputSendMillisecondsSummary,
+		HttpOutputSpoolRecords,
+		HttpOutputSpoolBytes,
+		HttpOutputSpoolReplayLagSeconds,
+		HttpOutputSpoolDiscardCount,
+		HttpOutputSpoolCorruptCount,
 		SqlAuditInputCollectDataJumpedCount,
 		MysqlOutputWriteTaskSize,
 		MysqlOutputWriteSqlCount,
@@ -73,6 +83,7 @@ func RegisterStat(ctx context.Context) {
 		LogTailerReadingFileOffset,
 		LogTailerReadingFileId,
 		LogTailerProcessQueueSize,
+		LogTailerDroppedCount,
 	)
 
 	gatherPtr, _ := defaultGatherer.(*prometheus.Registry)
@@ -95,10 +106,16 @@ var (
 	)
 
 	//MonAgentPipelineBufferMetrics monitor pipeline buffer metrics
-	_ = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	MonAgentPipelineBufferMetrics = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "monagent_pipeline_buffer_metrics",
-		Help: "The number of metrics currently in pipeline output buffer",
-	}, []string{PluginNameKey})
+		Help: "The number of metric batches currently in pipeline sink buffer",
+	}, []string{PipelineNameKey, PluginNameKey})
+
+	//MonAgentPipelineSinkDropTotal monitor pipeline sink drop metrics total
+	MonAgentPipelineSinkDropTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "monagent_pipeline_sink_drop_total",
+		Help: "The total number of metrics dropped because pipeline sink buffer is full",
+	}, []string{PipelineNameKey, PluginNameKey})
 
 	//MonAgentPipelineReportMetricsTotal monitor pipeline report message total
 	MonAgentPipelineReportMetricsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
@@ -139,6 +156,27 @@ var (
 			Buckets:   []float64{0.001, 0.005, 0.01, 0.02, 0.05, 0.1, 0.2, 0.5, 1},
 		}, []string{PluginNameKey})
 
+	MonitorAgentTableInputIntervalFactor = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "monagent",
+		Subsystem: "input",
+		Name:      "sql_interval_factor",
+		Help:      "The factor by which the collect interval of a sql is stretched because of slowness or errors",
+	}, []string{PluginNameKey})
+
+	MonitorAgentTableInputSkipTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "monagent",
+		Subsystem: "input",
+		Name:      "sql_skip_total",
+		Help:      "The total number of sql collections skipped to reduce load of the database",
+	}, []string{PluginNameKey, SkipReasonKey})
+
+	MonitorAgentTableInputOverloaded = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "monagent",
+		Subsystem: "input",
+		Name:      "sql_target_overloaded",
+		Help:      "Whether the database collected by sql is regarded as overloaded, 1 for overloaded",
+	}, []string{DbTargetKey})
+
 	InputCollectMetricsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "input_collect_metrics_total",
 		Help: "The total metrics count that input collected",
@@ -260,6 +298,31 @@ var (
 		}, []string{MysqlOutputTableNameKey},
 	)
 
+	HttpOutputSpoolRecords = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "http_output_spool_records",
+		Help: "The number of push payloads in http output disk spool waiting for replay",
+	}, []string{HttpApiPath})
+
+	HttpOutputSpoolBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "http_output_spool_bytes",
+		Help: "The bytes of push payloads in http output disk spool waiting for replay",
+	}, []string{HttpApiPath})
+
+	HttpOutputSpoolReplayLagSeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "http_output_spool_replay_lag_seconds",
+		Help: "The age in seconds of the oldest payload in http output disk spool",
+	}, []string{HttpApiPath})
+
+	HttpOutputSpoolDiscardCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_output_spool_discard_count",
+		Help: "The number of push payloads discarded because http output disk spool exceeds size or age limit",
+	}, []string{HttpApiPath})
+
+	HttpOutputSpoolCorruptCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_output_spool_corrupt_count",
+		Help: "The number of push payloads discarded because http output disk spool segment is corrupt",
+	}, []string{HttpApiPath})
+
 	LogTailerCount = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "log_tailer_count",
 		Help: "log tailer count",
@@ -280,6 +343,10 @@ var (
 		Name: "log_tailer_processing_queue_size",
 		Help: "log tailer processing queue size",
 	}, []string{LogFileName})
+	LogTailerDroppedCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "log_tailer_dropped_count",
+		Help: "log tailer count of logs dropped by sampling, rate limit or deduplication",
+	}, []string{LogFileName, SkipReasonKey})
 )
 
 func PromHandler(_ http.Handler) http.Handler {